@@ -2,9 +2,11 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
@@ -28,9 +30,24 @@ func MakeRefreshToken() (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
-// HashPassword хеширует пароль с использованием Argon2id
+// MakeOneTimeToken создает случайный одноразовый токен для ссылок из писем
+// (сброс пароля и т.п.). Формат совпадает с refresh token: 64 hex символа
+func MakeOneTimeToken() (string, error) {
+	return MakeRefreshToken()
+}
+
+// HashToken возвращает SHA-256 (hex) от токена для хранения в БД.
+// Production: для случайных 256-bit токенов соль и медленный хеш не нужны,
+// а детерминированный хеш позволяет искать токен по первичному ключу
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// HashPassword хеширует пароль с использованием Argon2id (параметры - SetPasswordParams)
 func HashPassword(password string) (string, error) {
-	hash, err := argon2id.CreateHash(password, argon2id.DefaultParams)
+	params := passwordParams
+	hash, err := argon2id.CreateHash(password, &params)
 	if err != nil {
 		return "", err
 	}
@@ -48,16 +65,8 @@ func CheckPasswordHash(password, hash string) (bool, error) {
 
 // MakeJWT создает JWT токен для пользователя
 func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	// Создаем claims (данные токена)
-	claims := jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-		Subject:   userID.String(),
-	}
-
 	// Создаем токен с claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, newClaims(userID, expiresIn))
 
 	// Подписываем токен секретным ключом
 	signedToken, err := token.SignedString([]byte(tokenSecret))
@@ -68,6 +77,17 @@ func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
 	return signedToken, nil
 }
 
+// newClaims создает claims (данные токена) access token пользователя
+func newClaims(userID uuid.UUID, expiresIn time.Duration) jwt.RegisteredClaims {
+	now := time.Now().UTC()
+	return jwt.RegisteredClaims{
+		Issuer:    "chirpy",
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+		Subject:   userID.String(),
+	}
+}
+
 // ValidateJWT проверяет и валидирует JWT токен
 func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 	// Парсим токен с claims
@@ -79,6 +99,13 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 		return []byte(tokenSecret), nil
 	})
 
+	return userIDFromToken(token, err, "")
+}
+
+// userIDFromToken проверяет результат парсинга JWT и извлекает user ID из subject.
+// audience пуст для access token: токены с audience (challenge tokens)
+// не должны приниматься как access token, и наоборот
+func userIDFromToken(token *jwt.Token, err error, audience string) (uuid.UUID, error) {
 	if err != nil {
 		return uuid.Nil, fmt.Errorf("ошибка парсинга токена: %w", err)
 	}
@@ -88,19 +115,23 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 		return uuid.Nil, fmt.Errorf("невалидный токен")
 	}
 
-	// Извлекаем claims
-	claims, ok := token.Claims.(*jwt.RegisteredClaims)
-	if !ok {
-		return uuid.Nil, fmt.Errorf("неверный формат claims")
-	}
-
 	// Проверяем issuer
-	if claims.Issuer != "chirpy" {
+	if issuer, _ := token.Claims.GetIssuer(); issuer != "chirpy" {
 		return uuid.Nil, fmt.Errorf("неверный issuer")
 	}
 
+	// Проверяем назначение токена
+	tokenAudience, _ := token.Claims.GetAudience()
+	if audience == "" && len(tokenAudience) > 0 {
+		return uuid.Nil, fmt.Errorf("токен не является access token")
+	}
+	if audience != "" && !slices.Contains(tokenAudience, audience) {
+		return uuid.Nil, fmt.Errorf("неверный audience")
+	}
+
 	// Извлекаем user ID из subject
-	userID, err := uuid.Parse(claims.Subject)
+	subject, _ := token.Claims.GetSubject()
+	userID, err := uuid.Parse(subject)
 	if err != nil {
 		return uuid.Nil, fmt.Errorf("неверный формат user ID: %w", err)
 	}
@@ -50,6 +50,27 @@ func TestCheckPasswordHash(t *testing.T) {
 	}
 }
 
+func TestHashToken(t *testing.T) {
+	token := "f0e4c2f76c58916ec258f246851bea091d14d4247a2fc3e18694461b1816e13b"
+
+	hash := HashToken(token)
+	if len(hash) != 64 {
+		t.Errorf("HashToken returned hash of wrong length: got %d, want 64", len(hash))
+	}
+
+	if hash == token {
+		t.Error("HashToken should not return the token itself")
+	}
+
+	if HashToken(token) != hash {
+		t.Error("HashToken should be deterministic")
+	}
+
+	if HashToken(token+"0") == hash {
+		t.Error("HashToken returned same hash for different tokens")
+	}
+}
+
 func TestMakeJWT(t *testing.T) {
 	userID := uuid.New()
 	tokenSecret := "test-secret"
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// breachedPrefixLength - длина префикса SHA-1 (hex) для поиска по диапазону,
+// как в range API Have I Been Pwned
+const breachedPrefixLength = 5
+
+// BreachedPasswordSource - источник утекших паролей с поиском по k-анонимности:
+// по первым 5 hex символам SHA-1 возвращает суффиксы всех хешей диапазона.
+// Сам пароль и его полный хеш источнику не передаются
+type BreachedPasswordSource interface {
+	Range(ctx context.Context, prefix string) ([]string, error)
+}
+
+// IsBreachedPassword проверяет, встречается ли пароль в источнике
+func IsBreachedPassword(ctx context.Context, source BreachedPasswordSource, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes, err := source.Range(ctx, hash[:breachedPrefixLength])
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(suffixes, hash[breachedPrefixLength:]), nil
+}
+
+// BreachedPasswordCorpus - локальный корпус утекших паролей в памяти
+type BreachedPasswordCorpus struct {
+	ranges map[string][]string
+}
+
+// LoadBreachedPasswords читает корпус построчно. Строка - SHA-1 пароля в hex
+// (формат выгрузки HIBP, счетчик после ":" игнорируется) или сам пароль в
+// открытом виде (удобно для списков популярных паролей). Пустые строки и
+// строки, начинающиеся с "#", пропускаются
+func LoadBreachedPasswords(r io.Reader) (*BreachedPasswordCorpus, error) {
+	corpus := &BreachedPasswordCorpus{ranges: make(map[string][]string)}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		hash, _, _ := strings.Cut(line, ":")
+		if !isSHA1Hex(hash) {
+			sum := sha1.Sum([]byte(line))
+			hash = hex.EncodeToString(sum[:])
+		}
+		hash = strings.ToUpper(hash)
+
+		prefix := hash[:breachedPrefixLength]
+		corpus.ranges[prefix] = append(corpus.ranges[prefix], hash[breachedPrefixLength:])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка чтения корпуса утекших паролей: %w", err)
+	}
+
+	return corpus, nil
+}
+
+// LoadBreachedPasswordsFile загружает корпус из файла (см. LoadBreachedPasswords)
+func LoadBreachedPasswordsFile(path string) (*BreachedPasswordCorpus, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия корпуса утекших паролей: %w", err)
+	}
+	defer f.Close()
+
+	return LoadBreachedPasswords(f)
+}
+
+// Range возвращает суффиксы хешей с заданным префиксом
+func (c *BreachedPasswordCorpus) Range(ctx context.Context, prefix string) ([]string, error) {
+	return c.ranges[strings.ToUpper(prefix)], nil
+}
+
+// Len возвращает число хешей в корпусе
+func (c *BreachedPasswordCorpus) Len() int {
+	n := 0
+	for _, suffixes := range c.ranges {
+		n += len(suffixes)
+	}
+	return n
+}
+
+func isSHA1Hex(s string) bool {
+	if len(s) != 2*sha1.Size {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// CSRFHeader - заголовок, в котором браузерный клиент повторяет CSRF токен
+// из cookie при изменяющих запросах
+const CSRFHeader = "X-CSRF-Token"
+
+// MakeCSRFToken создает CSRF токен сессии на cookie. В access token
+// сохраняется только его хеш (Principal.CSRFHash)
+func MakeCSRFToken() (string, error) {
+	return MakeOneTimeToken()
+}
+
+// CheckCSRFToken сравнивает CSRF токен из заголовка с хешем из access token
+// за постоянное время
+func CheckCSRFToken(token, tokenHash string) bool {
+	if token == "" || tokenHash == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(HashToken(token)), []byte(tokenHash)) == 1
+}
+
+// IsSafeMethod сообщает, что метод не изменяет состояние (RFC 9110 9.2.1)
+// и не требует CSRF токена
+func IsSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCheckCSRFToken(t *testing.T) {
+	token, err := MakeCSRFToken()
+	if err != nil {
+		t.Fatalf("MakeCSRFToken failed: %v", err)
+	}
+	hash := HashToken(token)
+
+	if !CheckCSRFToken(token, hash) {
+		t.Error("valid CSRF token rejected")
+	}
+	if CheckCSRFToken(token+"x", hash) {
+		t.Error("wrong CSRF token accepted")
+	}
+	if CheckCSRFToken("", hash) || CheckCSRFToken(token, "") {
+		t.Error("empty CSRF token or hash accepted")
+	}
+}
+
+func TestKeySet_MakeAccessToken_CSRF(t *testing.T) {
+	keys := NewHMACKeySet("test-secret", time.Hour)
+	hash := HashToken("csrf-token")
+
+	token, err := keys.MakeAccessToken(Principal{UserID: uuid.New(), Role: RoleUser, CSRFHash: hash}, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeAccessToken failed: %v", err)
+	}
+	p, err := keys.ParseAccessToken(token)
+	if err != nil {
+		t.Fatalf("ParseAccessToken failed: %v", err)
+	}
+	if p.CSRFHash != hash {
+		t.Errorf("CSRFHash = %q, want %q", p.CSRFHash, hash)
+	}
+}
@@ -0,0 +1,781 @@
+package auth
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Поддерживаемые алгоритмы подписи JWT
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// legacyKeyID - kid HMAC ключа из JWT_SECRET
+const legacyKeyID = "hs256"
+
+const (
+	// JWKSCacheTTL - сколько клиенты могут кешировать JWKS (Cache-Control)
+	JWKSCacheTTL = 5 * time.Minute
+	// keySyncInterval - как часто экземпляр сервера перечитывает ключи из хранилища
+	keySyncInterval = time.Minute
+	// KeyPublishDelay - сколько новый ключ публикуется в JWKS до начала подписи:
+	// за это время его подхватят все экземпляры сервера и истекут кеши JWKS
+	KeyPublishDelay = JWKSCacheTTL + keySyncInterval
+)
+
+// SigningKey - ключ подписи JWT, идентифицируемый по kid
+type SigningKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	CreatedAt time.Time
+	// ActivatesAt - с какого момента ключ подписывает токены. До этого он
+	// только опубликован в JWKS и проверяет токены
+	ActivatesAt time.Time
+	// RetiredAt - момент вывода ключа из подписи (нулевой, пока ключ текущий)
+	RetiredAt time.Time
+
+	private interface{} // []byte, *rsa.PrivateKey или ed25519.PrivateKey
+	public  interface{} // []byte, *rsa.PublicKey или ed25519.PublicKey
+}
+
+// NewHMACKey создает симметричный ключ HS256. Такие ключи не публикуются в JWKS
+func NewHMACKey(id string, secret []byte) *SigningKey {
+	return &SigningKey{
+		ID:        id,
+		Method:    jwt.SigningMethodHS256,
+		CreatedAt: time.Now().UTC(),
+		private:   secret,
+		public:    secret,
+	}
+}
+
+// NewRSAKey создает ключ RS256, kid - JWK thumbprint (RFC 7638)
+func NewRSAKey(key *rsa.PrivateKey) *SigningKey {
+	k := &SigningKey{
+		Method:    jwt.SigningMethodRS256,
+		CreatedAt: time.Now().UTC(),
+		private:   key,
+		public:    &key.PublicKey,
+	}
+	k.ID = k.thumbprint()
+	return k
+}
+
+// NewEd25519Key создает ключ EdDSA, kid - JWK thumbprint (RFC 7638)
+func NewEd25519Key(key ed25519.PrivateKey) *SigningKey {
+	k := &SigningKey{
+		Method:    jwt.SigningMethodEdDSA,
+		CreatedAt: time.Now().UTC(),
+		private:   key,
+		public:    key.Public(),
+	}
+	k.ID = k.thumbprint()
+	return k
+}
+
+// GenerateKey создает новый асимметричный ключ для алгоритма RS256 или EdDSA
+func GenerateKey(alg string) (*SigningKey, error) {
+	switch alg {
+	case AlgRS256:
+		// Production: 2048 бит - минимально рекомендуемый размер RSA ключа
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка генерации RSA ключа: %w", err)
+		}
+		return NewRSAKey(key), nil
+	case AlgEdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка генерации Ed25519 ключа: %w", err)
+		}
+		return NewEd25519Key(key), nil
+	default:
+		return nil, fmt.Errorf("неподдерживаемый алгоритм ключа: %s", alg)
+	}
+}
+
+// ParsePrivateKeyPEM разбирает приватный ключ RSA или Ed25519 в формате PKCS#8 PEM
+func ParsePrivateKeyPEM(data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("PEM блок не найден")
+	}
+
+	return parsePrivateKeyDER(block.Bytes)
+}
+
+// parsePrivateKeyDER разбирает приватный ключ RSA или Ed25519 в формате PKCS#8 DER
+func parsePrivateKeyDER(der []byte) (*SigningKey, error) {
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка разбора PKCS#8 ключа: %w", err)
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		return NewRSAKey(key), nil
+	case ed25519.PrivateKey:
+		return NewEd25519Key(key), nil
+	default:
+		return nil, fmt.Errorf("неподдерживаемый тип ключа: %T", parsed)
+	}
+}
+
+// sealingKey - ключ шифрования приватных ключей в хранилище, производный от
+// secret (JWT_KEY_ENCRYPTION_SECRET, а не JWT_SECRET: утечка секрета HS256 не
+// должна раскрывать асимметричные ключи)
+func sealingKey(secret string) []byte {
+	sum := sha256.Sum256([]byte("chirpy:jwt-signing-keys:" + secret))
+	return sum[:]
+}
+
+// SealPrivateKey шифрует приватный ключ (PKCS#8) для общего хранилища:
+// AES-256-GCM с ключом, производным от secret. kid ключа
+// аутентифицируется вместе с ним
+func SealPrivateKey(key *SigningKey, secret string) ([]byte, error) {
+	if _, ok := key.private.([]byte); ok {
+		return nil, fmt.Errorf("симметричные ключи не сохраняются в хранилище")
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key.private)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка кодирования PKCS#8 ключа: %w", err)
+	}
+
+	gcm, err := newKeyCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("ошибка генерации nonce: %w", err)
+	}
+
+	return gcm.Seal(nonce, nonce, der, []byte(key.ID)), nil
+}
+
+// OpenPrivateKey расшифровывает ключ id, сохраненный SealPrivateKey
+func OpenPrivateKey(id string, sealed []byte, secret string) (*SigningKey, error) {
+	gcm, err := newKeyCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("поврежденный ключ подписи: kid %s", id)
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+
+	der, err := gcm.Open(nil, nonce, ciphertext, []byte(id))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка расшифровки ключа подписи %s (другой JWT_KEY_ENCRYPTION_SECRET?): %w", id, err)
+	}
+
+	key, err := parsePrivateKeyDER(der)
+	if err != nil {
+		return nil, err
+	}
+	if key.ID != id {
+		return nil, fmt.Errorf("kid ключа подписи не совпадает: %s != %s", key.ID, id)
+	}
+
+	return key, nil
+}
+
+// newKeyCipher создает AES-256-GCM для шифрования ключей в хранилище
+func newKeyCipher(secret string) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(sealingKey(secret))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// JWK - публичный ключ в формате JSON Web Key (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// OKP (Ed25519)
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS - набор публичных ключей для /.well-known/jwks.json
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// jwk возвращает публичную часть ключа. ok=false для симметричных ключей
+func (k *SigningKey) jwk() (JWK, bool) {
+	switch pub := k.public.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			Kid: k.ID,
+			Use: "sig",
+			Alg: AlgRS256,
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}, true
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Kid: k.ID,
+			Use: "sig",
+			Alg: AlgEdDSA,
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(pub),
+		}, true
+	default:
+		return JWK{}, false
+	}
+}
+
+// PublicKey разбирает публичный ключ JWK (RSA или Ed25519) для проверки
+// подписи: *rsa.PublicKey или ed25519.PublicKey
+func (j JWK) PublicKey() (interface{}, error) {
+	switch j.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(j.N)
+		if err != nil {
+			return nil, fmt.Errorf("неверный модуль RSA ключа %s: %w", j.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(j.E)
+		if err != nil {
+			return nil, fmt.Errorf("неверная экспонента RSA ключа %s: %w", j.Kid, err)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("неверная экспонента RSA ключа %s", j.Kid)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "OKP":
+		if j.Crv != "Ed25519" {
+			return nil, fmt.Errorf("неподдерживаемая кривая ключа %s: %s", j.Kid, j.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("неверный Ed25519 ключ %s", j.Kid)
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("неподдерживаемый тип ключа %s: %s", j.Kid, j.Kty)
+	}
+}
+
+// thumbprint вычисляет JWK thumbprint (RFC 7638): SHA-256 от канонического JSON
+// с обязательными полями ключа в лексикографическом порядке
+func (k *SigningKey) thumbprint() string {
+	jwk, _ := k.jwk()
+
+	var canonical []byte
+	switch jwk.Kty {
+	case "RSA":
+		canonical, _ = json.Marshal(struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N})
+	case "OKP":
+		canonical, _ = json.Marshal(struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X})
+	}
+
+	sum := sha256.Sum256(canonical)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// KeySet хранит текущий ключ подписи, опубликованные следующие ключи и
+// выведенные из обращения ключи, которые продолжают проверять токены до
+// истечения их срока жизни
+type KeySet struct {
+	mu      sync.RWMutex
+	current *SigningKey
+	keys    map[string]*SigningKey
+	// legacy - HMAC ключ из JWT_SECRET для токенов без kid, выпущенных до KeySet
+	legacy *SigningKey
+	// maxTokenTTL - максимальный срок жизни токена. Выведенный ключ удаляется
+	// через maxTokenTTL после RetiredAt, когда подписанных им токенов уже нет
+	maxTokenTTL time.Duration
+	// nextActivation - время активации ближайшего опубликованного ключа
+	// (нулевое, если такого нет)
+	nextActivation time.Time
+}
+
+// KeyStore - общее для всех экземпляров сервера хранилище ключей подписи
+// (например, таблица в БД). Без него каждый экземпляр подписывал бы токены
+// своим ключом, который другие экземпляры не знают
+type KeyStore interface {
+	// LoadKeys возвращает все сохраненные ключи
+	LoadKeys(ctx context.Context) ([]*SigningKey, error)
+	// SaveKey сохраняет новый ключ
+	SaveKey(ctx context.Context, key *SigningKey) error
+	// DeleteKey удаляет ключ, все токены которого истекли
+	DeleteKey(ctx context.Context, id string) error
+	// LegacyCutover возвращает момент перехода с HS256 (JWT_SECRET) на
+	// асимметричные ключи: при первом вызове сохраняет now, далее - его
+	LegacyCutover(ctx context.Context, now time.Time) (time.Time, error)
+}
+
+// NewKeySet создает набор ключей с текущим ключом подписи
+func NewKeySet(current *SigningKey, maxTokenTTL time.Duration) *KeySet {
+	if current.ActivatesAt.IsZero() {
+		current.ActivatesAt = current.CreatedAt
+	}
+	return &KeySet{
+		current:     current,
+		keys:        map[string]*SigningKey{current.ID: current},
+		maxTokenTTL: maxTokenTTL,
+	}
+}
+
+// NewHMACKeySet создает набор из единственного HS256 ключа на основе JWT_SECRET
+func NewHMACKeySet(secret string, maxTokenTTL time.Duration) *KeySet {
+	ks := NewKeySet(NewHMACKey(legacyKeyID, []byte(secret)), maxTokenTTL)
+	ks.legacy = ks.current
+	return ks
+}
+
+// NewStoredKeySet создает набор из ключей общего хранилища store. При первом
+// запуске (хранилище пустое) создает и сохраняет ключ алгоритма alg, который
+// подписывает токены сразу: опубликованных ранее ключей еще нет
+func NewStoredKeySet(ctx context.Context, store KeyStore, alg string, maxTokenTTL time.Duration) (*KeySet, error) {
+	keys, err := store.LoadKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		key, err := GenerateKey(alg)
+		if err != nil {
+			return nil, err
+		}
+		key.ActivatesAt = key.CreatedAt
+		if err := store.SaveKey(ctx, key); err != nil {
+			return nil, err
+		}
+		log.Printf("🔑 Создан первый ключ подписи JWT: kid %s", key.ID)
+
+		// Перечитываем: параллельно стартовавший экземпляр мог сохранить свой ключ
+		keys, err = store.LoadKeys(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ks := &KeySet{keys: map[string]*SigningKey{}, maxTokenTTL: maxTokenTTL}
+	ks.replaceKeys(keys, time.Now().UTC())
+	if ks.current == nil {
+		return nil, fmt.Errorf("в хранилище нет действующего ключа подписи")
+	}
+
+	return ks, nil
+}
+
+// AcceptLegacyHMAC разрешает проверку токенов без kid, подписанных JWT_SECRET
+// (выпущенных до перехода на асимметричные ключи). cutover - сохраненный один
+// раз момент перехода (KeyStore.LegacyCutover): принимаются только токены,
+// выпущенные не позже него, и только maxTokenTTL после него. Иначе владелец
+// JWT_SECRET мог бы выпускать токены без kid после каждого перезапуска
+func (ks *KeySet) AcceptLegacyHMAC(secret string, cutover time.Time) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	ks.legacy = NewHMACKey(legacyKeyID, []byte(secret))
+	ks.legacy.RetiredAt = cutover
+}
+
+// Rotate публикует next в JWKS и делает его ключом подписи через
+// KeyPublishDelay (см. Activate): к этому моменту закешированные копии JWKS
+// уже содержат next. Текущий ключ подписывает токены до активации next
+func (ks *KeySet) Rotate(next *SigningKey) {
+	next.ActivatesAt = time.Now().UTC().Add(KeyPublishDelay)
+	ks.publish(next)
+}
+
+// publish добавляет ключ в набор: он сразу проверяет токены и виден в JWKS
+func (ks *KeySet) publish(next *SigningKey) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	ks.keys[next.ID] = next
+	if ks.nextActivation.IsZero() || next.ActivatesAt.Before(ks.nextActivation) {
+		ks.nextActivation = next.ActivatesAt
+	}
+
+	log.Printf("🔑 Опубликован следующий ключ подписи JWT: kid %s, подпись с %s",
+		next.ID, next.ActivatesAt.Format(time.RFC3339))
+}
+
+// Activate делает ключом подписи последний ключ, время активации которого
+// наступило. Предыдущие ключи выводятся и проверяют токены еще maxTokenTTL
+func (ks *KeySet) Activate(now time.Time) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	ks.activateLocked(now)
+}
+
+func (ks *KeySet) activateLocked(now time.Time) {
+	ks.nextActivation = time.Time{}
+	active := make([]*SigningKey, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		if !key.ActivatesAt.After(now) {
+			active = append(active, key)
+		} else if ks.nextActivation.IsZero() || key.ActivatesAt.Before(ks.nextActivation) {
+			ks.nextActivation = key.ActivatesAt
+		}
+	}
+	if len(active) == 0 {
+		return
+	}
+
+	// Одинаковый порядок на всех экземплярах: при равном времени - по kid
+	sort.Slice(active, func(i, j int) bool {
+		if !active[i].ActivatesAt.Equal(active[j].ActivatesAt) {
+			return active[i].ActivatesAt.Before(active[j].ActivatesAt)
+		}
+		return active[i].ID < active[j].ID
+	})
+
+	for i, key := range active[:len(active)-1] {
+		key.RetiredAt = active[i+1].ActivatesAt
+	}
+
+	current := active[len(active)-1]
+	current.RetiredAt = time.Time{}
+	if current != ks.current {
+		if ks.current != nil {
+			log.Printf("🔑 Ротация ключа подписи JWT: новый kid %s", current.ID)
+		}
+		ks.current = current
+	}
+}
+
+// replaceKeys заменяет ключи набора загруженными из хранилища
+func (ks *KeySet) replaceKeys(keys []*SigningKey, now time.Time) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	previous := ks.current
+	ks.keys = make(map[string]*SigningKey, len(keys))
+	for _, key := range keys {
+		ks.keys[key.ID] = key
+	}
+	ks.current = nil
+	ks.activateLocked(now)
+
+	// В хранилище только ключи, ожидающие активации: продолжаем подписывать прежним
+	if ks.current == nil && previous != nil {
+		ks.current = previous
+		ks.keys[previous.ID] = previous
+	}
+}
+
+// Prune удаляет выведенные ключи, все токены которых уже истекли, и
+// возвращает их kid
+func (ks *KeySet) Prune(now time.Time) []string {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	var pruned []string
+	for id, key := range ks.keys {
+		if !key.RetiredAt.IsZero() && now.After(key.RetiredAt.Add(ks.maxTokenTTL)) {
+			delete(ks.keys, id)
+			pruned = append(pruned, id)
+			log.Printf("🔑 Удален выведенный ключ подписи JWT: kid %s", id)
+		}
+	}
+	return pruned
+}
+
+// StartRotation раз в keySyncInterval синхронизирует ключи с общим
+// хранилищем store: подхватывает ключи других экземпляров сервера, при
+// interval > 0 публикует следующий ключ алгоритма alg, когда последнему
+// больше interval, и удаляет ключи, все токены которых истекли.
+// Останавливается при отмене ctx
+func (ks *KeySet) StartRotation(ctx context.Context, store KeyStore, alg string, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(keySyncInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				if err := ks.syncAndRotate(ctx, store, alg, interval, now.UTC()); err != nil {
+					log.Printf("❌ Ошибка ротации ключа подписи JWT: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// syncAndRotate - один шаг StartRotation
+func (ks *KeySet) syncAndRotate(ctx context.Context, store KeyStore, alg string, interval time.Duration, now time.Time) error {
+	keys, err := store.LoadKeys(ctx)
+	if err != nil {
+		return err
+	}
+	if len(keys) > 0 {
+		ks.replaceKeys(keys, now)
+	}
+
+	// Следующий ключ создается, только если опубликованного еще нет: последний
+	// ключ (и текущий, и ожидающий активации) старше interval
+	if interval > 0 && now.Sub(ks.newestActivation()) >= interval {
+		next, err := GenerateKey(alg)
+		if err != nil {
+			return err
+		}
+		next.ActivatesAt = now.Add(KeyPublishDelay)
+		if err := store.SaveKey(ctx, next); err != nil {
+			return err
+		}
+		ks.publish(next)
+	}
+
+	for _, id := range ks.Prune(now) {
+		if err := store.DeleteKey(ctx, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newestActivation возвращает время активации самого нового ключа
+func (ks *KeySet) newestActivation() time.Time {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	var newest time.Time
+	for _, key := range ks.keys {
+		if key.ActivatesAt.After(newest) {
+			newest = key.ActivatesAt
+		}
+	}
+	return newest
+}
+
+// MakeAccessToken создает access token пользователя с ролью, scopes роли,
+// сессией и версией токенов, подписанный текущим ключом. Для входа в Chirpy
+// p.Scopes не используется: scopes вычисляются по роли. Токен OAuth клиента
+// (p.ClientID) получает только согласованные p.Scopes, которые есть у роли.
+// Токен для cookie содержит хеш CSRF токена сессии (p.CSRFHash)
+func (ks *KeySet) MakeAccessToken(p Principal, expiresIn time.Duration) (string, error) {
+	if expiresIn > ks.maxTokenTTL {
+		return "", fmt.Errorf("срок жизни токена превышает максимальный %v", ks.maxTokenTTL)
+	}
+
+	scopes := ScopesForRole(p.Role)
+	if p.ClientID != "" {
+		scopes = GrantedScopes(p.Role, p.Scopes)
+	}
+
+	claims := &Claims{
+		RegisteredClaims: newClaims(p.UserID, expiresIn),
+		Role:             p.Role,
+		Scope:            strings.Join(scopes, " "),
+		TokenVersion:     p.TokenVersion,
+		ClientID:         p.ClientID,
+		CSRF:             p.CSRFHash,
+	}
+	if p.SessionID != uuid.Nil {
+		claims.SessionID = p.SessionID.String()
+	}
+
+	return ks.sign(claims)
+}
+
+// AudienceSudo - audience токена режима sudo: выдается после повторного ввода
+// пароля и разрешает изменения аккаунта без пароля в течение нескольких минут
+const AudienceSudo = "chirpy:sudo"
+
+// MakeChallengeToken создает короткоживущий токен промежуточного шага
+// (например, ожидание второго фактора при входе). Токен помечается audience
+// и не принимается как access token
+func (ks *KeySet) MakeChallengeToken(userID uuid.UUID, audience string, expiresIn time.Duration) (string, error) {
+	if expiresIn > ks.maxTokenTTL {
+		return "", fmt.Errorf("срок жизни токена превышает максимальный %v", ks.maxTokenTTL)
+	}
+
+	claims := newClaims(userID, expiresIn)
+	claims.Audience = jwt.ClaimStrings{audience}
+
+	return ks.sign(claims)
+}
+
+// ParseChallengeToken проверяет токен промежуточного шага с указанным audience
+// и возвращает ID пользователя
+func (ks *KeySet) ParseChallengeToken(tokenString, audience string) (uuid.UUID, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, ks.keyFunc)
+	return userIDFromToken(token, err, audience)
+}
+
+// MakeSudoToken создает sudo токен, привязанный к сессии p.SessionID и версии
+// токенов p.TokenVersion: после выхода из сессии или смены пароля он не действует
+func (ks *KeySet) MakeSudoToken(p Principal, expiresIn time.Duration) (string, error) {
+	if expiresIn > ks.maxTokenTTL {
+		return "", fmt.Errorf("срок жизни токена превышает максимальный %v", ks.maxTokenTTL)
+	}
+
+	claims := &Claims{
+		RegisteredClaims: newClaims(p.UserID, expiresIn),
+		TokenVersion:     p.TokenVersion,
+	}
+	claims.Audience = jwt.ClaimStrings{AudienceSudo}
+	if p.SessionID != uuid.Nil {
+		claims.SessionID = p.SessionID.String()
+	}
+
+	return ks.sign(claims)
+}
+
+// ParseSudoToken проверяет sudo токен и возвращает пользователя, сессию и
+// версию токенов, к которым он привязан
+func (ks *KeySet) ParseSudoToken(tokenString string) (Principal, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, ks.keyFunc)
+
+	userID, err := userIDFromToken(token, err, AudienceSudo)
+	if err != nil {
+		return Principal{}, err
+	}
+
+	sessionID, _ := uuid.Parse(claims.SessionID)
+	return Principal{UserID: userID, SessionID: sessionID, TokenVersion: claims.TokenVersion}, nil
+}
+
+// sign подписывает claims текущим ключом и указывает его kid в заголовке
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	ks.mu.RLock()
+	key, due := ks.current, ks.nextActivation
+	ks.mu.RUnlock()
+
+	// Наступило время активации опубликованного ключа: подписываем уже им, не
+	// дожидаясь синхронизации, иначе выведенный ключ подписывал бы токены дольше RetiredAt
+	if now := time.Now().UTC(); !due.IsZero() && !now.Before(due) {
+		ks.Activate(now)
+		ks.mu.RLock()
+		key = ks.current
+		ks.mu.RUnlock()
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+
+	signedToken, err := token.SignedString(key.private)
+	if err != nil {
+		return "", fmt.Errorf("ошибка подписи токена: %w", err)
+	}
+
+	return signedToken, nil
+}
+
+// ParseAccessToken проверяет access token ключом, указанным в kid,
+// и возвращает аутентифицированного пользователя
+func (ks *KeySet) ParseAccessToken(tokenString string) (Principal, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, ks.keyFunc)
+
+	userID, err := userIDFromToken(token, err, "")
+	if err != nil {
+		return Principal{}, err
+	}
+
+	return principalFromClaims(userID, claims), nil
+}
+
+// keyFunc выбирает ключ проверки по kid и сверяет алгоритм токена с алгоритмом ключа
+func (ks *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	var key *SigningKey
+	if kid, ok := token.Header["kid"].(string); ok {
+		key = ks.keys[kid]
+	} else {
+		key = ks.legacy
+	}
+
+	if key == nil {
+		return nil, fmt.Errorf("неизвестный ключ подписи: %v", token.Header["kid"])
+	}
+
+	// 🔐 Выведенным legacy ключом подписаны только токены до перехода: токен
+	// без kid, выпущенный позже, подделан владельцем JWT_SECRET
+	if key == ks.legacy && !key.RetiredAt.IsZero() {
+		issuedAt, err := token.Claims.GetIssuedAt()
+		if err != nil || issuedAt == nil || issuedAt.After(key.RetiredAt) {
+			return nil, fmt.Errorf("токен без kid выпущен после перехода на новые ключи")
+		}
+	}
+
+	// Выведенный ключ, все токены которого уже должны были истечь (еще не удален Prune)
+	if !key.RetiredAt.IsZero() && time.Now().After(key.RetiredAt.Add(ks.maxTokenTTL)) {
+		return nil, fmt.Errorf("ключ подписи выведен из обращения: %s", key.ID)
+	}
+
+	// Production: защита от подмены алгоритма (например, RS256 -> HS256 с публичным ключом)
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("неожиданный метод подписи: %v", token.Header["alg"])
+	}
+
+	return key.public, nil
+}
+
+// JWKS возвращает публичные ключи для проверки токенов сторонними сервисами
+func (ks *KeySet) JWKS() JWKS {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	keys := make([]*SigningKey, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		keys = append(keys, key)
+	}
+	// Новые ключи первыми - стабильный порядок для кеширования
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+
+	jwks := JWKS{Keys: make([]JWK, 0, len(keys))}
+	for _, key := range keys {
+		if jwk, ok := key.jwk(); ok {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+
+	return jwks
+}
@@ -0,0 +1,489 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestKeySet_MakeAndValidate(t *testing.T) {
+	for _, alg := range []string{AlgRS256, AlgEdDSA} {
+		key, err := GenerateKey(alg)
+		if err != nil {
+			t.Fatalf("GenerateKey(%s) failed: %v", alg, err)
+		}
+
+		keys := NewKeySet(key, time.Hour)
+		userID := uuid.New()
+		sessionID := uuid.New()
+
+		token, err := keys.MakeAccessToken(Principal{UserID: userID, Role: RoleModerator, SessionID: sessionID}, time.Hour)
+		if err != nil {
+			t.Fatalf("MakeAccessToken(%s) failed: %v", alg, err)
+		}
+
+		principal, err := keys.ParseAccessToken(token)
+		if err != nil {
+			t.Fatalf("ParseAccessToken(%s) failed for valid token: %v", alg, err)
+		}
+
+		if principal.UserID != userID {
+			t.Errorf("ParseAccessToken(%s) returned wrong user ID: got %v, want %v", alg, principal.UserID, userID)
+		}
+
+		if principal.Role != RoleModerator || !principal.HasScope(ScopeChirpsModerate) || principal.HasScope(ScopeAdmin) {
+			t.Errorf("ParseAccessToken(%s) returned wrong role or scopes: %+v", alg, principal)
+		}
+
+		if principal.SessionID != sessionID {
+			t.Errorf("ParseAccessToken(%s) returned wrong session ID: got %v, want %v", alg, principal.SessionID, sessionID)
+		}
+	}
+}
+
+func TestKeySet_MakeAccessToken_TooLong(t *testing.T) {
+	keys := NewHMACKeySet("test-secret", time.Hour)
+
+	_, err := keys.MakeAccessToken(Principal{UserID: uuid.New(), Role: RoleUser}, 2*time.Hour)
+	if err == nil {
+		t.Error("MakeAccessToken should fail when expiresIn exceeds max token TTL")
+	}
+}
+
+func TestKeySet_ChallengeToken(t *testing.T) {
+	keys := NewHMACKeySet("test-secret", time.Hour)
+	userID := uuid.New()
+
+	challenge, err := keys.MakeChallengeToken(userID, AudienceMFA, 5*time.Minute)
+	if err != nil {
+		t.Fatalf("MakeChallengeToken failed: %v", err)
+	}
+
+	gotID, err := keys.ParseChallengeToken(challenge, AudienceMFA)
+	if err != nil {
+		t.Fatalf("ParseChallengeToken failed for valid token: %v", err)
+	}
+	if gotID != userID {
+		t.Errorf("ParseChallengeToken returned wrong user ID: got %v, want %v", gotID, userID)
+	}
+
+	// Challenge token не должен работать как access token
+	if _, err := keys.ParseAccessToken(challenge); err == nil {
+		t.Error("ParseAccessToken should reject challenge token")
+	}
+	if _, err := ValidateJWT(challenge, "test-secret"); err == nil {
+		t.Error("ValidateJWT should reject challenge token")
+	}
+
+	// И наоборот: access token не проходит как challenge token
+	access, err := keys.MakeAccessToken(Principal{UserID: userID, Role: RoleUser}, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeAccessToken failed: %v", err)
+	}
+	if _, err := keys.ParseChallengeToken(access, AudienceMFA); err == nil {
+		t.Error("ParseChallengeToken should reject access token")
+	}
+
+	// MFA токен не подходит как sudo токен
+	if _, err := keys.ParseChallengeToken(challenge, AudienceSudo); err == nil {
+		t.Error("ParseChallengeToken should reject token with another audience")
+	}
+}
+
+func TestKeySet_SudoToken(t *testing.T) {
+	keys := NewHMACKeySet("test-secret", time.Hour)
+	p := Principal{UserID: uuid.New(), SessionID: uuid.New(), TokenVersion: 3}
+
+	sudo, err := keys.MakeSudoToken(p, 10*time.Minute)
+	if err != nil {
+		t.Fatalf("MakeSudoToken failed: %v", err)
+	}
+
+	got, err := keys.ParseSudoToken(sudo)
+	if err != nil {
+		t.Fatalf("ParseSudoToken failed for valid token: %v", err)
+	}
+	if got.UserID != p.UserID || got.SessionID != p.SessionID || got.TokenVersion != p.TokenVersion {
+		t.Errorf("ParseSudoToken returned %+v, want user %v, session %v, version %d",
+			got, p.UserID, p.SessionID, p.TokenVersion)
+	}
+
+	// Sudo токен не работает как access token, а MFA токен - как sudo токен
+	if _, err := keys.ParseAccessToken(sudo); err == nil {
+		t.Error("ParseAccessToken should reject sudo token")
+	}
+	mfa, err := keys.MakeChallengeToken(p.UserID, AudienceMFA, 5*time.Minute)
+	if err != nil {
+		t.Fatalf("MakeChallengeToken failed: %v", err)
+	}
+	if _, err := keys.ParseSudoToken(mfa); err == nil {
+		t.Error("ParseSudoToken should reject MFA token")
+	}
+}
+
+// tokenKid возвращает kid из заголовка токена
+func tokenKid(t *testing.T, token string) string {
+	t.Helper()
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+	if err != nil {
+		t.Fatalf("ParseUnverified failed: %v", err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+func TestKeySet_Rotate(t *testing.T) {
+	oldKey, _ := GenerateKey(AlgEdDSA)
+	keys := NewKeySet(oldKey, time.Hour)
+
+	oldToken, err := keys.MakeAccessToken(Principal{UserID: uuid.New(), Role: RoleUser}, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeAccessToken failed: %v", err)
+	}
+
+	newKey, _ := GenerateKey(AlgEdDSA)
+	keys.Rotate(newKey)
+
+	// Следующий ключ сразу в JWKS, но подписывает только после KeyPublishDelay
+	if len(keys.JWKS().Keys) != 2 {
+		t.Errorf("JWKS should contain current and next keys, got %d", len(keys.JWKS().Keys))
+	}
+	token, err := keys.MakeAccessToken(Principal{UserID: uuid.New(), Role: RoleUser}, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeAccessToken failed: %v", err)
+	}
+	if kid := tokenKid(t, token); kid != oldKey.ID {
+		t.Errorf("token signed before activation should use current key %s, got %s", oldKey.ID, kid)
+	}
+
+	activatedAt := time.Now().Add(KeyPublishDelay)
+	keys.Activate(activatedAt)
+
+	token, err = keys.MakeAccessToken(Principal{UserID: uuid.New(), Role: RoleUser}, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeAccessToken failed: %v", err)
+	}
+	if kid := tokenKid(t, token); kid != newKey.ID {
+		t.Errorf("token signed after activation should use next key %s, got %s", newKey.ID, kid)
+	}
+
+	// Токен старого ключа продолжает проверяться после ротации
+	if _, err := keys.ParseAccessToken(oldToken); err != nil {
+		t.Errorf("ParseAccessToken should accept token of retired key: %v", err)
+	}
+
+	// Через maxTokenTTL после вывода ключ удаляется
+	pruned := keys.Prune(activatedAt.Add(2 * time.Hour))
+	if len(pruned) != 1 || pruned[0] != oldKey.ID {
+		t.Errorf("Prune should remove only the retired key, got %v", pruned)
+	}
+
+	if _, err := keys.ParseAccessToken(oldToken); err == nil {
+		t.Error("ParseAccessToken should fail for token of pruned key")
+	}
+
+	jwks := keys.JWKS()
+	if len(jwks.Keys) != 1 || jwks.Keys[0].Kid != newKey.ID {
+		t.Errorf("JWKS should contain only the new key, got %+v", jwks.Keys)
+	}
+}
+
+// memoryKeyStore - KeyStore в памяти, общий для нескольких KeySet в тесте
+type memoryKeyStore struct {
+	keys    map[string][]byte
+	meta    map[string]*SigningKey
+	cutover time.Time
+}
+
+func newMemoryKeyStore() *memoryKeyStore {
+	return &memoryKeyStore{keys: map[string][]byte{}, meta: map[string]*SigningKey{}}
+}
+
+func (s *memoryKeyStore) LoadKeys(ctx context.Context) ([]*SigningKey, error) {
+	keys := make([]*SigningKey, 0, len(s.keys))
+	for id, sealed := range s.keys {
+		key, err := OpenPrivateKey(id, sealed, "test-secret")
+		if err != nil {
+			return nil, err
+		}
+		key.CreatedAt = s.meta[id].CreatedAt
+		key.ActivatesAt = s.meta[id].ActivatesAt
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (s *memoryKeyStore) SaveKey(ctx context.Context, key *SigningKey) error {
+	sealed, err := SealPrivateKey(key, "test-secret")
+	if err != nil {
+		return err
+	}
+	s.keys[key.ID] = sealed
+	s.meta[key.ID] = &SigningKey{CreatedAt: key.CreatedAt, ActivatesAt: key.ActivatesAt}
+	return nil
+}
+
+func (s *memoryKeyStore) DeleteKey(ctx context.Context, id string) error {
+	delete(s.keys, id)
+	delete(s.meta, id)
+	return nil
+}
+
+func (s *memoryKeyStore) LegacyCutover(ctx context.Context, now time.Time) (time.Time, error) {
+	if s.cutover.IsZero() {
+		s.cutover = now
+	}
+	return s.cutover, nil
+}
+
+func TestKeySet_StoredRotation(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryKeyStore()
+
+	// Два экземпляра сервера с общим хранилищем подписывают одним ключом
+	first, err := NewStoredKeySet(ctx, store, AlgEdDSA, time.Hour)
+	if err != nil {
+		t.Fatalf("NewStoredKeySet failed: %v", err)
+	}
+	second, err := NewStoredKeySet(ctx, store, AlgEdDSA, time.Hour)
+	if err != nil {
+		t.Fatalf("NewStoredKeySet failed: %v", err)
+	}
+	if len(store.keys) != 1 {
+		t.Fatalf("store should contain one key, got %d", len(store.keys))
+	}
+
+	token, err := first.MakeAccessToken(Principal{UserID: uuid.New(), Role: RoleUser}, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeAccessToken failed: %v", err)
+	}
+	if _, err := second.ParseAccessToken(token); err != nil {
+		t.Errorf("second instance should accept token of first instance: %v", err)
+	}
+
+	// Первый экземпляр публикует следующий ключ, второй подхватывает его при синхронизации
+	now := time.Now().UTC().Add(25 * time.Hour)
+	if err := first.syncAndRotate(ctx, store, AlgEdDSA, 24*time.Hour, now); err != nil {
+		t.Fatalf("syncAndRotate failed: %v", err)
+	}
+	if err := second.syncAndRotate(ctx, store, AlgEdDSA, 24*time.Hour, now); err != nil {
+		t.Fatalf("syncAndRotate failed: %v", err)
+	}
+	if len(store.keys) != 2 {
+		t.Fatalf("only one next key should be created, store has %d", len(store.keys))
+	}
+	if len(second.JWKS().Keys) != 2 {
+		t.Errorf("second instance should publish the next key, got %d keys", len(second.JWKS().Keys))
+	}
+
+	// После KeyPublishDelay оба экземпляра подписывают новым ключом, а через
+	// maxTokenTTL старый ключ удаляется из хранилища
+	later := now.Add(KeyPublishDelay)
+	for _, ks := range []*KeySet{first, second} {
+		if err := ks.syncAndRotate(ctx, store, AlgEdDSA, 24*time.Hour, later); err != nil {
+			t.Fatalf("syncAndRotate failed: %v", err)
+		}
+	}
+	if first.current.ID != second.current.ID || first.current.ID == tokenKid(t, token) {
+		t.Errorf("both instances should sign with the next key, got %s and %s", first.current.ID, second.current.ID)
+	}
+
+	if err := first.syncAndRotate(ctx, store, AlgEdDSA, 24*time.Hour, later.Add(2*time.Hour)); err != nil {
+		t.Fatalf("syncAndRotate failed: %v", err)
+	}
+	if _, ok := store.keys[tokenKid(t, token)]; ok {
+		t.Error("retired key should be deleted from store after maxTokenTTL")
+	}
+}
+
+func TestSealPrivateKey(t *testing.T) {
+	key, _ := GenerateKey(AlgRS256)
+
+	sealed, err := SealPrivateKey(key, "test-secret")
+	if err != nil {
+		t.Fatalf("SealPrivateKey failed: %v", err)
+	}
+
+	opened, err := OpenPrivateKey(key.ID, sealed, "test-secret")
+	if err != nil {
+		t.Fatalf("OpenPrivateKey failed: %v", err)
+	}
+	if opened.ID != key.ID {
+		t.Errorf("OpenPrivateKey returned key %s, want %s", opened.ID, key.ID)
+	}
+
+	if _, err := OpenPrivateKey(key.ID, sealed, "other-secret"); err == nil {
+		t.Error("OpenPrivateKey should fail with another secret")
+	}
+	if _, err := OpenPrivateKey("other-kid", sealed, "test-secret"); err == nil {
+		t.Error("OpenPrivateKey should fail for another kid")
+	}
+	if _, err := SealPrivateKey(NewHMACKey("hs", []byte("secret")), "test-secret"); err == nil {
+		t.Error("SealPrivateKey should reject symmetric keys")
+	}
+}
+
+func TestKeySet_JWKS_OmitsHMAC(t *testing.T) {
+	keys := NewHMACKeySet("test-secret", time.Hour)
+
+	if len(keys.JWKS().Keys) != 0 {
+		t.Error("JWKS should not publish symmetric keys")
+	}
+}
+
+func TestJWK_PublicKey(t *testing.T) {
+	for _, alg := range []string{AlgRS256, AlgEdDSA} {
+		key, err := GenerateKey(alg)
+		if err != nil {
+			t.Fatalf("GenerateKey(%s) failed: %v", alg, err)
+		}
+		keys := NewKeySet(key, time.Hour)
+
+		token, err := keys.MakeAccessToken(Principal{UserID: uuid.New(), Role: RoleUser}, time.Hour)
+		if err != nil {
+			t.Fatalf("MakeAccessToken failed: %v", err)
+		}
+
+		// Токен проверяется ключом, восстановленным из JWKS
+		pub, err := keys.JWKS().Keys[0].PublicKey()
+		if err != nil {
+			t.Fatalf("PublicKey(%s) failed: %v", alg, err)
+		}
+		_, err = jwt.Parse(token, func(*jwt.Token) (interface{}, error) { return pub, nil })
+		if err != nil {
+			t.Errorf("%s token does not verify with JWK public key: %v", alg, err)
+		}
+	}
+
+	if _, err := (JWK{Kty: "EC", Crv: "P-256"}).PublicKey(); err == nil {
+		t.Error("PublicKey should reject unsupported key type")
+	}
+}
+
+func TestKeySet_LegacyHMAC(t *testing.T) {
+	// Токен, выпущенный до перехода на RS256 (без kid)
+	userID := uuid.New()
+	legacyToken, err := MakeJWT(userID, "test-secret", time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT failed: %v", err)
+	}
+
+	key, _ := GenerateKey(AlgRS256)
+	keys := NewKeySet(key, time.Hour)
+	keys.AcceptLegacyHMAC("test-secret", time.Now())
+
+	principal, err := keys.ParseAccessToken(legacyToken)
+	if err != nil {
+		t.Fatalf("ParseAccessToken should accept legacy HS256 token: %v", err)
+	}
+
+	if principal.UserID != userID {
+		t.Errorf("ParseAccessToken returned wrong user ID: got %v, want %v", principal.UserID, userID)
+	}
+
+	// Токены без роли получают права обычного пользователя
+	if principal.Role != RoleUser || !principal.HasScope(ScopeChirpsWrite) {
+		t.Errorf("ParseAccessToken returned wrong role or scopes for legacy token: %+v", principal)
+	}
+}
+
+func TestKeySet_LegacyHMACCutover(t *testing.T) {
+	store := newMemoryKeyStore()
+	cutover, _ := store.LegacyCutover(context.Background(), time.Now().Add(-time.Minute))
+
+	// Перезапуск не сдвигает сохраненный момент перехода
+	if again, _ := store.LegacyCutover(context.Background(), time.Now()); !again.Equal(cutover) {
+		t.Fatalf("LegacyCutover changed on second call: %v != %v", again, cutover)
+	}
+
+	key, _ := GenerateKey(AlgRS256)
+	keys := NewKeySet(key, time.Hour)
+	keys.AcceptLegacyHMAC("test-secret", cutover)
+
+	// Токен без kid, выпущенный владельцем JWT_SECRET после перехода
+	forged, err := MakeJWT(uuid.New(), "test-secret", time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT failed: %v", err)
+	}
+	if _, err := keys.ParseAccessToken(forged); err == nil {
+		t.Error("ParseAccessToken should reject legacy token issued after cutover")
+	}
+
+	// Токен без iat нельзя отнести к периоду до перехода
+	claims := newClaims(uuid.New(), time.Hour)
+	claims.IssuedAt = nil
+	noIAT, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	if _, err := keys.ParseAccessToken(noIAT); err == nil {
+		t.Error("ParseAccessToken should reject legacy token without iat")
+	}
+
+	// Через maxTokenTTL после перехода legacy токены не принимаются совсем
+	old := NewKeySet(key, time.Hour)
+	old.AcceptLegacyHMAC("test-secret", time.Now().Add(-2*time.Hour))
+	claims = newClaims(uuid.New(), time.Hour)
+	claims.IssuedAt = jwt.NewNumericDate(time.Now().Add(-3 * time.Hour))
+	stale, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	if _, err := old.ParseAccessToken(stale); err == nil {
+		t.Error("ParseAccessToken should reject legacy tokens maxTokenTTL after cutover")
+	}
+}
+
+func TestKeySet_AlgorithmConfusion(t *testing.T) {
+	key, _ := GenerateKey(AlgRS256)
+	keys := NewKeySet(key, time.Hour)
+
+	// HS256 токен с kid асимметричного ключа не должен проверяться
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, newClaims(uuid.New(), time.Hour))
+	token.Header["kid"] = key.ID
+	tokenString, err := token.SignedString([]byte("attacker-secret"))
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+
+	if _, err := keys.ParseAccessToken(tokenString); err == nil {
+		t.Error("ParseAccessToken should fail for token with mismatched algorithm")
+	}
+}
+
+func TestKeySet_UnknownKid(t *testing.T) {
+	key, _ := GenerateKey(AlgEdDSA)
+	otherKey, _ := GenerateKey(AlgEdDSA)
+
+	token, err := NewKeySet(otherKey, time.Hour).MakeAccessToken(Principal{UserID: uuid.New(), Role: RoleUser}, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeAccessToken failed: %v", err)
+	}
+
+	if _, err := NewKeySet(key, time.Hour).ParseAccessToken(token); err == nil {
+		t.Error("ParseAccessToken should fail for token signed with unknown key")
+	}
+}
+
+func TestParsePrivateKeyPEM(t *testing.T) {
+	key, _ := GenerateKey(AlgEdDSA)
+
+	der, err := x509.MarshalPKCS8PrivateKey(key.private)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey failed: %v", err)
+	}
+
+	parsed, err := ParsePrivateKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatalf("ParsePrivateKeyPEM failed: %v", err)
+	}
+
+	if parsed.ID != key.ID {
+		t.Errorf("ParsePrivateKeyPEM returned key with wrong kid: got %s, want %s", parsed.ID, key.ID)
+	}
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// LockoutPolicy задает экспоненциальную задержку после неудачных попыток входа:
+// первые FreeAttempts ошибок не блокируют, далее блокировка удваивается
+// с каждой ошибкой, начиная с BaseDelay, но не превышает MaxDelay
+type LockoutPolicy struct {
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	// ResetAfter - через сколько после последней ошибки счетчик обнуляется
+	ResetAfter time.Duration
+}
+
+// Политики блокировки по умолчанию. С одного IP могут входить многие
+// пользователи (NAT, офис), поэтому для IP бесплатных попыток больше
+var (
+	EmailLockoutPolicy = LockoutPolicy{FreeAttempts: 5, BaseDelay: 30 * time.Second, MaxDelay: time.Hour, ResetAfter: 24 * time.Hour}
+	IPLockoutPolicy    = LockoutPolicy{FreeAttempts: 20, BaseDelay: 30 * time.Second, MaxDelay: time.Hour, ResetAfter: 24 * time.Hour}
+)
+
+// Delay возвращает длительность блокировки после failures неудачных попыток
+// подряд (0 - блокировки нет)
+func (p LockoutPolicy) Delay(failures int) time.Duration {
+	if failures < p.FreeAttempts {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeAttempts; i < failures; i++ {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+
+	return min(delay, p.MaxDelay)
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// CheckDummyPassword выполняет проверку пароля против заранее созданного хеша.
+// Production: вызывается для несуществующих email, чтобы время ответа не
+// выдавало, зарегистрирован ли адрес
+func CheckDummyPassword(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = HashPassword("chirpy-dummy-password")
+	})
+	CheckPasswordHash(password, dummyHash)
+}
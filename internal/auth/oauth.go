@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"slices"
+	"strings"
+)
+
+// OAuthClientSecretPrefix - префикс секретов OAuth клиентов: по нему сканеры
+// секретов находят утекшие client_secret
+const OAuthClientSecretPrefix = "chirpy_cs_"
+
+// oauthScopes - scopes, которые может запросить OAuth клиент.
+// admin сторонним приложениям не выдается
+var oauthScopes = []string{ScopeChirpsWrite, ScopeUsersWrite, ScopeChirpsModerate}
+
+// OAuthScopes возвращает scopes, доступные OAuth клиентам
+func OAuthScopes() []string {
+	return slices.Clone(oauthScopes)
+}
+
+// IsOAuthScope проверяет, что scope может быть выдан OAuth клиенту
+func IsOAuthScope(scope string) bool {
+	return slices.Contains(oauthScopes, scope)
+}
+
+// ParseScope разбирает параметр scope (значения через пробел, RFC 6749 3.3)
+// без повторов и в исходном порядке
+func ParseScope(scope string) []string {
+	scopes := make([]string, 0)
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// MakeOAuthClientSecret генерирует новый client_secret
+func MakeOAuthClientSecret() (string, error) {
+	secret, err := MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	return OAuthClientSecretPrefix + secret, nil
+}
+
+// CheckOAuthClientSecret сравнивает секрет с сохраненным хешем (HashToken)
+// за постоянное время
+func CheckOAuthClientSecret(secret, secretHash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashToken(secret)), []byte(secretHash)) == 1
+}
+
+// IsValidCodeChallenge проверяет формат PKCE code_challenge метода S256:
+// base64url без padding от SHA-256, ровно 43 символа
+func IsValidCodeChallenge(challenge string) bool {
+	if len(challenge) != 43 {
+		return false
+	}
+	_, err := base64.RawURLEncoding.DecodeString(challenge)
+	return err == nil
+}
+
+// VerifyCodeChallenge проверяет PKCE code_verifier по code_challenge,
+// сохраненному при выдаче кода (RFC 7636, метод S256)
+func VerifyCodeChallenge(verifier, challenge string) bool {
+	// RFC 7636 4.1: 43-128 символов из [A-Za-z0-9-._~]
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	for _, c := range verifier {
+		isUnreserved := c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' ||
+			c == '-' || c == '.' || c == '_' || c == '~'
+		if !isUnreserved {
+			return false
+		}
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	// Пример из RFC 7636, Appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if !IsValidCodeChallenge(challenge) {
+		t.Error("valid S256 challenge rejected")
+	}
+	if !VerifyCodeChallenge(verifier, challenge) {
+		t.Error("valid verifier rejected")
+	}
+
+	tests := []struct {
+		name     string
+		verifier string
+	}{
+		{"other verifier", strings.Repeat("a", 43)},
+		{"too short", verifier[:42]},
+		{"too long", strings.Repeat("a", 129)},
+		{"invalid characters", verifier[:42] + "+"},
+		{"empty", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if VerifyCodeChallenge(tt.verifier, challenge) {
+				t.Errorf("verifier %q accepted", tt.verifier)
+			}
+		})
+	}
+
+	// plain метод не поддерживается: challenge, равный verifier, не проходит
+	if VerifyCodeChallenge(verifier, verifier) {
+		t.Error("plain challenge accepted")
+	}
+	if IsValidCodeChallenge("short") {
+		t.Error("invalid challenge accepted")
+	}
+}
+
+func TestParseScope(t *testing.T) {
+	got := ParseScope("  chirps:write users:write chirps:write ")
+	want := []string{ScopeChirpsWrite, ScopeUsersWrite}
+	if !slices.Equal(got, want) {
+		t.Errorf("ParseScope = %v, want %v", got, want)
+	}
+	if got := ParseScope(""); got == nil || len(got) != 0 {
+		t.Errorf("ParseScope(\"\") = %#v, want empty slice", got)
+	}
+}
+
+func TestOAuthClientSecret(t *testing.T) {
+	secret, err := MakeOAuthClientSecret()
+	if err != nil {
+		t.Fatalf("MakeOAuthClientSecret failed: %v", err)
+	}
+	if !strings.HasPrefix(secret, OAuthClientSecretPrefix) {
+		t.Errorf("secret %q has no prefix %q", secret, OAuthClientSecretPrefix)
+	}
+
+	hash := HashToken(secret)
+	if !CheckOAuthClientSecret(secret, hash) {
+		t.Error("valid secret rejected")
+	}
+	if CheckOAuthClientSecret(secret+"x", hash) {
+		t.Error("wrong secret accepted")
+	}
+}
+
+func TestKeySet_MakeAccessToken_OAuthClient(t *testing.T) {
+	keys := NewHMACKeySet("test-secret", time.Hour)
+	userID := uuid.New()
+
+	// Клиенту выдаются только согласованные scopes, которые есть у роли
+	token, err := keys.MakeAccessToken(Principal{
+		UserID:   userID,
+		Role:     RoleUser,
+		Scopes:   []string{ScopeChirpsWrite, ScopeChirpsModerate},
+		ClientID: "client-1",
+	}, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeAccessToken failed: %v", err)
+	}
+
+	p, err := keys.ParseAccessToken(token)
+	if err != nil {
+		t.Fatalf("ParseAccessToken failed: %v", err)
+	}
+	if p.ClientID != "client-1" {
+		t.Errorf("ClientID = %q, want client-1", p.ClientID)
+	}
+	if !slices.Equal(p.Scopes, []string{ScopeChirpsWrite}) {
+		t.Errorf("scopes = %v, want [%s]", p.Scopes, ScopeChirpsWrite)
+	}
+	if p.ExpiresAt.IsZero() || p.ExpiresAt.After(time.Now().Add(time.Hour+time.Minute)) {
+		t.Errorf("unexpected ExpiresAt: %v", p.ExpiresAt)
+	}
+
+	// Без ClientID scopes вычисляются по роли, переданные игнорируются
+	token, _ = keys.MakeAccessToken(Principal{UserID: userID, Role: RoleUser, Scopes: []string{ScopeAdmin}}, time.Hour)
+	p, _ = keys.ParseAccessToken(token)
+	if !slices.Equal(p.Scopes, ScopesForRole(RoleUser)) || p.ClientID != "" {
+		t.Errorf("first-party principal = %+v, want role scopes without client", p)
+	}
+}
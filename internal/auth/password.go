@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"fmt"
+
+	"github.com/alexedwards/argon2id"
+)
+
+// UnsetPasswordHash - значение hashed_password по умолчанию из миграции 003.
+// У таких пользователей пароля нет: войти можно только после сброса пароля
+const UnsetPasswordHash = "unset"
+
+// passwordParams - параметры Argon2id для новых хешей паролей
+var passwordParams = *argon2id.DefaultParams
+
+// SetPasswordParams задает параметры Argon2id для новых хешей.
+// Вызывается при запуске сервера, до обработки запросов
+func SetPasswordParams(params argon2id.Params) error {
+	if params.Iterations < 1 || params.Parallelism < 1 {
+		return fmt.Errorf("iterations и parallelism должны быть не меньше 1")
+	}
+	// Требование Argon2: не меньше 8 KiB памяти на каждый поток
+	if params.Memory < 8*uint32(params.Parallelism) {
+		return fmt.Errorf("memory должна быть не меньше %d KiB", 8*uint32(params.Parallelism))
+	}
+	if params.SaltLength < 16 || params.KeyLength < 16 {
+		return fmt.Errorf("длина соли и ключа должна быть не меньше 16 байт")
+	}
+
+	passwordParams = params
+	return nil
+}
+
+// PasswordParams возвращает текущие параметры Argon2id
+func PasswordParams() argon2id.Params {
+	return passwordParams
+}
+
+// NeedsRehash проверяет, создан ли хеш с более слабыми параметрами, чем
+// текущие. Parallelism не сравнивается: при той же памяти и числе итераций
+// он меняет только время вычисления, а по умолчанию зависит от числа CPU.
+// Для хеша в неизвестном формате возвращает false
+func NeedsRehash(hash string) bool {
+	params, _, _, err := argon2id.DecodeHash(hash)
+	if err != nil {
+		return false
+	}
+
+	return params.Memory < passwordParams.Memory ||
+		params.Iterations < passwordParams.Iterations ||
+		params.SaltLength < passwordParams.SaltLength ||
+		params.KeyLength < passwordParams.KeyLength
+}
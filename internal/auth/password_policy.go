@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Коды нарушений политики паролей
+const (
+	PasswordTooShort = "too_short"
+	PasswordTooLong  = "too_long"
+	PasswordIsEmail  = "matches_email"
+	PasswordBreached = "breached"
+)
+
+// PasswordPolicy - требования к новым паролям
+type PasswordPolicy struct {
+	// MinLength - минимальная длина в символах
+	MinLength int
+	// MaxLength - максимальная длина в символах (ограничивает стоимость хеширования)
+	MaxLength int
+	// Breached - корпус утекших паролей (nil - проверка выключена)
+	Breached BreachedPasswordSource
+}
+
+// DefaultPasswordPolicy - политика по умолчанию (рекомендации NIST SP 800-63B)
+var DefaultPasswordPolicy = PasswordPolicy{MinLength: 8, MaxLength: 128}
+
+// PasswordViolation - нарушение политики паролей
+type PasswordViolation struct {
+	Code    string
+	Message string
+}
+
+// Check проверяет пароль пользователя с указанным email. Пустой результат
+// означает, что пароль подходит; ошибка - что корпус утекших паролей недоступен
+func (p PasswordPolicy) Check(ctx context.Context, password, email string) ([]PasswordViolation, error) {
+	var violations []PasswordViolation
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordTooShort,
+			Message: fmt.Sprintf("Пароль должен содержать не меньше %d символов", p.MinLength),
+		})
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordTooLong,
+			Message: fmt.Sprintf("Пароль должен содержать не больше %d символов", p.MaxLength),
+		})
+		// Слишком длинный пароль дальше не проверяем
+		return violations, nil
+	}
+
+	if email != "" {
+		localPart, _, _ := strings.Cut(email, "@")
+		if strings.EqualFold(password, email) || strings.EqualFold(password, localPart) {
+			violations = append(violations, PasswordViolation{
+				Code:    PasswordIsEmail,
+				Message: "Пароль не должен совпадать с email",
+			})
+		}
+	}
+
+	if p.Breached != nil {
+		breached, err := IsBreachedPassword(ctx, p.Breached, password)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка проверки пароля по корпусу утечек: %w", err)
+		}
+		if breached {
+			violations = append(violations, PasswordViolation{
+				Code:    PasswordBreached,
+				Message: "Пароль встречается в известных утечках, выберите другой",
+			})
+		}
+	}
+
+	return violations, nil
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func violationCodes(violations []PasswordViolation) []string {
+	codes := make([]string, 0, len(violations))
+	for _, v := range violations {
+		codes = append(codes, v.Code)
+	}
+	return codes
+}
+
+func TestPasswordPolicy_Check(t *testing.T) {
+	corpus, err := LoadBreachedPasswords(strings.NewReader(strings.Join([]string{
+		"# популярные пароли",
+		"",
+		"password123",
+		// SHA-1("qwerty12345") в формате выгрузки HIBP
+		"4E17A448E043206801B95DE317E07C839770C8B8:1234",
+	}, "\n")))
+	if err != nil {
+		t.Fatalf("LoadBreachedPasswords failed: %v", err)
+	}
+
+	policy := PasswordPolicy{MinLength: 8, MaxLength: 20, Breached: corpus}
+
+	tests := []struct {
+		name     string
+		password string
+		email    string
+		want     []string
+	}{
+		{"valid", "correct horse", "user@example.com", nil},
+		{"too short", "abc", "user@example.com", []string{PasswordTooShort}},
+		{"too short counts runes", "пароль", "", []string{PasswordTooShort}},
+		{"too long", strings.Repeat("a", 21), "", []string{PasswordTooLong}},
+		{"email", "User@Example.com", "user@example.com", []string{PasswordIsEmail}},
+		{"email local part", "longusername", "longusername@example.com", []string{PasswordIsEmail}},
+		{"breached plaintext entry", "password123", "", []string{PasswordBreached}},
+		{"breached hash entry", "qwerty12345", "", []string{PasswordBreached}},
+		{"several violations", "abc", "abc@example.com", []string{PasswordTooShort, PasswordIsEmail}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations, err := policy.Check(context.Background(), tt.password, tt.email)
+			if err != nil {
+				t.Fatalf("Check failed: %v", err)
+			}
+			got := violationCodes(violations)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Check(%q) = %v, want %v", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBreachedPasswordCorpus_Range(t *testing.T) {
+	corpus, err := LoadBreachedPasswords(strings.NewReader("password123\n"))
+	if err != nil {
+		t.Fatalf("LoadBreachedPasswords failed: %v", err)
+	}
+
+	// SHA-1("password123") = CBFDAC6008F9CAB4083784CBD1874F76618D2A97
+	suffixes, err := corpus.Range(context.Background(), "cbfda")
+	if err != nil {
+		t.Fatalf("Range failed: %v", err)
+	}
+	if len(suffixes) != 1 || suffixes[0] != "C6008F9CAB4083784CBD1874F76618D2A97" {
+		t.Errorf("Range returned %v", suffixes)
+	}
+
+	if corpus.Len() != 1 {
+		t.Errorf("Len = %d, want 1", corpus.Len())
+	}
+}
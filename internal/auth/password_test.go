@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/alexedwards/argon2id"
+)
+
+// withPasswordParams временно задает параметры Argon2id на время теста
+func withPasswordParams(t *testing.T, params argon2id.Params) {
+	t.Helper()
+	prev := PasswordParams()
+	if err := SetPasswordParams(params); err != nil {
+		t.Fatalf("SetPasswordParams failed: %v", err)
+	}
+	t.Cleanup(func() { passwordParams = prev })
+}
+
+func TestNeedsRehash(t *testing.T) {
+	weak := argon2id.Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	withPasswordParams(t, weak)
+
+	hash, err := HashPassword("password123")
+	if err != nil {
+		t.Fatalf("HashPassword failed: %v", err)
+	}
+	if NeedsRehash(hash) {
+		t.Error("hash with current params must not need rehash")
+	}
+
+	// Параметры усилены - старый хеш нужно пересчитать
+	strong := weak
+	strong.Iterations = 2
+	withPasswordParams(t, strong)
+	if !NeedsRehash(hash) {
+		t.Error("hash with fewer iterations must need rehash")
+	}
+
+	// Parallelism на решение не влияет
+	parallel := weak
+	parallel.Parallelism = 4
+	withPasswordParams(t, parallel)
+	if NeedsRehash(hash) {
+		t.Error("parallelism change alone must not require rehash")
+	}
+
+	// Более сильный хеш не понижается
+	withPasswordParams(t, strong)
+	strongHash, _ := HashPassword("password123")
+	withPasswordParams(t, weak)
+	if NeedsRehash(strongHash) {
+		t.Error("stronger hash must not be rehashed to weaker params")
+	}
+}
+
+func TestNeedsRehash_InvalidHash(t *testing.T) {
+	for _, hash := range []string{UnsetPasswordHash, "", "$argon2i$v=19$m=1024,t=1,p=1$c2FsdA$a2V5"} {
+		if NeedsRehash(hash) {
+			t.Errorf("NeedsRehash(%q) = true, want false", hash)
+		}
+	}
+}
+
+func TestSetPasswordParams_Invalid(t *testing.T) {
+	tests := []argon2id.Params{
+		{Memory: 64 * 1024, Iterations: 0, Parallelism: 1, SaltLength: 16, KeyLength: 32},
+		{Memory: 64 * 1024, Iterations: 1, Parallelism: 0, SaltLength: 16, KeyLength: 32},
+		{Memory: 8, Iterations: 1, Parallelism: 2, SaltLength: 16, KeyLength: 32},
+		{Memory: 64 * 1024, Iterations: 1, Parallelism: 1, SaltLength: 8, KeyLength: 32},
+	}
+
+	prev := PasswordParams()
+	for _, params := range tests {
+		if err := SetPasswordParams(params); err == nil {
+			t.Errorf("SetPasswordParams(%+v) should fail", params)
+		}
+	}
+	if PasswordParams() != prev {
+		t.Error("invalid params must not replace current ones")
+	}
+}
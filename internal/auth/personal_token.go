@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// PersonalTokenPrefix - префикс персональных токенов доступа. По нему
+// middleware отличает их от JWT, а сканеры секретов находят утекшие токены
+const PersonalTokenPrefix = "chirpy_pat_"
+
+// MakePersonalAccessToken генерирует новый персональный токен доступа
+func MakePersonalAccessToken() (string, error) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	return PersonalTokenPrefix + token, nil
+}
+
+// IsPersonalAccessToken проверяет, что bearer token - персональный токен, а не JWT
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalTokenPrefix)
+}
+
+// PersonalTokenPrincipal собирает Principal для запроса с персональным токеном.
+// Действуют только те scopes токена, которые сейчас есть у роли пользователя:
+// после понижения роли старые токены не сохраняют лишних прав
+func PersonalTokenPrincipal(tokenID, userID uuid.UUID, role string, scopes []string) Principal {
+	return Principal{
+		UserID:          userID,
+		Role:            role,
+		Scopes:          GrantedScopes(role, scopes),
+		PersonalTokenID: tokenID,
+	}
+}
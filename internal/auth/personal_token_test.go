@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestMakePersonalAccessToken(t *testing.T) {
+	token, err := MakePersonalAccessToken()
+	if err != nil {
+		t.Fatalf("MakePersonalAccessToken failed: %v", err)
+	}
+
+	if !IsPersonalAccessToken(token) {
+		t.Errorf("token %q has no prefix %q", token, PersonalTokenPrefix)
+	}
+	if len(token) != len(PersonalTokenPrefix)+64 {
+		t.Errorf("unexpected token length: %d", len(token))
+	}
+
+	other, _ := MakePersonalAccessToken()
+	if token == other {
+		t.Error("MakePersonalAccessToken returned the same token twice")
+	}
+}
+
+func TestIsPersonalAccessToken_JWT(t *testing.T) {
+	userID := uuid.New()
+	token, err := MakeJWT(userID, "secret", time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT failed: %v", err)
+	}
+
+	if IsPersonalAccessToken(token) {
+		t.Error("JWT must not be detected as personal access token")
+	}
+}
+
+func TestPersonalTokenPrincipal(t *testing.T) {
+	tokenID, userID := uuid.New(), uuid.New()
+
+	// Модераторский scope не действует после понижения роли до user
+	p := PersonalTokenPrincipal(tokenID, userID, RoleUser, []string{ScopeChirpsWrite, ScopeChirpsModerate})
+
+	if p.UserID != userID || p.PersonalTokenID != tokenID || p.Role != RoleUser {
+		t.Errorf("unexpected principal: %+v", p)
+	}
+	if !slices.Equal(p.Scopes, []string{ScopeChirpsWrite}) {
+		t.Errorf("scopes = %v, want [%s]", p.Scopes, ScopeChirpsWrite)
+	}
+	if p.HasScope(ScopeUsersWrite) {
+		t.Error("principal must not get role scopes missing from the token")
+	}
+}
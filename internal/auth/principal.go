@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Роли пользователей (users.role)
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Scopes, которые проверяются при регистрации маршрутов
+const (
+	ScopeChirpsWrite    = "chirps:write"
+	ScopeChirpsModerate = "chirps:moderate"
+	ScopeUsersWrite     = "users:write"
+	ScopeAdmin          = "admin"
+)
+
+// roleScopes - scopes, которые получает каждая роль
+var roleScopes = map[string][]string{
+	RoleUser:      {ScopeChirpsWrite, ScopeUsersWrite},
+	RoleModerator: {ScopeChirpsWrite, ScopeUsersWrite, ScopeChirpsModerate},
+	RoleAdmin:     {ScopeChirpsWrite, ScopeUsersWrite, ScopeChirpsModerate, ScopeAdmin},
+}
+
+// IsValidRole проверяет, что роль известна
+func IsValidRole(role string) bool {
+	_, ok := roleScopes[role]
+	return ok
+}
+
+// ScopesForRole возвращает scopes роли (для неизвестной роли - пустой список)
+func ScopesForRole(role string) []string {
+	return slices.Clone(roleScopes[role])
+}
+
+// Claims - claims access token: стандартные поля и роль со scopes пользователя
+type Claims struct {
+	jwt.RegisteredClaims
+	Role string `json:"role,omitempty"`
+	// Scope - scopes через пробел (как в OAuth 2.0, RFC 8693)
+	Scope string `json:"scope,omitempty"`
+	// SessionID - сессия (семейство refresh tokens), в которой выдан токен
+	SessionID string `json:"sid,omitempty"`
+	// TokenVersion - версия токенов пользователя на момент выдачи (users.token_version)
+	TokenVersion int32 `json:"ver,omitempty"`
+	// ClientID - OAuth клиент, которому выдан токен (RFC 9068)
+	ClientID string `json:"client_id,omitempty"`
+	// CSRF - хеш CSRF токена сессии на cookie (HashToken)
+	CSRF string `json:"csrf,omitempty"`
+}
+
+// Principal - аутентифицированный пользователь запроса
+type Principal struct {
+	UserID uuid.UUID
+	Role   string
+	Scopes []string
+	// SessionID - сессия входа (uuid.Nil для токенов, выпущенных до введения сессий)
+	SessionID uuid.UUID
+	// TokenVersion - версия токенов, сверяется с users.token_version
+	TokenVersion int32
+	// PersonalTokenID - персональный токен запроса (uuid.Nil для JWT)
+	PersonalTokenID uuid.UUID
+	// ClientID - OAuth клиент, действующий от имени пользователя (пусто для входа в Chirpy)
+	ClientID string
+	// ExpiresAt - срок действия access token (нулевой для персональных токенов)
+	ExpiresAt time.Time
+	// CSRFHash - хеш CSRF токена, если access token выдан для хранения в cookie
+	CSRFHash string
+}
+
+// GrantedScopes оставляет из scopes только те, что сейчас есть у роли
+// (после понижения роли ранее выданные права не сохраняются)
+func GrantedScopes(role string, scopes []string) []string {
+	roleScopes := ScopesForRole(role)
+
+	granted := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if slices.Contains(roleScopes, scope) {
+			granted = append(granted, scope)
+		}
+	}
+	return granted
+}
+
+// HasScope проверяет наличие scope у пользователя
+func (p Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// principalFromClaims собирает Principal из проверенных claims. Токены,
+// выпущенные до введения ролей, не содержат role и получают права RoleUser
+func principalFromClaims(userID uuid.UUID, claims *Claims) Principal {
+	// Ошибка разбора оставляет uuid.Nil: такой токен просто не привязан к сессии
+	sessionID, _ := uuid.Parse(claims.SessionID)
+
+	p := Principal{
+		UserID:       userID,
+		Role:         claims.Role,
+		Scopes:       strings.Fields(claims.Scope),
+		SessionID:    sessionID,
+		TokenVersion: claims.TokenVersion,
+		ClientID:     claims.ClientID,
+		CSRFHash:     claims.CSRF,
+	}
+	if claims.ExpiresAt != nil {
+		p.ExpiresAt = claims.ExpiresAt.Time
+	}
+
+	if claims.Role == "" {
+		p.Role = RoleUser
+		p.Scopes = ScopesForRole(RoleUser)
+	}
+
+	return p
+}
+
+type principalKey struct{}
+
+// WithPrincipal кладет аутентифицированного пользователя в контекст запроса
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext возвращает пользователя, установленного middleware аутентификации
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxTokenStateEntries - предельный размер кеша. При его достижении удаляется
+// tokenStateEvictBatch записей, так что полный обход карты нужен не на каждую
+// вставку, а раз в tokenStateEvictBatch вставок
+const (
+	maxTokenStateEntries = 10000
+	tokenStateEvictBatch = maxTokenStateEntries / 10
+)
+
+// TokenState - актуальное состояние пользователя, с которым сверяется access token
+type TokenState struct {
+	// Version - текущая версия токенов (users.token_version). Токен с другой
+	// версией отозван: сменой пароля, блокировкой или выходом на всех устройствах
+	Version int32
+	Banned  bool
+}
+
+// TokenStateCache - кеш TokenState в памяти процесса, чтобы не обращаться к БД
+// на каждый запрос. Изменения в этом процессе применяются сразу через
+// Invalidate, изменения с других экземпляров сервера - в течение ttl
+type TokenStateCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[uuid.UUID]tokenStateEntry
+	// loads - загрузки из БД, идущие сейчас без блокировки. Invalidate
+	// увеличивает их generation, и результат такой загрузки не сохраняется:
+	// он мог быть прочитан до изменения
+	loads map[uuid.UUID]*tokenStateLoad
+}
+
+type tokenStateEntry struct {
+	state     TokenState
+	expiresAt time.Time
+}
+
+type tokenStateLoad struct {
+	generation uint64
+	waiters    int
+}
+
+// NewTokenStateCache создает кеш с временем жизни записей ttl
+func NewTokenStateCache(ttl time.Duration) *TokenStateCache {
+	return &TokenStateCache{
+		ttl:     ttl,
+		entries: make(map[uuid.UUID]tokenStateEntry),
+		loads:   make(map[uuid.UUID]*tokenStateLoad),
+	}
+}
+
+// Get возвращает состояние пользователя из кеша или загружает его через load
+func (c *TokenStateCache) Get(ctx context.Context, userID uuid.UUID, load func(context.Context, uuid.UUID) (TokenState, error)) (TokenState, error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[userID]
+	if ok && now.Before(entry.expiresAt) {
+		c.mu.Unlock()
+		return entry.state, nil
+	}
+	pending := c.loads[userID]
+	if pending == nil {
+		pending = &tokenStateLoad{}
+		c.loads[userID] = pending
+	}
+	pending.waiters++
+	generation := pending.generation
+	c.mu.Unlock()
+
+	state, err := load(ctx, userID)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pending.waiters--
+	if pending.waiters == 0 {
+		delete(c.loads, userID)
+	}
+	if err != nil {
+		return TokenState{}, err
+	}
+
+	// ⚠️ Invalidate во время загрузки: состояние могло устареть, в кеш его
+	// не кладем, следующий запрос загрузит заново
+	if pending.generation != generation {
+		return state, nil
+	}
+
+	if len(c.entries) >= maxTokenStateEntries {
+		c.evictLocked(now)
+	}
+	c.entries[userID] = tokenStateEntry{state: state, expiresAt: now.Add(c.ttl)}
+
+	return state, nil
+}
+
+// Invalidate удаляет состояние пользователя из кеша (после смены версии или блокировки)
+func (c *TokenStateCache) Invalidate(userID uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, userID)
+	if pending := c.loads[userID]; pending != nil {
+		pending.generation++
+	}
+}
+
+// evictLocked удаляет истекшие записи и, если их меньше tokenStateEvictBatch,
+// произвольные действующие (порядок обхода карты случаен)
+func (c *TokenStateCache) evictLocked(now time.Time) {
+	evicted := 0
+	for userID, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, userID)
+			evicted++
+		}
+	}
+
+	for userID := range c.entries {
+		if evicted >= tokenStateEvictBatch {
+			return
+		}
+		delete(c.entries, userID)
+		evicted++
+	}
+}
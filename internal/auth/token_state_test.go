@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestTokenStateCache(t *testing.T) {
+	cache := NewTokenStateCache(time.Minute)
+	userID := uuid.New()
+
+	loads := 0
+	version := int32(1)
+	load := func(ctx context.Context, id uuid.UUID) (TokenState, error) {
+		loads++
+		return TokenState{Version: version}, nil
+	}
+
+	state, err := cache.Get(context.Background(), userID, load)
+	if err != nil || state.Version != 1 {
+		t.Fatalf("Get returned %+v, %v, want version 1", state, err)
+	}
+
+	// Повторный запрос берется из кеша
+	version = 2
+	state, _ = cache.Get(context.Background(), userID, load)
+	if state.Version != 1 || loads != 1 {
+		t.Errorf("Get should use cached state: got version %d after %d loads", state.Version, loads)
+	}
+
+	// После Invalidate состояние загружается заново
+	cache.Invalidate(userID)
+	state, _ = cache.Get(context.Background(), userID, load)
+	if state.Version != 2 || loads != 2 {
+		t.Errorf("Get should reload after Invalidate: got version %d after %d loads", state.Version, loads)
+	}
+}
+
+func TestTokenStateCache_Expiry(t *testing.T) {
+	cache := NewTokenStateCache(0)
+	userID := uuid.New()
+
+	loads := 0
+	load := func(ctx context.Context, id uuid.UUID) (TokenState, error) {
+		loads++
+		return TokenState{}, nil
+	}
+
+	cache.Get(context.Background(), userID, load)
+	cache.Get(context.Background(), userID, load)
+
+	if loads != 2 {
+		t.Errorf("expired entries should be reloaded: got %d loads, want 2", loads)
+	}
+}
+
+func TestTokenStateCache_InvalidateDuringLoad(t *testing.T) {
+	cache := NewTokenStateCache(time.Minute)
+	userID := uuid.New()
+
+	// Invalidate приходит, пока загрузка читает старое состояние из БД
+	stale := func(ctx context.Context, id uuid.UUID) (TokenState, error) {
+		cache.Invalidate(id)
+		return TokenState{Version: 1}, nil
+	}
+	if state, _ := cache.Get(context.Background(), userID, stale); state.Version != 1 {
+		t.Fatalf("Get returned version %d, want 1", state.Version)
+	}
+
+	loads := 0
+	fresh := func(ctx context.Context, id uuid.UUID) (TokenState, error) {
+		loads++
+		return TokenState{Version: 2}, nil
+	}
+	state, _ := cache.Get(context.Background(), userID, fresh)
+	if state.Version != 2 || loads != 1 {
+		t.Errorf("state loaded before Invalidate must not be cached: got version %d after %d loads", state.Version, loads)
+	}
+	if len(cache.loads) != 0 {
+		t.Errorf("finished loads should be forgotten, got %d", len(cache.loads))
+	}
+}
+
+func TestTokenStateCache_Bounded(t *testing.T) {
+	cache := NewTokenStateCache(time.Hour)
+	load := func(ctx context.Context, id uuid.UUID) (TokenState, error) {
+		return TokenState{}, nil
+	}
+
+	for i := 0; i < maxTokenStateEntries+tokenStateEvictBatch; i++ {
+		cache.Get(context.Background(), uuid.New(), load)
+	}
+
+	if len(cache.entries) > maxTokenStateEntries {
+		t.Errorf("cache grew to %d entries, limit %d", len(cache.entries), maxTokenStateEntries)
+	}
+}
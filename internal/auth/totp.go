@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Параметры TOTP (RFC 6238), совместимые с Google Authenticator и аналогами
+	totpDigits = 6
+	totpPeriod = 30 * time.Second
+	// totpSkew - допустимое расхождение часов клиента в шагах (±30 секунд)
+	totpSkew = 1
+	// 160 бит - рекомендуемый RFC 4226 размер секрета для HMAC-SHA1
+	totpSecretSize = 20
+	// 80 бит на код восстановления
+	recoveryCodeSize = 10
+)
+
+// AudienceMFA - audience challenge token, выданного после проверки пароля
+// и ожидающего второй фактор
+const AudienceMFA = "chirpy:mfa"
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret создает случайный TOTP секрет в base32 (без padding)
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, totpSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("ошибка генерации случайных байт: %w", err)
+	}
+
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPURI формирует otpauth:// URI для добавления секрета в приложение-аутентификатор
+func TOTPURI(secret, accountName, issuer string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(int(totpPeriod.Seconds())))
+
+	label := url.PathEscape(issuer + ":" + accountName)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// TOTPCode вычисляет код для момента t
+func TOTPCode(secret string, t time.Time) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("неверный TOTP секрет: %w", err)
+	}
+
+	return hotp(key, totpStep(t)), nil
+}
+
+// ValidateTOTP проверяет код с допуском ±totpSkew шагов и возвращает шаг,
+// которому соответствует код. Шаг сохраняется, чтобы код нельзя было
+// использовать повторно
+func ValidateTOTP(secret, code string, t time.Time) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := totpStep(t)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		// Production: сравнение за постоянное время
+		if subtle.ConstantTimeCompare([]byte(hotp(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+func totpStep(t time.Time) int64 {
+	return t.Unix() / int64(totpPeriod.Seconds())
+}
+
+// hotp вычисляет HOTP код (RFC 4226) для счетчика
+func hotp(key []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+// GenerateRecoveryCodes создает n одноразовых кодов восстановления
+// вида xxxxx-xxxxx-xxxxx-xxxxx
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		raw := make([]byte, recoveryCodeSize)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, fmt.Errorf("ошибка генерации случайных байт: %w", err)
+		}
+
+		code := hex.EncodeToString(raw)
+		codes[i] = code[0:5] + "-" + code[5:10] + "-" + code[10:15] + "-" + code[15:20]
+	}
+
+	return codes, nil
+}
+
+// HashRecoveryCode нормализует код восстановления (регистр, дефисы, пробелы)
+// и возвращает его хеш для хранения в БД
+func HashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return HashToken(normalized)
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Секрет из тестовых векторов RFC 6238 (ASCII "12345678901234567890")
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCode_RFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+	}
+
+	for _, tt := range tests {
+		code, err := TOTPCode(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("TOTPCode failed: %v", err)
+		}
+		if code != tt.want {
+			t.Errorf("TOTPCode(%d) = %s, want %s", tt.unix, code, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret failed: %v", err)
+	}
+
+	now := time.Now()
+	code, err := TOTPCode(secret, now)
+	if err != nil {
+		t.Fatalf("TOTPCode failed: %v", err)
+	}
+
+	step, ok := ValidateTOTP(secret, code, now)
+	if !ok {
+		t.Fatal("ValidateTOTP should accept current code")
+	}
+	if step != totpStep(now) {
+		t.Errorf("ValidateTOTP returned wrong step: got %d, want %d", step, totpStep(now))
+	}
+
+	// Код предыдущего шага принимается (расхождение часов)
+	if _, ok := ValidateTOTP(secret, code, now.Add(totpPeriod)); !ok {
+		t.Error("ValidateTOTP should accept code from previous step")
+	}
+
+	// Код двухминутной давности отклоняется
+	if _, ok := ValidateTOTP(secret, code, now.Add(4*totpPeriod)); ok {
+		t.Error("ValidateTOTP should reject expired code")
+	}
+
+	if _, ok := ValidateTOTP(secret, "12345", now); ok {
+		t.Error("ValidateTOTP should reject code of wrong length")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("JBSWY3DPEHPK3PXP", "user@example.com", "Chirpy")
+
+	if !strings.HasPrefix(uri, "otpauth://totp/Chirpy:user@example.com?") {
+		t.Errorf("TOTPURI returned wrong label: %s", uri)
+	}
+	if !strings.Contains(uri, "secret=JBSWY3DPEHPK3PXP") || !strings.Contains(uri, "issuer=Chirpy") {
+		t.Errorf("TOTPURI is missing secret or issuer: %s", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes failed: %v", err)
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 23 {
+			t.Errorf("recovery code has wrong format: %s", code)
+		}
+		if seen[code] {
+			t.Errorf("duplicate recovery code: %s", code)
+		}
+		seen[code] = true
+	}
+
+	// Хеш не зависит от регистра и дефисов
+	code := codes[0]
+	if HashRecoveryCode(strings.ToUpper(code)) != HashRecoveryCode(strings.ReplaceAll(code, "-", "")) {
+		t.Error("HashRecoveryCode should normalize case and dashes")
+	}
+}
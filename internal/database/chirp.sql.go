@@ -7,30 +7,63 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (body, user_id)
-VALUES ($1, $2)
-RETURNING id, created_at, updated_at, body, user_id
+INSERT INTO chirps (body, user_id, parent_id, root_id, quote_of_id)
+VALUES ($1, $2::uuid, $3, $4, $5)
+RETURNING id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, deleted_at, like_count, rechirp_of_id, quote_of_id
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body      string
+	UserID    uuid.UUID
+	ParentID  uuid.NullUUID
+	RootID    uuid.NullUUID
+	QuoteOfID uuid.NullUUID
 }
 
-func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
-	var i Chirp
+type CreateChirpRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Body        string
+	UserID      uuid.NullUUID
+	EditedAt    sql.NullTime
+	ParentID    uuid.NullUUID
+	RootID      uuid.NullUUID
+	DeletedAt   sql.NullTime
+	LikeCount   int32
+	RechirpOfID uuid.NullUUID
+	QuoteOfID   uuid.NullUUID
+}
+
+func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (CreateChirpRow, error) {
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.ParentID,
+		arg.RootID,
+		arg.QuoteOfID,
+	)
+	var i CreateChirpRow
 	err := row.Scan(
 		&i.ID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.EditedAt,
+		&i.ParentID,
+		&i.RootID,
+		&i.DeletedAt,
+		&i.LikeCount,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
 	)
 	return i, err
 }
@@ -55,43 +88,270 @@ func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
 }
 
 const getChirpByID = `-- name: GetChirpByID :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps 
+SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, deleted_at, like_count, rechirp_of_id, quote_of_id
+FROM chirps
 WHERE id = $1
+  AND deleted_at IS NULL
 `
 
-func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error) {
+type GetChirpByIDRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Body        string
+	UserID      uuid.NullUUID
+	EditedAt    sql.NullTime
+	ParentID    uuid.NullUUID
+	RootID      uuid.NullUUID
+	DeletedAt   sql.NullTime
+	LikeCount   int32
+	RechirpOfID uuid.NullUUID
+	QuoteOfID   uuid.NullUUID
+}
+
+func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (GetChirpByIDRow, error) {
 	row := q.db.QueryRowContext(ctx, getChirpByID, id)
-	var i Chirp
+	var i GetChirpByIDRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.EditedAt,
+		&i.ParentID,
+		&i.RootID,
+		&i.DeletedAt,
+		&i.LikeCount,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
+	)
+	return i, err
+}
+
+const getChirpForUpdate = `-- name: GetChirpForUpdate :one
+SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, deleted_at, like_count, rechirp_of_id, quote_of_id
+FROM chirps
+WHERE id = $1
+FOR UPDATE
+`
+
+type GetChirpForUpdateRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Body        string
+	UserID      uuid.NullUUID
+	EditedAt    sql.NullTime
+	ParentID    uuid.NullUUID
+	RootID      uuid.NullUUID
+	DeletedAt   sql.NullTime
+	LikeCount   int32
+	RechirpOfID uuid.NullUUID
+	QuoteOfID   uuid.NullUUID
+}
+
+// Блокирует chirp до конца транзакции редактирования: параллельные правки
+// выполняются по очереди и не теряют версии текста
+func (q *Queries) GetChirpForUpdate(ctx context.Context, id uuid.UUID) (GetChirpForUpdateRow, error) {
+	row := q.db.QueryRowContext(ctx, getChirpForUpdate, id)
+	var i GetChirpForUpdateRow
 	err := row.Scan(
 		&i.ID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.EditedAt,
+		&i.ParentID,
+		&i.RootID,
+		&i.DeletedAt,
+		&i.LikeCount,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
 	)
 	return i, err
 }
 
-const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-ORDER BY created_at ASC
+const getChirpsById = `-- name: GetChirpsById :one
+SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, deleted_at, like_count, rechirp_of_id, quote_of_id
+FROM chirps
+WHERE id = $1
+  AND deleted_at IS NULL
+`
+
+type GetChirpsByIdRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Body        string
+	UserID      uuid.NullUUID
+	EditedAt    sql.NullTime
+	ParentID    uuid.NullUUID
+	RootID      uuid.NullUUID
+	DeletedAt   sql.NullTime
+	LikeCount   int32
+	RechirpOfID uuid.NullUUID
+	QuoteOfID   uuid.NullUUID
+}
+
+// Надгробия удаленных chirps (deleted_at) видны только в ветках обсуждений
+func (q *Queries) GetChirpsById(ctx context.Context, id uuid.UUID) (GetChirpsByIdRow, error) {
+	row := q.db.QueryRowContext(ctx, getChirpsById, id)
+	var i GetChirpsByIdRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.EditedAt,
+		&i.ParentID,
+		&i.RootID,
+		&i.DeletedAt,
+		&i.LikeCount,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
+	)
+	return i, err
+}
+
+const listChirpsAsc = `-- name: ListChirpsAsc :many
+SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, deleted_at, like_count, rechirp_of_id, quote_of_id
+FROM chirps
+WHERE deleted_at IS NULL
+  AND ($1::uuid IS NULL OR user_id = $1::uuid)
+  AND ($2::timestamp IS NULL
+       OR (created_at, id) > ($2::timestamp, $3::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT $4
+`
+
+type ListChirpsAscParams struct {
+	AuthorID        uuid.NullUUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	PageLimit       int32
+}
+
+type ListChirpsAscRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Body        string
+	UserID      uuid.NullUUID
+	EditedAt    sql.NullTime
+	ParentID    uuid.NullUUID
+	RootID      uuid.NullUUID
+	DeletedAt   sql.NullTime
+	LikeCount   int32
+	RechirpOfID uuid.NullUUID
+	QuoteOfID   uuid.NullUUID
+}
+
+// Keyset-пагинация по возрастанию: строки строго после курсора (created_at, id)
+func (q *Queries) ListChirpsAsc(ctx context.Context, arg ListChirpsAscParams) ([]ListChirpsAscRow, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsAsc,
+		arg.AuthorID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListChirpsAscRow
+	for rows.Next() {
+		var i ListChirpsAscRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.EditedAt,
+			&i.ParentID,
+			&i.RootID,
+			&i.DeletedAt,
+			&i.LikeCount,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsDesc = `-- name: ListChirpsDesc :many
+SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, deleted_at, like_count, rechirp_of_id, quote_of_id
+FROM chirps
+WHERE deleted_at IS NULL
+  AND ($1::uuid IS NULL OR user_id = $1::uuid)
+  AND ($2::timestamp IS NULL
+       OR (created_at, id) < ($2::timestamp, $3::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT $4
 `
 
-func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirps)
+type ListChirpsDescParams struct {
+	AuthorID        uuid.NullUUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	PageLimit       int32
+}
+
+type ListChirpsDescRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Body        string
+	UserID      uuid.NullUUID
+	EditedAt    sql.NullTime
+	ParentID    uuid.NullUUID
+	RootID      uuid.NullUUID
+	DeletedAt   sql.NullTime
+	LikeCount   int32
+	RechirpOfID uuid.NullUUID
+	QuoteOfID   uuid.NullUUID
+}
+
+// Keyset-пагинация по убыванию: строки строго до курсора (created_at, id)
+func (q *Queries) ListChirpsDesc(ctx context.Context, arg ListChirpsDescParams) ([]ListChirpsDescRow, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsDesc,
+		arg.AuthorID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageLimit,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Chirp
+	var items []ListChirpsDescRow
 	for rows.Next() {
-		var i Chirp
+		var i ListChirpsDescRow
 		if err := rows.Scan(
 			&i.ID,
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.EditedAt,
+			&i.ParentID,
+			&i.RootID,
+			&i.DeletedAt,
+			&i.LikeCount,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
 		); err != nil {
 			return nil, err
 		}
@@ -106,27 +366,77 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 	return items, nil
 }
 
-const getChirpsByAuthorID = `-- name: GetChirpsByAuthorID :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps 
-WHERE user_id = $1
-ORDER BY created_at ASC
+const searchChirps = `-- name: SearchChirps :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.edited_at,
+       chirps.parent_id, chirps.root_id, chirps.like_count, chirps.quote_of_id,
+       ts_rank(chirps.search_vector, query)::real AS rank,
+       ts_headline('english', chirps.body, query,
+                   'StartSel=' || chr(1) || ', StopSel=' || chr(2) || ', MaxFragments=2, MinWords=5, MaxWords=20')::text AS snippet
+FROM chirps, to_tsquery('english', $1::text) AS query
+WHERE chirps.search_vector @@ query
+  AND chirps.deleted_at IS NULL
+  AND ($2::uuid IS NULL OR chirps.user_id = $2::uuid)
+  AND ($3::timestamp IS NULL OR chirps.created_at >= $3::timestamp)
+  AND ($4::timestamp IS NULL OR chirps.created_at < $4::timestamp)
+ORDER BY rank DESC, chirps.created_at DESC, chirps.id DESC
+LIMIT $5 OFFSET $6
 `
 
-func (q *Queries) GetChirpsByAuthorID(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirpsByAuthorID, userID)
+type SearchChirpsParams struct {
+	Query       string
+	AuthorID    uuid.NullUUID
+	CreatedFrom sql.NullTime
+	CreatedTo   sql.NullTime
+	PageLimit   int32
+	PageOffset  int32
+}
+
+type SearchChirpsRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.NullUUID
+	EditedAt  sql.NullTime
+	ParentID  uuid.NullUUID
+	RootID    uuid.NullUUID
+	LikeCount int32
+	QuoteOfID uuid.NullUUID
+	Rank      float32
+	Snippet   string
+}
+
+// Полнотекстовый поиск: ранжирование по ts_rank и подсветка фрагментов.
+// Маркеры подсветки chr(1)/chr(2) заменяются на <mark> после HTML-экранирования
+func (q *Queries) SearchChirps(ctx context.Context, arg SearchChirpsParams) ([]SearchChirpsRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchChirps,
+		arg.Query,
+		arg.AuthorID,
+		arg.CreatedFrom,
+		arg.CreatedTo,
+		arg.PageLimit,
+		arg.PageOffset,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Chirp
+	var items []SearchChirpsRow
 	for rows.Next() {
-		var i Chirp
+		var i SearchChirpsRow
 		if err := rows.Scan(
 			&i.ID,
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.EditedAt,
+			&i.ParentID,
+			&i.RootID,
+			&i.LikeCount,
+			&i.QuoteOfID,
+			&i.Rank,
+			&i.Snippet,
 		); err != nil {
 			return nil, err
 		}
@@ -141,20 +451,53 @@ func (q *Queries) GetChirpsByAuthorID(ctx context.Context, userID uuid.UUID) ([]
 	return items, nil
 }
 
-const getChirpsById = `-- name: GetChirpsById :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-WHERE id = $1
+const updateChirpBody = `-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = $1, updated_at = NOW(), edited_at = NOW()
+WHERE id = $2
+  AND created_at > NOW() - make_interval(secs => $3::float8)
+RETURNING id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, deleted_at, like_count, rechirp_of_id, quote_of_id
 `
 
-func (q *Queries) GetChirpsById(ctx context.Context, id uuid.UUID) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, getChirpsById, id)
-	var i Chirp
+type UpdateChirpBodyParams struct {
+	Body              string
+	ID                uuid.UUID
+	EditWindowSeconds float64
+}
+
+type UpdateChirpBodyRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Body        string
+	UserID      uuid.NullUUID
+	EditedAt    sql.NullTime
+	ParentID    uuid.NullUUID
+	RootID      uuid.NullUUID
+	DeletedAt   sql.NullTime
+	LikeCount   int32
+	RechirpOfID uuid.NullUUID
+	QuoteOfID   uuid.NullUUID
+}
+
+// Текст меняется только в пределах окна редактирования от публикации.
+// sql.ErrNoRows - окно истекло
+func (q *Queries) UpdateChirpBody(ctx context.Context, arg UpdateChirpBodyParams) (UpdateChirpBodyRow, error) {
+	row := q.db.QueryRowContext(ctx, updateChirpBody, arg.Body, arg.ID, arg.EditWindowSeconds)
+	var i UpdateChirpBodyRow
 	err := row.Scan(
 		&i.ID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.EditedAt,
+		&i.ParentID,
+		&i.RootID,
+		&i.DeletedAt,
+		&i.LikeCount,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
 	)
 	return i, err
 }
@@ -11,24 +11,273 @@ import (
 	"github.com/google/uuid"
 )
 
+// Лайки chirps (один на пользователя и chirp)
+type ChirpLike struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+}
+
+// Предыдущие версии текста chirps
+type ChirpRevision struct {
+	ID      uuid.UUID
+	ChirpID uuid.UUID
+	Body    string
+	// Момент публикации этой версии текста
+	PublishedAt time.Time
+	// Момент, когда версию заменил новый текст
+	ReplacedAt time.Time
+}
+
 type Chirp struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Body      string
+	// Автор (NULL - надгробие chirp удаленного аккаунта)
+	UserID uuid.NullUUID
+	// Generated tsvector по body для полнотекстового поиска
+	SearchVector interface{}
+	// Момент последнего редактирования (NULL если не редактировался)
+	EditedAt sql.NullTime
+	// Chirp, на который это ответ (NULL - не ответ)
+	ParentID uuid.NullUUID
+	// Первый chirp ветки обсуждения (NULL - не ответ)
+	RootID uuid.NullUUID
+	// Момент удаления chirp, оставленного надгробием в ветке (NULL если не удален)
+	DeletedAt sql.NullTime
+	// Число лайков (обновляется вместе с chirp_likes)
+	LikeCount int32
+	// Оригинал простого rechirp (NULL - не rechirp)
+	RechirpOfID uuid.NullUUID
+	// Процитированный chirp (NULL - не цитата)
+	QuoteOfID uuid.NullUUID
+}
+
+// Одноразовые токены подтверждения email
+type EmailVerificationToken struct {
+	// SHA-256 (hex) от токена подтверждения (primary key)
+	TokenHash string
+	UserID    uuid.UUID
+	// Адрес, который подтверждает токен
+	Email     string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	// Момент использования или аннулирования токена (NULL если активен)
+	UsedAt sql.NullTime
+}
+
+// Подписки: follower_id читает chirps followee_id
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+// Однократно сохраненный момент перехода с HS256 на асимметричные ключи подписи JWT
+type JwtLegacyCutover struct {
+	// Всегда TRUE: в таблице не больше одной строки
+	Singleton bool
+	CutoverAt time.Time
+}
+
+// Ключи подписи JWT, общие для всех экземпляров сервера
+type JwtSigningKey struct {
+	// JWK thumbprint ключа (primary key)
+	Kid string
+	Alg string
+	// Зашифрованный приватный ключ (PKCS#8 DER)
+	PrivateKey []byte
+	CreatedAt  time.Time
+	// С какого момента ключ подписывает токены (до этого только опубликован в JWKS)
+	ActivatesAt time.Time
+}
+
+// Счетчики неудачных попыток входа для защиты от перебора
+type LoginAttempt struct {
+	// email:<адрес>, ip:<адрес> или mfa:<user id>
+	AttemptKey string
+	// Число неудачных попыток подряд
+	Failures      int32
+	LastFailureAt time.Time
+	// Вход заблокирован до этого момента (NULL если не заблокирован)
+	LockedUntil sql.NullTime
+}
+
+// Одноразовые ссылки для входа без пароля
+type MagicLinkToken struct {
+	// SHA-256 (hex) от токена из ссылки (primary key)
+	TokenHash string
+	UserID    uuid.UUID
+	// SHA-256 (hex) от cookie браузера, запросившего вход
+	NonceHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	// Момент использования или аннулирования ссылки (NULL если активна)
+	UsedAt sql.NullTime
+}
+
+// Одноразовые коды восстановления для входа без TOTP
+type MfaRecoveryCode struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+	// SHA-256 (hex) от нормализованного кода
+	CodeHash  string
+	CreatedAt time.Time
+	// Момент использования кода (NULL если не использован)
+	UsedAt sql.NullTime
+}
+
+// Коды авторизации OAuth 2.0
+type OauthAuthorizationCode struct {
+	// SHA-256 (hex) от кода авторизации (primary key)
+	CodeHash    string
+	ClientID    uuid.UUID
+	UserID      uuid.UUID
+	RedirectUri string
+	Scopes      []string
+	// PKCE code_challenge (метод S256)
+	CodeChallenge string
+	// Семейство refresh tokens, выдаваемых по коду
+	FamilyID  uuid.UUID
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	// Момент обмена кода на токены (NULL если не использован)
+	UsedAt sql.NullTime
+}
+
+// OAuth 2.0 клиенты (сторонние приложения)
+type OauthClient struct {
+	// client_id
+	ID uuid.UUID
+	// Пользователь, зарегистрировавший клиента
+	OwnerID uuid.UUID
+	Name    string
+	// SHA-256 (hex) от client_secret (NULL - публичный клиент)
+	SecretHash sql.NullString
+	// Разрешенные redirect_uri (сравниваются точно)
+	RedirectUris []string
+	// Scopes, которые клиент может запросить
+	Scopes    []string
+	CreatedAt time.Time
+	// Момент удаления клиента (NULL если активен)
+	RevokedAt sql.NullTime
+}
+
+// Одноразовые коды завершения входа через OIDC провайдеров
+type OidcLoginCode struct {
+	// SHA-256 (hex) от кода из redirect (primary key)
+	CodeHash string
+	UserID   uuid.UUID
+	// SHA-256 (hex) от cookie браузера, начавшего вход
+	BrowserHash string
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// Незавершенные входы через OIDC провайдеров
+type OidcLoginState struct {
+	// SHA-256 (hex) от параметра state (primary key)
+	StateHash    string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	// Пользователь, к которому привязывается аккаунт (NULL - вход)
+	LinkUserID uuid.NullUUID
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	// SHA-256 (hex) от cookie браузера, начавшего вход
+	BrowserHash string
+}
+
+// Одноразовые токены сброса пароля
+type PasswordResetToken struct {
+	// SHA-256 (hex) от токена сброса (primary key)
+	TokenHash string
 	UserID    uuid.UUID
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	// Момент использования или аннулирования токена (NULL если активен)
+	UsedAt sql.NullTime
+}
+
+// Персональные токены доступа для скриптов и интеграций
+type PersonalAccessToken struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+	// Название токена, заданное пользователем
+	Name string
+	// SHA-256 (hex) от токена
+	TokenHash string
+	// Scopes токена (подмножество scopes роли пользователя)
+	Scopes    []string
+	CreatedAt time.Time
+	// Срок действия (NULL - бессрочный)
+	ExpiresAt sql.NullTime
+	// Последнее использование токена (NULL если не использовался)
+	LastUsedAt sql.NullTime
+	// Момент отзыва токена (NULL если активен)
+	RevokedAt sql.NullTime
+}
+
+// Счетчики запросов в фиксированном окне
+type RateLimit struct {
+	// Действие и субъект, например magic:email:<адрес> или magic:ip:<адрес>
+	LimitKey        string
+	WindowStartedAt time.Time
+	// Число запросов с начала окна
+	Hits int32
 }
 
 // Таблица для хранения refresh tokens с возможностью отзыва
 type RefreshToken struct {
-	// 256-bit hex encoded refresh token (primary key)
-	Token     string
+	// SHA-256 (hex) от refresh token (primary key)
+	TokenHash string
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	UserID    uuid.UUID
 	ExpiresAt time.Time
 	// Timestamp отзыва токена (NULL если активен)
 	RevokedAt sql.NullTime
+	// Семейство токенов одного входа (для отзыва при повторном использовании)
+	FamilyID uuid.UUID
+	// SHA-256 токена, выданного взамен при ротации (NULL если не ротировался)
+	ReplacedByHash sql.NullString
+	// User-Agent клиента при выдаче токена
+	UserAgent string
+	// IP клиента при выдаче токена
+	Ip string
+	// Последнее использование сессии (вход или ротация)
+	LastUsedAt time.Time
+	// OAuth клиент, получивший токен (NULL - вход в Chirpy)
+	ClientID uuid.NullUUID
+	// Scopes, на которые пользователь дал согласие клиенту (NULL - scopes роли)
+	Scopes []string
+}
+
+// Одноразовые коды подтверждения личности по email
+type SudoEmailCode struct {
+	// SHA-256 (hex) от кода из письма (primary key)
+	CodeHash  string
+	UserID    uuid.UUID
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	// Момент использования или аннулирования кода (NULL если активен)
+	UsedAt sql.NullTime
+}
+
+// Внешние аккаунты (OIDC провайдеры), привязанные к пользователям
+type UserIdentity struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+	// Имя провайдера из OIDC_PROVIDERS
+	Provider string
+	// Идентификатор пользователя у провайдера (claim sub)
+	Subject string
+	// Email из ID token на момент привязки
+	Email       string
+	CreatedAt   time.Time
+	LastLoginAt time.Time
 }
 
 type User struct {
@@ -39,4 +288,24 @@ type User struct {
 	HashedPassword string
 	// Флаг подписки на Chirpy Red
 	IsChirpyRed bool
+	// Роль пользователя: user, moderator или admin
+	Role string
+	// TOTP секрет в base32 (NULL если не настроен)
+	TotpSecret sql.NullString
+	// Момент включения TOTP (NULL если выключен)
+	TotpEnabledAt sql.NullTime
+	// Последний принятый шаг TOTP (защита от повторного использования кода)
+	TotpLastStep int64
+	// Момент подтверждения email (NULL если не подтвержден)
+	EmailVerifiedAt sql.NullTime
+	// Новый email, ожидающий подтверждения
+	PendingEmail sql.NullString
+	// Версия access tokens (увеличение отзывает выданные токены)
+	TokenVersion int32
+	// Момент блокировки аккаунта (NULL если не заблокирован)
+	BannedAt sql.NullTime
+	// Число подписчиков (обновляется вместе с follows)
+	FollowerCount int32
+	// Число подписок (обновляется вместе с follows)
+	FollowingCount int32
 }
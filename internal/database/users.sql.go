@@ -7,14 +7,31 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
 
+const bumpUserTokenVersion = `-- name: BumpUserTokenVersion :one
+UPDATE users
+SET token_version = token_version + 1,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING token_version
+`
+
+// Отзыв всех выданных access tokens пользователя
+func (q *Queries) BumpUserTokenVersion(ctx context.Context, id uuid.UUID) (int32, error) {
+	row := q.db.QueryRowContext(ctx, bumpUserTokenVersion, id)
+	var token_version int32
+	err := row.Scan(&token_version)
+	return token_version, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (email, hashed_password)
 VALUES ($1, $2)
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, token_version, banned_at, follower_count, following_count
 `
 
 type CreateUserParams struct {
@@ -32,6 +49,16 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.TokenVersion,
+		&i.BannedAt,
+		&i.FollowerCount,
+		&i.FollowingCount,
 	)
 	return i, err
 }
@@ -45,8 +72,18 @@ func (q *Queries) DeleteAllUsers(ctx context.Context) error {
 	return err
 }
 
+const deleteUser = `-- name: DeleteUser :exec
+DELETE FROM users
+WHERE id = $1
+`
+
+func (q *Queries) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteUser, id)
+	return err
+}
+
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users 
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, token_version, banned_at, follower_count, following_count FROM users 
 WHERE email = $1
 `
 
@@ -60,12 +97,22 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.TokenVersion,
+		&i.BannedAt,
+		&i.FollowerCount,
+		&i.FollowingCount,
 	)
 	return i, err
 }
 
 const getUserByID = `-- name: GetUserByID :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users 
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, token_version, banned_at, follower_count, following_count FROM users 
 WHERE id = $1
 `
 
@@ -79,6 +126,135 @@ func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.TokenVersion,
+		&i.BannedAt,
+		&i.FollowerCount,
+		&i.FollowingCount,
+	)
+	return i, err
+}
+
+const getUserTokenState = `-- name: GetUserTokenState :one
+SELECT token_version, banned_at FROM users
+WHERE id = $1
+`
+
+type GetUserTokenStateRow struct {
+	TokenVersion int32
+	BannedAt     sql.NullTime
+}
+
+func (q *Queries) GetUserTokenState(ctx context.Context, id uuid.UUID) (GetUserTokenStateRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserTokenState, id)
+	var i GetUserTokenStateRow
+	err := row.Scan(
+		&i.TokenVersion,
+		&i.BannedAt,
+	)
+	return i, err
+}
+
+const rehashUserPassword = `-- name: RehashUserPassword :execrows
+UPDATE users
+SET hashed_password = $1
+WHERE id = $2
+  AND hashed_password = $3
+`
+
+type RehashUserPasswordParams struct {
+	NewHash string
+	ID      uuid.UUID
+	OldHash string
+}
+
+// Перехеширование пароля с новыми параметрами. Условие на старый хеш не дает
+// затереть пароль, измененный параллельным запросом
+func (q *Queries) RehashUserPassword(ctx context.Context, arg RehashUserPasswordParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, rehashUserPassword, arg.NewHash, arg.ID, arg.OldHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setUserBanned = `-- name: SetUserBanned :one
+UPDATE users
+SET banned_at = $2,
+    token_version = token_version + 1,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, token_version, banned_at, follower_count, following_count
+`
+
+type SetUserBannedParams struct {
+	ID       uuid.UUID
+	BannedAt sql.NullTime
+}
+
+// Блокировка (banned_at = время) или разблокировка (NULL) с отзывом access tokens
+func (q *Queries) SetUserBanned(ctx context.Context, arg SetUserBannedParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserBanned, arg.ID, arg.BannedAt)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.TokenVersion,
+		&i.BannedAt,
+		&i.FollowerCount,
+		&i.FollowingCount,
+	)
+	return i, err
+}
+
+const setUserRole = `-- name: SetUserRole :one
+UPDATE users
+SET role = $2,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, token_version, banned_at, follower_count, following_count
+`
+
+type SetUserRoleParams struct {
+	ID   uuid.UUID
+	Role string
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserRole, arg.ID, arg.Role)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.TokenVersion,
+		&i.BannedAt,
+		&i.FollowerCount,
+		&i.FollowingCount,
 	)
 	return i, err
 }
@@ -89,7 +265,7 @@ SET email = $1,
     hashed_password = $2,
     updated_at = NOW()
 WHERE id = $3
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, token_version, banned_at, follower_count, following_count
 `
 
 type UpdateUserParams struct {
@@ -108,10 +284,37 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.TokenVersion,
+		&i.BannedAt,
+		&i.FollowerCount,
+		&i.FollowingCount,
 	)
 	return i, err
 }
 
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users
+SET hashed_password = $2,
+    updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateUserPasswordParams struct {
+	ID             uuid.UUID
+	HashedPassword string
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.ID, arg.HashedPassword)
+	return err
+}
+
 const upgradeUserToChirpyRed = `-- name: UpgradeUserToChirpyRed :exec
 UPDATE users 
 SET is_chirpy_red = true,
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/IdrisovMarat/httpserver/internal/auth"
+	"github.com/IdrisovMarat/httpserver/internal/database"
+	"github.com/IdrisovMarat/httpserver/internal/helpers"
+	"github.com/google/uuid"
+)
+
+// SetUserRoleHandler меняет роль пользователя (требует scope admin)
+func (cfg *ApiConfig) SetUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Требуется аутентификация")
+		return
+	}
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат ID пользователя")
+		return
+	}
+
+	type requestBody struct {
+		Role string `json:"role"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	reqBody := requestBody{}
+	err = decoder.Decode(&reqBody)
+	if err != nil {
+		log.Printf("❌ Ошибка декодирования JSON: %v", err)
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат запроса")
+		return
+	}
+
+	if !auth.IsValidRole(reqBody.Role) {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Роль должна быть user, moderator или admin")
+		return
+	}
+
+	// 🛡️ Production: администратор не может случайно лишить прав самого себя
+	if userID == principal.UserID && reqBody.Role != auth.RoleAdmin {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Нельзя понизить собственную роль")
+		return
+	}
+
+	dbUser, err := cfg.setUserRole(r.Context(), userID, reqBody.Role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.RespondWithError(w, http.StatusNotFound, "Пользователь не найден")
+			return
+		}
+		log.Printf("❌ Ошибка смены роли пользователя %s: %v", userID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось изменить роль")
+		return
+	}
+
+	cfg.TokenStates.Invalidate(userID)
+
+	// Production: Логируем смену роли для аудита
+	log.Printf("🛡️ Администратор %s назначил пользователю %s роль %s", principal.UserID, userID, dbUser.Role)
+
+	helpers.RespondWithJSON(w, http.StatusOK, userFromDB(dbUser))
+}
+
+// BanUserHandler блокирует (POST) или разблокирует (DELETE) пользователя
+// (требует scope admin). Блокировка сразу отзывает все токены пользователя
+func (cfg *ApiConfig) BanUserHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Требуется аутентификация")
+		return
+	}
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат ID пользователя")
+		return
+	}
+
+	ban := r.Method == http.MethodPost
+	if ban && userID == principal.UserID {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Нельзя заблокировать самого себя")
+		return
+	}
+
+	bannedAt := sql.NullTime{}
+	if ban {
+		bannedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	}
+
+	dbUser, err := cfg.setUserBanned(r.Context(), userID, bannedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.RespondWithError(w, http.StatusNotFound, "Пользователь не найден")
+			return
+		}
+		log.Printf("❌ Ошибка блокировки пользователя %s: %v", userID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+	cfg.TokenStates.Invalidate(userID)
+
+	if ban {
+		// Production: Логируем блокировку для аудита
+		log.Printf("🛡️ Администратор %s заблокировал пользователя %s", principal.UserID, userID)
+	} else {
+		log.Printf("🛡️ Администратор %s разблокировал пользователя %s", principal.UserID, userID)
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, userFromDB(dbUser))
+}
+
+// setUserRole в одной транзакции меняет роль и версию токенов пользователя:
+// новая роль действует сразу, выданные токены со старыми scopes отзываются.
+// sql.ErrNoRows - пользователь не найден
+func (cfg *ApiConfig) setUserRole(ctx context.Context, userID uuid.UUID, role string) (database.User, error) {
+	tx, err := cfg.DBConn.BeginTx(ctx, nil)
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.Db.WithTx(tx)
+
+	dbUser, err := qtx.SetUserRole(ctx, database.SetUserRoleParams{
+		ID:   userID,
+		Role: role,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+
+	dbUser.TokenVersion, err = qtx.BumpUserTokenVersion(ctx, userID)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	return dbUser, tx.Commit()
+}
+
+// setUserBanned в одной транзакции блокирует или разблокирует пользователя.
+// Блокировка отзывает все refresh tokens: сессии не переживут разблокировку.
+// sql.ErrNoRows - пользователь не найден
+func (cfg *ApiConfig) setUserBanned(ctx context.Context, userID uuid.UUID, bannedAt sql.NullTime) (database.User, error) {
+	tx, err := cfg.DBConn.BeginTx(ctx, nil)
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.Db.WithTx(tx)
+
+	dbUser, err := qtx.SetUserBanned(ctx, database.SetUserBannedParams{
+		ID:       userID,
+		BannedAt: bannedAt,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+
+	if bannedAt.Valid {
+		err = qtx.RevokeAllUserRefreshTokens(ctx, userID)
+		if err != nil {
+			return database.User{}, err
+		}
+	}
+
+	return dbUser, tx.Commit()
+}
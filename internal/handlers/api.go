@@ -1,15 +1,34 @@
 package handlers
 
 import (
+	"database/sql"
 	"sync/atomic"
+	"time"
 
+	"github.com/IdrisovMarat/httpserver/internal/auth"
 	"github.com/IdrisovMarat/httpserver/internal/database"
+	"github.com/IdrisovMarat/httpserver/internal/mailer"
+	"github.com/IdrisovMarat/httpserver/internal/oidc"
 )
 
 type ApiConfig struct {
 	FileserverHits atomic.Int32
 	Db             *database.Queries
+	DBConn         *sql.DB // для транзакций через Db.WithTx
 	Platform       string
-	JWTsecret      string
+	CursorSecret   string                // ключ подписи курсоров пагинации, не связанный с JWT
+	Keys           *auth.KeySet          // ключи подписи access tokens
+	TokenStates    *auth.TokenStateCache // кеш версий токенов и блокировок для RequireAuth
+	PasswordPolicy auth.PasswordPolicy   // требования к новым паролям
 	PolkaKey       string
+	Mailer         mailer.Mailer // отправка писем (сброс пароля)
+	PublicURL      string        // внешний адрес сервера для ссылок в письмах
+	TrustProxy     bool          // доверять X-Forwarded-For (сервер за reverse proxy)
+	MagicLinkLogin bool          // вход без пароля по одноразовой ссылке из письма
+
+	// OIDCProviders - провайдеры входа через OpenID Connect по имени из URL
+	OIDCProviders map[string]oidc.Provider
+
+	// ChirpEditWindow - срок, в течение которого автор может редактировать chirp
+	ChirpEditWindow time.Duration
 }
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/IdrisovMarat/httpserver/internal/auth"
+	"github.com/IdrisovMarat/httpserver/internal/database"
+	"github.com/IdrisovMarat/httpserver/internal/helpers"
+	"github.com/google/uuid"
+)
+
+// DefaultChirpEditWindow - срок редактирования chirp после публикации,
+// если CHIRP_EDIT_WINDOW не задан
+const DefaultChirpEditWindow = time.Hour
+
+var (
+	// errChirpNotAuthor - редактировать chirp может только автор
+	errChirpNotAuthor = errors.New("chirp принадлежит другому пользователю")
+	// errChirpEditWindowExpired - срок редактирования chirp истек
+	errChirpEditWindowExpired = errors.New("срок редактирования chirp истек")
+	// errChirpIsRechirp - у простого rechirp нет своего текста
+	errChirpIsRechirp = errors.New("rechirp нельзя редактировать")
+)
+
+// ChirpRevision - предыдущая версия текста chirp
+type ChirpRevision struct {
+	Body        string    `json:"body"`
+	PublishedAt time.Time `json:"published_at"` // Когда была опубликована эта версия
+	ReplacedAt  time.Time `json:"replaced_at"`  // Когда ее заменил новый текст
+}
+
+// UpdateChirpHandler изменяет текст chirp. Править может только автор и только
+// в течение ChirpEditWindow после публикации; прежний текст сохраняется в истории
+func (cfg *ApiConfig) UpdateChirpHandler(w http.ResponseWriter, r *http.Request) {
+	type requestBody struct {
+		Body string `json:"body"`
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат ID chirp")
+		return
+	}
+
+	// 🔐 Пользователь аутентифицирован middleware RequireAuth
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Требуется аутентификация")
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	reqBody := requestBody{}
+	err = decoder.Decode(&reqBody)
+	if err != nil {
+		log.Printf("❌ Ошибка декодирования JSON: %v", err)
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат запроса")
+		return
+	}
+
+	body, ok := validateChirpBody(w, reqBody.Body)
+	if !ok {
+		return
+	}
+
+	dbChirp, err := cfg.editChirp(r.Context(), chirpID, principal.UserID, body)
+	if err != nil {
+		switch {
+		case err == sql.ErrNoRows:
+			helpers.RespondWithError(w, http.StatusNotFound, "Chirp не найден")
+		case errors.Is(err, errChirpNotAuthor):
+			log.Printf("🚫 Попытка редактирования чужого chirp %s пользователем %s", chirpID, principal.UserID)
+			helpers.RespondWithError(w, http.StatusForbidden, "Недостаточно прав для выполнения этой операции")
+		case errors.Is(err, errChirpEditWindowExpired):
+			helpers.RespondWithError(w, http.StatusForbidden, "Срок редактирования chirp истек")
+		case errors.Is(err, errChirpIsRechirp):
+			helpers.RespondWithError(w, http.StatusBadRequest, "Rechirp нельзя редактировать")
+		default:
+			log.Printf("❌ Ошибка редактирования chirp %s: %v", chirpID, err)
+			helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось изменить chirp")
+		}
+		return
+	}
+
+	log.Printf("✅ Chirp %s отредактирован автором %s", chirpID, principal.UserID)
+
+	helpers.RespondWithJSON(w, http.StatusOK, chirpFromDB(dbChirp, time.RFC3339Nano))
+}
+
+// editChirp в одной транзакции сохраняет текущий текст chirp в истории и
+// заменяет его новым. Текст без изменений не создает версию.
+// sql.ErrNoRows - chirp не найден
+func (cfg *ApiConfig) editChirp(ctx context.Context, chirpID, userID uuid.UUID, body string) (chirpRow, error) {
+	tx, err := cfg.DBConn.BeginTx(ctx, nil)
+	if err != nil {
+		return chirpRow{}, err
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.Db.WithTx(tx)
+
+	current, err := qtx.GetChirpForUpdate(ctx, chirpID)
+	if err != nil {
+		return chirpRow{}, err
+	}
+	if current.DeletedAt.Valid {
+		return chirpRow{}, sql.ErrNoRows
+	}
+
+	// 🔐 АВТОРИЗАЦИЯ: модераторы могут удалить чужой chirp, но не изменить его текст
+	if current.UserID.UUID != userID {
+		return chirpRow{}, errChirpNotAuthor
+	}
+
+	if current.RechirpOfID.Valid {
+		return chirpRow{}, errChirpIsRechirp
+	}
+
+	if current.Body == body {
+		return chirpRow(current), nil
+	}
+
+	publishedAt := current.CreatedAt
+	if current.EditedAt.Valid {
+		publishedAt = current.EditedAt.Time
+	}
+
+	err = qtx.CreateChirpRevision(ctx, database.CreateChirpRevisionParams{
+		ChirpID:     chirpID,
+		Body:        current.Body,
+		PublishedAt: publishedAt,
+	})
+	if err != nil {
+		return chirpRow{}, err
+	}
+
+	updated, err := qtx.UpdateChirpBody(ctx, database.UpdateChirpBodyParams{
+		Body:              body,
+		ID:                chirpID,
+		EditWindowSeconds: cfg.ChirpEditWindow.Seconds(),
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// chirp заблокирован транзакцией, значит не найден он быть не может
+			return chirpRow{}, errChirpEditWindowExpired
+		}
+		return chirpRow{}, err
+	}
+
+	return chirpRow(updated), tx.Commit()
+}
+
+// ListChirpRevisionsHandler возвращает предыдущие версии текста chirp,
+// начиная с последней
+func (cfg *ApiConfig) ListChirpRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат ID chirp")
+		return
+	}
+
+	_, err = cfg.Db.GetChirpByID(r.Context(), chirpID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.RespondWithError(w, http.StatusNotFound, "Chirp не найден")
+			return
+		}
+		log.Printf("❌ Ошибка получения chirp %s: %v", chirpID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось получить историю chirp")
+		return
+	}
+
+	dbRevisions, err := cfg.Db.ListChirpRevisions(r.Context(), chirpID)
+	if err != nil {
+		log.Printf("❌ Ошибка получения истории chirp %s: %v", chirpID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось получить историю chirp")
+		return
+	}
+
+	revisions := make([]ChirpRevision, 0, len(dbRevisions))
+	for _, dbRevision := range dbRevisions {
+		revisions = append(revisions, ChirpRevision{
+			Body:        dbRevision.Body,
+			PublishedAt: dbRevision.PublishedAt,
+			ReplacedAt:  dbRevision.ReplacedAt,
+		})
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, revisions)
+}
@@ -1,178 +1,396 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
-	"sort"
+	"slices"
 	"time"
 
 	"github.com/IdrisovMarat/httpserver/internal/auth"
 	"github.com/IdrisovMarat/httpserver/internal/database"
 	"github.com/IdrisovMarat/httpserver/internal/helpers"
+	"github.com/IdrisovMarat/httpserver/internal/pagination"
 	"github.com/google/uuid"
 )
 
+// maxChirpLength - текст chirp должен быть короче этого числа байт
+const maxChirpLength = 140
+
+// Виды курсоров пагинации (pagination.Cursor.Kind): курсор одного списка не
+// принимается другим
+const (
+	cursorKindChirps    = "chirps"
+	cursorKindThread    = "thread"
+	cursorKindLikes     = "likes"
+	cursorKindFollowers = "followers"
+	cursorKindFollowing = "following"
+	cursorKindTimeline  = "timeline"
+)
+
 type Chirp struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt string    `json:"created_at"`
-	UpdatedAt string    `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserID    uuid.UUID `json:"user_id"`
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt string     `json:"created_at"`
+	UpdatedAt string     `json:"updated_at"`
+	Body      string     `json:"body"`
+	UserID    *uuid.UUID `json:"user_id"` // null у надгробия chirp удаленного аккаунта
+	Edited    bool       `json:"edited"`  // Текст изменялся после публикации (история - GET /api/chirps/{id}/revisions)
+	// InReplyTo и RootID - chirp, на который это ответ, и первый chirp ветки
+	// (GET /api/chirps/{id}/thread); для chirp, не являющегося ответом, не указываются
+	InReplyTo *uuid.UUID `json:"in_reply_to,omitempty"`
+	RootID    *uuid.UUID `json:"root_id,omitempty"`
+	LikeCount int32      `json:"like_count"`
+	LikedByMe bool       `json:"liked_by_me"` // Только для запроса с токеном, иначе false
+	// RechirpOf - оригинал простого rechirp (текст пустой), QuoteOf -
+	// процитированный chirp; сам оригинал встроен в Original
+	RechirpOf *uuid.UUID     `json:"rechirp_of,omitempty"`
+	QuoteOf   *uuid.UUID     `json:"quote_of,omitempty"`
+	Original  *OriginalChirp `json:"original,omitempty"`
 }
 
-// sortChirps сортирует chirps в соответствии с указанным порядком
-func SortChirps(chirps []Chirp, sortOrder string) []Chirp {
-	switch sortOrder {
-	case "desc":
-		// Сортировка по убыванию (новые сначала)
-		sort.Slice(chirps, func(i, j int) bool {
-			return chirps[i].CreatedAt > chirps[j].CreatedAt
-		})
-		log.Printf("📊 Применена сортировка по убыванию (desc)")
-	case "asc":
-		// Сортировка по возрастанию (старые сначала) - значение по умолчанию
-		sort.Slice(chirps, func(i, j int) bool {
-			return chirps[i].CreatedAt < chirps[j].CreatedAt
-		})
-		log.Printf("📊 Применена сортировка по возрастанию (asc)")
-	default:
-		// По умолчанию - сортировка по возрастанию
-		sort.Slice(chirps, func(i, j int) bool {
-			return chirps[i].CreatedAt < chirps[j].CreatedAt
-		})
-		log.Printf("📊 Применена сортировка по умолчанию (asc)")
+// originalID возвращает оригинал rechirp или цитаты, nil для обычного chirp
+func (c *Chirp) originalID() *uuid.UUID {
+	if c.RechirpOf != nil {
+		return c.RechirpOf
 	}
+	return c.QuoteOf
+}
 
-	return chirps
+// chirpRow - строка chirps без search_vector, который нужен только поиску.
+// Запросы chirps выбирают одни и те же колонки, поэтому их строки
+// конвертируются в chirpRow
+type chirpRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Body        string
+	UserID      uuid.NullUUID
+	EditedAt    sql.NullTime
+	ParentID    uuid.NullUUID
+	RootID      uuid.NullUUID
+	DeletedAt   sql.NullTime
+	LikeCount   int32
+	RechirpOfID uuid.NullUUID
+	QuoteOfID   uuid.NullUUID
 }
 
-func (cfg *ApiConfig) CreateChirpHandler(w http.ResponseWriter, r *http.Request) {
-	// Извлекаем токен из заголовка
-	tokenString, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		log.Printf("❌ Ошибка извлечения токена: %v", err)
-		helpers.RespondWithError(w, http.StatusUnauthorized, "Неверный или отсутствующий токен")
-		return
+// chirpFromDB конвертирует chirp из БД в API формат с датами в формате layout
+func chirpFromDB(dbChirp chirpRow, layout string) Chirp {
+	return Chirp{
+		ID:        dbChirp.ID,
+		CreatedAt: dbChirp.CreatedAt.Format(layout),
+		UpdatedAt: dbChirp.UpdatedAt.Format(layout),
+		Body:      dbChirp.Body,
+		UserID:    nullUUIDPtr(dbChirp.UserID),
+		Edited:    dbChirp.EditedAt.Valid,
+		InReplyTo: nullUUIDPtr(dbChirp.ParentID),
+		RootID:    nullUUIDPtr(dbChirp.RootID),
+		LikeCount: dbChirp.LikeCount,
+		RechirpOf: nullUUIDPtr(dbChirp.RechirpOfID),
+		QuoteOf:   nullUUIDPtr(dbChirp.QuoteOfID),
 	}
+}
 
-	// Валидируем JWT токен
-	userID, err := auth.ValidateJWT(tokenString, cfg.JWTsecret)
-	if err != nil {
-		log.Printf("❌ Ошибка валидации токена: %v", err)
-		helpers.RespondWithError(w, http.StatusUnauthorized, "Неверный токен")
+// nullUUIDPtr возвращает nil для NULL, чтобы поле не попало в JSON
+func nullUUIDPtr(id uuid.NullUUID) *uuid.UUID {
+	if !id.Valid {
+		return nil
+	}
+	return &id.UUID
+}
+
+// validateChirpBody проверяет текст chirp и заменяет запрещенные слова.
+// При ошибке отвечает 400 и возвращает false
+func validateChirpBody(w http.ResponseWriter, body string) (string, bool) {
+	if len(body) >= maxChirpLength || len(body) == 0 {
+		helpers.RespondWithError(w, http.StatusBadRequest, "поле сhirp не может быть пустым и текс должен быть менее 140 символов")
+		return "", false
+	}
+	return helpers.DelProfanWords(body), true
+}
+
+var (
+	// errReplyParentNotFound - chirp, на который отвечают, не найден или удален
+	errReplyParentNotFound = errors.New("родительский chirp не найден")
+	// errQuotedChirpNotFound - цитируемый chirp не найден или удален
+	errQuotedChirpNotFound = errors.New("цитируемый chirp не найден")
+)
+
+func (cfg *ApiConfig) CreateChirpHandler(w http.ResponseWriter, r *http.Request) {
+	// 🔐 Пользователь аутентифицирован middleware RequireAuth
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Требуется аутентификация")
 		return
 	}
+	userID := principal.UserID
 
 	type chirpBody struct {
-		Body string `json:"body"`
+		Body      string     `json:"body"`
+		InReplyTo *uuid.UUID `json:"in_reply_to"` // Необязательный: chirp, на который это ответ
+		QuoteOf   *uuid.UUID `json:"quote_of"`    // Необязательный: цитируемый chirp
 	}
 
 	decoder := json.NewDecoder(r.Body)
 	chirp := chirpBody{}
-	err = decoder.Decode(&chirp)
+	err := decoder.Decode(&chirp)
 	if err != nil {
 		log.Printf("❌ Ошибка декодирования JSON: %v", err)
 		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат запроса")
 		return
 	}
 
-	if len(chirp.Body) >= 140 || len(chirp.Body) == 0 {
-		helpers.RespondWithError(w, http.StatusBadRequest, "поле сhirp не может быть пустым и текс должен быть менее 140 символов")
+	body, ok := validateChirpBody(w, chirp.Body)
+	if !ok {
+		return
+	}
+
+	// 📧 Публиковать chirps могут только пользователи с подтвержденным email
+	dbUser, err := cfg.Db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Ошибка получения пользователя %s: %v", userID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось создать chirp")
+		return
+	}
+	if !dbUser.EmailVerifiedAt.Valid {
+		helpers.RespondWithError(w, http.StatusForbidden, "Подтвердите email, чтобы публиковать chirps")
 		return
 	}
 
 	chirpParam := database.CreateChirpParams{
-		Body:   helpers.DelProfanWords(chirp.Body),
+		Body:   body,
 		UserID: userID,
 	}
 
-	log.Printf("🔄 Попытка создать текст chirp: %s", chirpParam)
+	log.Printf("🔄 Попытка создать текст chirp: %s", chirpParam.Body)
 
 	// Создаем chirp в базе
-	dbChirp, err := cfg.Db.CreateChirp(r.Context(), chirpParam)
+	dbChirp, err := cfg.createChirp(r.Context(), chirpParam, chirp.InReplyTo, chirp.QuoteOf)
 	if err != nil {
-		log.Printf("❌ Ошибка создания chirp в БД: %v", err)
-		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось создать chirp")
+		switch {
+		case errors.Is(err, errReplyParentNotFound):
+			helpers.RespondWithError(w, http.StatusBadRequest, "Chirp, на который вы отвечаете, не найден")
+		case errors.Is(err, errQuotedChirpNotFound):
+			helpers.RespondWithError(w, http.StatusBadRequest, "Цитируемый chirp не найден")
+		default:
+			log.Printf("❌ Ошибка создания chirp в БД: %v", err)
+			helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось создать chirp")
+		}
 		return
 	}
 
 	log.Printf("✅ chirp создан успешно. ID: %s", dbChirp.ID)
 
 	// Конвертируем chirp из БД в API формат
-	respons := Chirp{
-		ID:        dbChirp.ID,
-		CreatedAt: dbChirp.CreatedAt.Format("2006-01-02 15:04:05"),
-		UpdatedAt: dbChirp.UpdatedAt.Format("2006-01-02 15:04:05"),
-		Body:      dbChirp.Body,
-		UserID:    dbChirp.UserID,
+	respons := chirpFromDB(dbChirp, "2006-01-02 15:04:05")
+	if err := cfg.decorateChirps(r.Context(), []*Chirp{&respons}); err != nil {
+		log.Printf("❌ Ошибка получения цитируемого chirp %s: %v", dbChirp.ID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось получить созданный chirp")
+		return
 	}
 
 	helpers.RespondWithJSON(w, http.StatusCreated, respons)
 }
 
+// createChirp в одной транзакции создает chirp, ответ или цитату. Родитель и
+// цитируемый chirp заблокированы FOR SHARE, поэтому параллельное удаление не
+// превратит их в надгробие или не удалит до появления ссылки на них.
+// errReplyParentNotFound, errQuotedChirpNotFound - chirp не найден или удален
+func (cfg *ApiConfig) createChirp(ctx context.Context, params database.CreateChirpParams, inReplyTo, quoteOf *uuid.UUID) (chirpRow, error) {
+	tx, err := cfg.DBConn.BeginTx(ctx, nil)
+	if err != nil {
+		return chirpRow{}, err
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.Db.WithTx(tx)
+
+	// 🧵 Ответ продолжает ветку родителя. На удаленный chirp ответить нельзя,
+	// ответ на rechirp относится к оригиналу
+	if inReplyTo != nil {
+		parent, err := sharedChirp(ctx, qtx, *inReplyTo)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return chirpRow{}, errReplyParentNotFound
+			}
+			return chirpRow{}, err
+		}
+
+		params.ParentID = uuid.NullUUID{UUID: parent.ID, Valid: true}
+		params.RootID = parent.RootID
+		if !parent.RootID.Valid {
+			params.RootID = uuid.NullUUID{UUID: parent.ID, Valid: true}
+		}
+	}
+
+	// 💬 Цитата rechirp цитирует оригинал
+	if quoteOf != nil {
+		quoted, err := sharedChirp(ctx, qtx, *quoteOf)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return chirpRow{}, errQuotedChirpNotFound
+			}
+			return chirpRow{}, err
+		}
+
+		params.QuoteOfID = uuid.NullUUID{UUID: quoted.ID, Valid: true}
+	}
+
+	dbChirp, err := qtx.CreateChirp(ctx, params)
+	if err != nil {
+		return chirpRow{}, err
+	}
+
+	return chirpRow(dbChirp), tx.Commit()
+}
+
 func (cfg *ApiConfig) GetChirpsHandler(w http.ResponseWriter, r *http.Request) {
-	// 📋 Получаем параметр author_id из query string
-	authorIDStr := r.URL.Query().Get("author_id")
-	sortOrder := r.URL.Query().Get("sort")
+	// 📋 Получаем параметры фильтрации и пагинации из query string
+	query := r.URL.Query()
+	authorIDStr := query.Get("author_id")
+	sortOrder := query.Get("sort")
+	after := query.Get("after")
+	before := query.Get("before")
 
 	log.Printf("🔄 Получение chirps из базы данных, author_id: %s, sort: %s", authorIDStr, sortOrder)
 
-	var dbChirps []database.Chirp
-	var err error
+	if after != "" && before != "" {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Нельзя указывать after и before одновременно")
+		return
+	}
+
+	limit, err := pagination.ParseLimit(query.Get("limit"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	// 🔍 Если указан author_id - фильтруем по автору
+	var authorID uuid.NullUUID
 	if authorIDStr != "" {
 		// Парсим author_id в UUID
-		authorID, err := uuid.Parse(authorIDStr)
+		authorID.UUID, err = uuid.Parse(authorIDStr)
 		if err != nil {
 			log.Printf("❌ Неверный формат UUID author_id: %s, ошибка: %v", authorIDStr, err)
 			helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат author_id")
 			return
 		}
+		authorID.Valid = true
+	}
 
-		// Получаем chirps только для указанного автора
-		dbChirps, err = cfg.Db.GetChirpsByAuthorID(r.Context(), authorID)
+	// 🔐 Курсор подписан сервером, подделанный или чужой курсор отклоняем
+	var cursor *pagination.Cursor
+	if cursorStr := after + before; cursorStr != "" {
+		c, err := pagination.Decode(cursorStr, cursorKindChirps, cfg.CursorSecret)
 		if err != nil {
-			log.Printf("❌ Ошибка получения chirps автора %s из БД: %v", authorID, err)
-			helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось получить chirps")
+			log.Printf("❌ Неверный курсор пагинации: %v", err)
+			helpers.RespondWithError(w, http.StatusBadRequest, "Неверный курсор")
 			return
 		}
+		cursor = &c
+	}
 
-		log.Printf("✅ Найдено %d chirps автора: %s", len(dbChirps), authorID)
-	} else {
-		// 📋 Если author_id не указан - получаем все chirps
-		dbChirps, err = cfg.Db.GetChirps(r.Context())
-		if err != nil {
-			log.Printf("❌ Ошибка получения всех chirps из БД: %v", err)
-			helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось получить chirps")
-			return
-		}
+	// 🎯 Сортировка выполняется в БД. Для before читаем в обратном порядке
+	// от курсора и затем разворачиваем страницу
+	ascending := sortOrder != "desc"
+	if before != "" {
+		ascending = !ascending
+	}
 
-		log.Printf("✅ Найдено %d chirps (все)", len(dbChirps))
+	// Запрашиваем на одну запись больше, чтобы узнать, есть ли следующая страница
+	dbChirps, err := cfg.listChirps(r.Context(), ascending, authorID, cursor, limit+1)
+	if err != nil {
+		log.Printf("❌ Ошибка получения chirps из БД: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось получить chirps")
+		return
+	}
+
+	hasMore := len(dbChirps) > limit
+	if hasMore {
+		dbChirps = dbChirps[:limit]
 	}
 
+	if before != "" {
+		slices.Reverse(dbChirps)
+	}
+
+	log.Printf("✅ Найдено %d chirps", len(dbChirps))
+
 	// Конвертируем chirps из БД в API формат
 	chirps := make([]Chirp, len(dbChirps))
+	decorated := make([]*Chirp, len(dbChirps))
 	for i, dbChirp := range dbChirps {
-		chirps[i] = Chirp{
-			ID:        dbChirp.ID,
-			CreatedAt: dbChirp.CreatedAt.Format(time.RFC3339Nano),
-			UpdatedAt: dbChirp.UpdatedAt.Format(time.RFC3339Nano),
-			// CreatedAt: dbChirp.CreatedAt.Format("2006-01-02 15:04:05"), // Формат: "2021-01-01 00:00:00"
-			// UpdatedAt: dbChirp.UpdatedAt.Format("2006-01-02 15:04:05"),
-			Body:   dbChirp.Body,
-			UserID: dbChirp.UserID,
-		}
+		chirps[i] = chirpFromDB(dbChirp, time.RFC3339Nano)
+		decorated[i] = &chirps[i]
 	}
 
-	// 🎯 Применяем сортировку
-	chirps = SortChirps(chirps, sortOrder)
+	// ❤️ Оригиналы rechirps и liked_by_me для всей страницы
+	if err := cfg.decorateChirps(r.Context(), decorated); err != nil {
+		log.Printf("❌ Ошибка получения оригиналов и лайков chirps: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось получить chirps")
+		return
+	}
+
+	// 🔗 Ссылки на соседние страницы только в заголовке Link: тело остается
+	// массивом chirps, как до появления пагинации. next есть, если дальше
+	// остались записи (или мы пришли сюда через before), prev - если мы не на
+	// первой странице
+	if len(dbChirps) > 0 {
+		first, last := dbChirps[0], dbChirps[len(dbChirps)-1]
+
+		var next, prev string
+		if hasMore || before != "" {
+			next = pagination.PageURL(r.URL, "after", pagination.Encode(pagination.Cursor{Kind: cursorKindChirps, CreatedAt: last.CreatedAt, ID: last.ID}, cfg.CursorSecret))
+		}
+		if (before != "" && hasMore) || after != "" {
+			prev = pagination.PageURL(r.URL, "before", pagination.Encode(pagination.Cursor{Kind: cursorKindChirps, CreatedAt: first.CreatedAt, ID: first.ID}, cfg.CursorSecret))
+		}
+		if link := pagination.LinkHeader(next, prev); link != "" {
+			w.Header().Set("Link", link)
+		}
+	}
 
 	helpers.RespondWithJSON(w, http.StatusOK, chirps)
 }
 
+// listChirps выбирает страницу chirps в заданном направлении начиная от курсора
+func (cfg *ApiConfig) listChirps(ctx context.Context, ascending bool, authorID uuid.NullUUID, cursor *pagination.Cursor, limit int) ([]chirpRow, error) {
+	var cursorCreatedAt sql.NullTime
+	var cursorID uuid.NullUUID
+	if cursor != nil {
+		cursorCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+		cursorID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+	}
+
+	var rows []chirpRow
+	if ascending {
+		asc, err := cfg.Db.ListChirpsAsc(ctx, database.ListChirpsAscParams{
+			AuthorID:        authorID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			PageLimit:       int32(limit),
+		})
+		for _, row := range asc {
+			rows = append(rows, chirpRow(row))
+		}
+		return rows, err
+	}
+
+	desc, err := cfg.Db.ListChirpsDesc(ctx, database.ListChirpsDescParams{
+		AuthorID:        authorID,
+		CursorCreatedAt: cursorCreatedAt,
+		CursorID:        cursorID,
+		PageLimit:       int32(limit),
+	})
+	for _, row := range desc {
+		rows = append(rows, chirpRow(row))
+	}
+	return rows, err
+}
+
 func (cfg *ApiConfig) GetChirpByIdHandler(w http.ResponseWriter, r *http.Request) {
 	// Получаем ID из пути
 	chirpIDStr := r.PathValue("chirpID")
@@ -209,12 +427,12 @@ func (cfg *ApiConfig) GetChirpByIdHandler(w http.ResponseWriter, r *http.Request
 	log.Printf("✅ Найден chirp ID: %s", dbChirp.ID)
 
 	// Конвертируем chirp из БД в API формат
-	response := Chirp{
-		ID:        dbChirp.ID,
-		CreatedAt: dbChirp.CreatedAt.Format(time.RFC3339), // Формат: "2021-01-01T00:00:00Z"
-		UpdatedAt: dbChirp.UpdatedAt.Format(time.RFC3339),
-		Body:      dbChirp.Body,
-		UserID:    dbChirp.UserID,
+	response := chirpFromDB(chirpRow(dbChirp), time.RFC3339) // Формат: "2021-01-01T00:00:00Z"
+
+	if err := cfg.decorateChirps(r.Context(), []*Chirp{&response}); err != nil {
+		log.Printf("❌ Ошибка получения оригинала и лайков chirp %s: %v", dbChirp.ID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось получить chirp")
+		return
 	}
 
 	helpers.RespondWithJSON(w, http.StatusOK, response)
@@ -239,21 +457,13 @@ func (cfg *ApiConfig) DeleteChirpHandler(w http.ResponseWriter, r *http.Request)
 
 	log.Printf("🔄 Попытка удаления chirp: %s", chirpID)
 
-	// 🔐 АУТЕНТИФИКАЦИЯ: Проверяем access token
-	tokenString, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		log.Printf("❌ Ошибка извлечения токена при удалении chirp %s: %v", chirpID, err)
-		helpers.RespondWithError(w, http.StatusUnauthorized, "Неверный или отсутствующий токен")
-		return
-	}
-
-	// 🔐 АУТЕНТИФИКАЦИЯ: Валидируем JWT токен
-	userID, err := auth.ValidateJWT(tokenString, cfg.JWTsecret)
-	if err != nil {
-		log.Printf("❌ Ошибка валидации токена при удалении chirp %s: %v", chirpID, err)
-		helpers.RespondWithError(w, http.StatusUnauthorized, "Неверный токен")
+	// 🔐 АУТЕНТИФИКАЦИЯ: Пользователь аутентифицирован middleware RequireAuth
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Требуется аутентификация")
 		return
 	}
+	userID := principal.UserID
 
 	log.Printf("🔄 Пользователь %s пытается удалить chirp: %s", userID, chirpID)
 
@@ -270,24 +480,33 @@ func (cfg *ApiConfig) DeleteChirpHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// 🔐 АВТОРИЗАЦИЯ: Проверяем, что пользователь является автором chirp
-	if dbChirp.UserID != userID {
+	// 🔐 АВТОРИЗАЦИЯ: Удалить chirp может автор или модератор
+	if dbChirp.UserID.UUID != userID && !principal.HasScope(auth.ScopeChirpsModerate) {
 		log.Printf("🚫 Попытка удаления чужого chirp. Chirp автор: %s, Пользователь: %s, Chirp ID: %s",
-			dbChirp.UserID, userID, chirpID)
+			dbChirp.UserID.UUID, userID, chirpID)
 
 		// 🛡️ Production: Не раскрываем информацию о существовании chirp
 		helpers.RespondWithError(w, http.StatusForbidden, "Недостаточно прав для выполнения этой операции")
 		return
 	}
 
-	// 🗑️ Удаляем chirp из базы данных
-	err = cfg.Db.DeleteChirp(r.Context(), chirpID)
+	// 🗑️ Удаляем chirp из базы данных (chirp с ответами остается надгробием)
+	err = cfg.deleteChirp(r.Context(), chirpID)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.RespondWithError(w, http.StatusNotFound, "Chirp не найден")
+			return
+		}
 		log.Printf("❌ Ошибка удаления chirp %s из БД, пользователь %s: %v", chirpID, userID, err)
 		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось удалить chirp")
 		return
 	}
 
+	if dbChirp.UserID.UUID != userID {
+		// Production: Логируем модерацию для аудита
+		log.Printf("🛡️ Модератор %s (роль %s) удалил chirp %s автора %s", userID, principal.Role, chirpID, dbChirp.UserID.UUID)
+	}
+
 	log.Printf("✅ Chirp успешно удален: %s пользователем: %s", chirpID, userID)
 
 	// ✅ Возвращаем 204 No Content при успешном удалении
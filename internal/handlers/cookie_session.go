@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/IdrisovMarat/httpserver/internal/auth"
+)
+
+const (
+	// authModeHeader - заголовок запроса входа: значение authModeCookie
+	// выдает токены в HttpOnly cookie вместо тела ответа
+	authModeHeader = "X-Auth-Mode"
+	authModeCookie = "cookie"
+
+	// accessTokenCookie - access token сессии на cookie (недоступен JavaScript)
+	accessTokenCookie = "chirpy_access"
+	// refreshTokenCookie - refresh token; отправляется только на /api/refresh и /api/revoke
+	refreshTokenCookie = "chirpy_refresh"
+	// csrfTokenCookie - CSRF токен, который JavaScript читает и повторяет в
+	// заголовке auth.CSRFHeader
+	csrfTokenCookie = "chirpy_csrf"
+)
+
+// errCSRF - изменяющий запрос сессии на cookie без верного CSRF токена
+var errCSRF = errors.New("неверный или отсутствующий CSRF токен")
+
+// wantsCookieSession проверяет, что клиент запросил вход с токенами в cookie
+func wantsCookieSession(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get(authModeHeader), authModeCookie)
+}
+
+// secureCookies - cookie с флагом Secure. Отключается только при явном
+// http:// в PUBLIC_URL (локальная разработка)
+func (cfg *ApiConfig) secureCookies() bool {
+	return !strings.HasPrefix(cfg.PublicURL, "http://")
+}
+
+// setSessionCookie устанавливает cookie сессии. maxAge < 0 удаляет cookie
+func (cfg *ApiConfig) setSessionCookie(w http.ResponseWriter, name, value, path string, maxAge int, httpOnly bool) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		MaxAge:   maxAge,
+		HttpOnly: httpOnly,
+		Secure:   cfg.secureCookies(),
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// setSessionCookies сохраняет токены сессии в браузере. CSRF cookie живет
+// столько же, сколько refresh token: она нужна и для обновления токенов
+func (cfg *ApiConfig) setSessionCookies(w http.ResponseWriter, accessToken, refreshToken, csrfToken string) {
+	refreshMaxAge := int(refreshTokenTTL.Seconds())
+	cfg.setSessionCookie(w, accessTokenCookie, accessToken, "/", int(AccessTokenTTL.Seconds()), true)
+	cfg.setSessionCookie(w, refreshTokenCookie, refreshToken, "/api", refreshMaxAge, true)
+	cfg.setSessionCookie(w, csrfTokenCookie, csrfToken, "/", refreshMaxAge, false)
+}
+
+// clearSessionCookies удаляет cookie сессии (выход)
+func (cfg *ApiConfig) clearSessionCookies(w http.ResponseWriter) {
+	cfg.setSessionCookie(w, accessTokenCookie, "", "/", -1, true)
+	cfg.setSessionCookie(w, refreshTokenCookie, "", "/api", -1, true)
+	cfg.setSessionCookie(w, csrfTokenCookie, "", "/", -1, false)
+}
+
+// cookieValue возвращает значение cookie или пустую строку
+func cookieValue(r *http.Request, name string) string {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// checkDoubleSubmit проверяет CSRF на endpoints, где access token может быть
+// истекшим (обновление и отзыв refresh token): заголовок auth.CSRFHeader
+// должен совпадать с CSRF cookie. Сторонний сайт не может прочитать cookie
+// и повторить ее значение в заголовке
+func checkDoubleSubmit(r *http.Request) bool {
+	cookie := cookieValue(r, csrfTokenCookie)
+	header := r.Header.Get(auth.CSRFHeader)
+	if cookie == "" || header == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) == 1
+}
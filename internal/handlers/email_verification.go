@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/IdrisovMarat/httpserver/internal/auth"
+	"github.com/IdrisovMarat/httpserver/internal/database"
+	"github.com/IdrisovMarat/httpserver/internal/helpers"
+	"github.com/IdrisovMarat/httpserver/internal/mailer"
+	"github.com/google/uuid"
+)
+
+// emailVerificationTTL - срок действия ссылки для подтверждения email
+const emailVerificationTTL = 24 * time.Hour
+
+// sendEmailVerification создает токен подтверждения адреса email и отправляет
+// на этот адрес письмо со ссылкой. Ранее выданные токены пользователя аннулируются
+func (cfg *ApiConfig) sendEmailVerification(ctx context.Context, userID uuid.UUID, email string) error {
+	token, err := auth.MakeOneTimeToken()
+	if err != nil {
+		return fmt.Errorf("ошибка создания токена подтверждения: %w", err)
+	}
+
+	err = cfg.Db.InvalidateEmailVerificationTokens(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка аннулирования токенов подтверждения: %w", err)
+	}
+
+	err = cfg.Db.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    userID,
+		Email:     email,
+		ExpiresAt: time.Now().Add(emailVerificationTTL),
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения токена подтверждения: %w", err)
+	}
+
+	link := cfg.PublicURL + "/app/verify-email/#token=" + url.QueryEscape(token)
+
+	go cfg.sendMail(mailer.Message{
+		To:      email,
+		Subject: "Подтверждение email в Chirpy",
+		Body: fmt.Sprintf("Чтобы подтвердить адрес %s, перейдите по ссылке:\n\n%s\n\n"+
+			"Ссылка действует %d часа.\n"+
+			"Если вы не регистрировались в Chirpy, просто проигнорируйте это письмо.\n",
+			email, link, int(emailVerificationTTL.Hours())),
+	})
+
+	log.Printf("📧 Отправлено письмо для подтверждения email пользователя: %s", userID)
+	return nil
+}
+
+// VerifyEmailHandler подтверждает email по токену из письма. Для смены email
+// новый адрес становится основным только в этот момент
+func (cfg *ApiConfig) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	type requestBody struct {
+		Token string `json:"token"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	reqBody := requestBody{}
+	err := decoder.Decode(&reqBody)
+	if err != nil {
+		log.Printf("❌ Ошибка декодирования JSON: %v", err)
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат запроса")
+		return
+	}
+
+	// Production: Проверяем формат токена (должен быть 64 hex символа)
+	if len(reqBody.Token) != 64 {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный или истекший токен подтверждения")
+		return
+	}
+
+	dbUser, err := cfg.verifyEmail(r.Context(), reqBody.Token)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			log.Printf("❌ Неверный, истекший или использованный токен подтверждения: %s...", reqBody.Token[:8])
+			helpers.RespondWithError(w, http.StatusBadRequest, "Неверный или истекший токен подтверждения")
+			return
+		}
+		// Адрес успели зарегистрировать, пока письмо ждало подтверждения
+		if strings.Contains(err.Error(), "unique") {
+			helpers.RespondWithError(w, http.StatusConflict, "Email уже используется другим пользователем")
+			return
+		}
+		log.Printf("❌ Ошибка подтверждения email: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	log.Printf("✅ Email подтвержден для пользователя: %s", dbUser.ID)
+
+	helpers.RespondWithJSON(w, http.StatusOK, userFromDB(dbUser))
+}
+
+// verifyEmail в одной транзакции использует токен и делает подтвержденный
+// адрес основным. sql.ErrNoRows означает неверный токен
+func (cfg *ApiConfig) verifyEmail(ctx context.Context, token string) (database.User, error) {
+	tx, err := cfg.DBConn.BeginTx(ctx, nil)
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.Db.WithTx(tx)
+
+	verification, err := qtx.ConsumeEmailVerificationToken(ctx, auth.HashToken(token))
+	if err != nil {
+		return database.User{}, err
+	}
+
+	dbUser, err := qtx.VerifyUserEmail(ctx, database.VerifyUserEmailParams{
+		ID:    verification.UserID,
+		Email: verification.Email,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+
+	return dbUser, tx.Commit()
+}
+
+// ResendVerificationHandler повторно отправляет письмо для подтверждения
+// нового (pending) email или еще не подтвержденного основного адреса
+func (cfg *ApiConfig) ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Требуется аутентификация")
+		return
+	}
+
+	dbUser, err := cfg.Db.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		log.Printf("❌ Ошибка получения пользователя %s: %v", principal.UserID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	var email string
+	switch {
+	case dbUser.PendingEmail.Valid:
+		email = dbUser.PendingEmail.String
+	case !dbUser.EmailVerifiedAt.Valid:
+		email = dbUser.Email
+	default:
+		helpers.RespondWithError(w, http.StatusConflict, "Email уже подтвержден")
+		return
+	}
+
+	// 🛡️ Каждое письмо уходит на адрес, который мог указать кто угодно
+	// (pending email), поэтому отправка ограничена
+	retryAfter, err := cfg.hitRateLimits(r.Context(),
+		rateLimitHit{Key: verificationResendIPKey(helpers.ClientIP(r, cfg.TrustProxy)), Limit: verificationResendIPLimit},
+		rateLimitHit{Key: verificationResendUserKey(dbUser.ID), Limit: verificationResendUserLimit},
+	)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+	if retryAfter > 0 {
+		respondRateLimited(w, retryAfter, "Слишком много запросов письма подтверждения. Повторите позже")
+		return
+	}
+
+	err = cfg.sendEmailVerification(r.Context(), dbUser.ID, email)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/IdrisovMarat/httpserver/internal/auth"
+	"github.com/IdrisovMarat/httpserver/internal/database"
+	"github.com/IdrisovMarat/httpserver/internal/helpers"
+	"github.com/IdrisovMarat/httpserver/internal/pagination"
+	"github.com/google/uuid"
+)
+
+// FollowState - состояние подписки после follow/unfollow
+type FollowState struct {
+	Following     bool  `json:"following"`
+	FollowerCount int32 `json:"follower_count"` // Подписчики пользователя, на которого подписались
+}
+
+// FollowedUser - пользователь в списке подписок или подписчиков
+type FollowedUser struct {
+	ID         uuid.UUID `json:"id"`
+	FollowedAt string    `json:"followed_at"`
+}
+
+// FollowListPage - страница подписок или подписчиков. Count - их общее число
+type FollowListPage struct {
+	Users []FollowedUser `json:"users"`
+	Count int32          `json:"count"`
+	Next  string         `json:"next,omitempty"`
+}
+
+// TimelinePage - страница ленты подписок с непрозрачным курсором на следующую страницу
+type TimelinePage struct {
+	Chirps []Chirp `json:"chirps"`
+	Next   string  `json:"next,omitempty"`
+}
+
+// FollowUserHandler подписывает текущего пользователя на userID. Повторная
+// подписка ничего не меняет
+func (cfg *ApiConfig) FollowUserHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.setFollow(w, r, true)
+}
+
+// UnfollowUserHandler отменяет подписку текущего пользователя на userID
+func (cfg *ApiConfig) UnfollowUserHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.setFollow(w, r, false)
+}
+
+func (cfg *ApiConfig) setFollow(w http.ResponseWriter, r *http.Request, follow bool) {
+	followeeID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат ID пользователя")
+		return
+	}
+
+	// 🔐 Пользователь аутентифицирован middleware RequireAuth
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Требуется аутентификация")
+		return
+	}
+
+	if followeeID == principal.UserID {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Нельзя подписаться на себя")
+		return
+	}
+
+	followerCount, err := cfg.updateFollow(r.Context(), principal.UserID, followeeID, follow)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.RespondWithError(w, http.StatusNotFound, "Пользователь не найден")
+			return
+		}
+		log.Printf("❌ Ошибка изменения подписки %s на %s: %v", principal.UserID, followeeID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось изменить подписку")
+		return
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, FollowState{
+		Following:     follow,
+		FollowerCount: followerCount,
+	})
+}
+
+// updateFollow в одной транзакции создает или удаляет подписку и меняет
+// счетчики обоих пользователей, только если подписка действительно
+// изменилась. Возвращает новое число подписчиков followeeID;
+// sql.ErrNoRows - пользователь не найден
+func (cfg *ApiConfig) updateFollow(ctx context.Context, followerID, followeeID uuid.UUID, follow bool) (int32, error) {
+	tx, err := cfg.DBConn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.Db.WithTx(tx)
+
+	if _, err := qtx.GetUserByID(ctx, followeeID); err != nil {
+		return 0, err
+	}
+
+	var rows int64
+	var delta int32
+	if follow {
+		rows, err = qtx.CreateFollow(ctx, database.CreateFollowParams{FollowerID: followerID, FolloweeID: followeeID})
+		delta = 1
+	} else {
+		rows, err = qtx.DeleteFollow(ctx, database.DeleteFollowParams{FollowerID: followerID, FolloweeID: followeeID})
+		delta = -1
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if rows > 0 {
+		err = qtx.AdjustFollowCounts(ctx, database.AdjustFollowCountsParams{
+			FollowerID: followerID,
+			Delta:      delta,
+			FolloweeID: followeeID,
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	followee, err := qtx.GetUserByID(ctx, followeeID)
+	if err != nil {
+		return 0, err
+	}
+
+	return followee.FollowerCount, tx.Commit()
+}
+
+// ListFollowersHandler возвращает подписчиков пользователя, от последней
+// подписки (?limit=N&after=CURSOR)
+func (cfg *ApiConfig) ListFollowersHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.listFollows(w, r, true)
+}
+
+// ListFollowingHandler возвращает пользователей, на которых подписан
+// пользователь, от последней подписки (?limit=N&after=CURSOR)
+func (cfg *ApiConfig) ListFollowingHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.listFollows(w, r, false)
+}
+
+func (cfg *ApiConfig) listFollows(w http.ResponseWriter, r *http.Request, followers bool) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат ID пользователя")
+		return
+	}
+
+	query := r.URL.Query()
+	limit, err := pagination.ParseLimit(query.Get("limit"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := database.ListFollowersParams{
+		UserID:    userID,
+		PageLimit: int32(limit + 1), // +1 - признак следующей страницы
+	}
+
+	cursorKind := cursorKindFollowing
+	if followers {
+		cursorKind = cursorKindFollowers
+	}
+
+	// 🔐 Курсор подписан сервером, подделанный или чужой курсор отклоняем
+	if after := query.Get("after"); after != "" {
+		cursor, err := pagination.Decode(after, cursorKind, cfg.CursorSecret)
+		if err != nil {
+			log.Printf("❌ Неверный курсор пагинации: %v", err)
+			helpers.RespondWithError(w, http.StatusBadRequest, "Неверный курсор")
+			return
+		}
+		params.CursorFollowedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+	}
+
+	// Счетчики хранятся в users, поэтому общее число не требует COUNT(*)
+	dbUser, err := cfg.Db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.RespondWithError(w, http.StatusNotFound, "Пользователь не найден")
+			return
+		}
+		log.Printf("❌ Ошибка получения пользователя %s: %v", userID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось получить подписки")
+		return
+	}
+
+	var rows []database.ListFollowersRow
+	var count int32
+	if followers {
+		count = dbUser.FollowerCount
+		rows, err = cfg.Db.ListFollowers(r.Context(), params)
+	} else {
+		count = dbUser.FollowingCount
+		var following []database.ListFollowingRow
+		following, err = cfg.Db.ListFollowing(r.Context(), database.ListFollowingParams(params))
+		// Строки подписок и подписчиков одинаковы по составу
+		for _, row := range following {
+			rows = append(rows, database.ListFollowersRow(row))
+		}
+	}
+	if err != nil {
+		log.Printf("❌ Ошибка получения подписок пользователя %s: %v", userID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось получить подписки")
+		return
+	}
+
+	hasMore := len(rows) > limit
+	if hasMore {
+		rows = rows[:limit]
+	}
+
+	page := FollowListPage{Users: make([]FollowedUser, len(rows)), Count: count}
+	for i, row := range rows {
+		page.Users[i] = FollowedUser{ID: row.ID, FollowedAt: row.FollowedAt.Format(time.RFC3339Nano)}
+	}
+
+	if hasMore {
+		last := rows[len(rows)-1]
+		page.Next = pagination.PageURL(r.URL, "after", pagination.Encode(pagination.Cursor{Kind: cursorKind, CreatedAt: last.FollowedAt, ID: last.ID}, cfg.CursorSecret))
+		w.Header().Set("Link", pagination.LinkHeader(page.Next, ""))
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, page)
+}
+
+// TimelineHandler возвращает ленту текущего пользователя: chirps его подписок
+// и его собственные, от новых к старым (?limit=N&after=CURSOR)
+func (cfg *ApiConfig) TimelineHandler(w http.ResponseWriter, r *http.Request) {
+	// 🔐 Пользователь аутентифицирован middleware RequireAuth
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Требуется аутентификация")
+		return
+	}
+
+	query := r.URL.Query()
+	limit, err := pagination.ParseLimit(query.Get("limit"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := database.ListTimelineParams{
+		UserID:    principal.UserID,
+		PageLimit: int32(limit + 1), // +1 - признак следующей страницы
+	}
+
+	// 🔐 Курсор подписан сервером, подделанный или чужой курсор отклоняем
+	if after := query.Get("after"); after != "" {
+		cursor, err := pagination.Decode(after, cursorKindTimeline, cfg.CursorSecret)
+		if err != nil {
+			log.Printf("❌ Неверный курсор пагинации: %v", err)
+			helpers.RespondWithError(w, http.StatusBadRequest, "Неверный курсор")
+			return
+		}
+		params.CursorCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+	}
+
+	dbChirps, err := cfg.Db.ListTimeline(r.Context(), params)
+	if err != nil {
+		log.Printf("❌ Ошибка получения ленты пользователя %s: %v", principal.UserID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось получить ленту")
+		return
+	}
+
+	hasMore := len(dbChirps) > limit
+	if hasMore {
+		dbChirps = dbChirps[:limit]
+	}
+
+	chirps := make([]Chirp, len(dbChirps))
+	decorated := make([]*Chirp, len(dbChirps))
+	for i, dbChirp := range dbChirps {
+		chirps[i] = chirpFromDB(chirpRow(dbChirp), time.RFC3339Nano)
+		decorated[i] = &chirps[i]
+	}
+
+	// ❤️ Оригиналы rechirps и liked_by_me для всей страницы
+	if err := cfg.decorateChirps(r.Context(), decorated); err != nil {
+		log.Printf("❌ Ошибка получения оригиналов и лайков ленты: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось получить ленту")
+		return
+	}
+
+	page := TimelinePage{Chirps: chirps}
+	if hasMore {
+		last := dbChirps[len(dbChirps)-1]
+		page.Next = pagination.PageURL(r.URL, "after", pagination.Encode(pagination.Cursor{Kind: cursorKindTimeline, CreatedAt: last.CreatedAt, ID: last.ID}, cfg.CursorSecret))
+		w.Header().Set("Link", pagination.LinkHeader(page.Next, ""))
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, page)
+}
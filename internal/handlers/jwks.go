@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/IdrisovMarat/httpserver/internal/auth"
+	"github.com/IdrisovMarat/httpserver/internal/helpers"
+)
+
+// JWKSHandler публикует публичные ключи подписи access tokens (RFC 7517),
+// чтобы сторонние сервисы могли проверять токены без общего секрета
+func (cfg *ApiConfig) JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	// Production: ключи меняются только при ротации, разрешаем кеширование.
+	// Следующий ключ публикуется за auth.KeyPublishDelay до начала подписи,
+	// поэтому кеш не дольше auth.JWKSCacheTTL всегда содержит ключ токена
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(auth.JWKSCacheTTL.Seconds())))
+	helpers.RespondWithJSON(w, http.StatusOK, cfg.Keys.JWKS())
+}
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/IdrisovMarat/httpserver/internal/auth"
+	"github.com/IdrisovMarat/httpserver/internal/database"
+	"github.com/IdrisovMarat/httpserver/internal/helpers"
+	"github.com/IdrisovMarat/httpserver/internal/pagination"
+	"github.com/google/uuid"
+)
+
+// ChirpLikeState - состояние лайка chirp после like/unlike
+type ChirpLikeState struct {
+	LikeCount int32 `json:"like_count"`
+	LikedByMe bool  `json:"liked_by_me"`
+}
+
+// LikedChirp - chirp из лайков пользователя с моментом лайка
+type LikedChirp struct {
+	Chirp
+	LikedAt string `json:"liked_at"`
+}
+
+// LikedChirpsPage - страница лайков пользователя
+type LikedChirpsPage struct {
+	Chirps []LikedChirp `json:"chirps"`
+	Next   string       `json:"next,omitempty"`
+}
+
+// LikeChirpHandler отмечает chirp лайком текущего пользователя. Повторный
+// лайк ничего не меняет
+func (cfg *ApiConfig) LikeChirpHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.setChirpLike(w, r, true)
+}
+
+// UnlikeChirpHandler снимает лайк текущего пользователя
+func (cfg *ApiConfig) UnlikeChirpHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.setChirpLike(w, r, false)
+}
+
+func (cfg *ApiConfig) setChirpLike(w http.ResponseWriter, r *http.Request, liked bool) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат ID chirp")
+		return
+	}
+
+	// 🔐 Пользователь аутентифицирован middleware RequireAuth
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Требуется аутентификация")
+		return
+	}
+
+	likeCount, err := cfg.updateChirpLike(r.Context(), principal.UserID, chirpID, liked)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.RespondWithError(w, http.StatusNotFound, "Chirp не найден")
+			return
+		}
+		log.Printf("❌ Ошибка изменения лайка chirp %s пользователем %s: %v", chirpID, principal.UserID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось изменить лайк")
+		return
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, ChirpLikeState{
+		LikeCount: likeCount,
+		LikedByMe: liked,
+	})
+}
+
+// updateChirpLike в одной транзакции ставит или снимает лайк и меняет счетчик
+// chirp, только если лайк действительно добавился или удалился. Возвращает
+// новое число лайков; sql.ErrNoRows - chirp не найден или удален
+func (cfg *ApiConfig) updateChirpLike(ctx context.Context, userID, chirpID uuid.UUID, liked bool) (int32, error) {
+	tx, err := cfg.DBConn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.Db.WithTx(tx)
+
+	// Надгробия удаленных chirps (ветки обсуждений) лайкнуть нельзя, лайк
+	// rechirp относится к оригиналу
+	dbChirp, err := sharedChirp(ctx, qtx, chirpID)
+	if err != nil {
+		return 0, err
+	}
+	chirpID = dbChirp.ID
+
+	var rows int64
+	var delta int32
+	if liked {
+		rows, err = qtx.CreateChirpLike(ctx, database.CreateChirpLikeParams{UserID: userID, ChirpID: chirpID})
+		delta = 1
+	} else {
+		rows, err = qtx.DeleteChirpLike(ctx, database.DeleteChirpLikeParams{UserID: userID, ChirpID: chirpID})
+		delta = -1
+	}
+	if err != nil {
+		return 0, err
+	}
+	if rows == 0 {
+		delta = 0
+	}
+
+	likeCount, err := qtx.AdjustChirpLikeCount(ctx, database.AdjustChirpLikeCountParams{
+		Delta: delta,
+		ID:    chirpID,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return likeCount, tx.Commit()
+}
+
+// likedChirpIDs возвращает, какие из chirpIDs лайкнул пользователь запроса
+// (одним запросом на страницу). Для анонимного запроса - nil
+func (cfg *ApiConfig) likedChirpIDs(ctx context.Context, chirpIDs []uuid.UUID) (map[uuid.UUID]bool, error) {
+	principal, ok := auth.PrincipalFromContext(ctx)
+	if !ok || len(chirpIDs) == 0 {
+		return nil, nil
+	}
+
+	ids, err := cfg.Db.ListLikedChirpIDs(ctx, database.ListLikedChirpIDsParams{
+		UserID:   principal.UserID,
+		ChirpIds: chirpIDs,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	liked := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		liked[id] = true
+	}
+	return liked, nil
+}
+
+// ListUserLikesHandler возвращает chirps, которые лайкнул пользователь, от
+// последнего лайка (?limit=N&after=CURSOR)
+func (cfg *ApiConfig) ListUserLikesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат ID пользователя")
+		return
+	}
+
+	query := r.URL.Query()
+	limit, err := pagination.ParseLimit(query.Get("limit"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := database.ListUserLikedChirpsParams{
+		UserID:    userID,
+		PageLimit: int32(limit + 1), // +1 - признак следующей страницы
+	}
+
+	// 🔐 Курсор подписан сервером, подделанный или чужой курсор отклоняем
+	if after := query.Get("after"); after != "" {
+		cursor, err := pagination.Decode(after, cursorKindLikes, cfg.CursorSecret)
+		if err != nil {
+			log.Printf("❌ Неверный курсор пагинации: %v", err)
+			helpers.RespondWithError(w, http.StatusBadRequest, "Неверный курсор")
+			return
+		}
+		params.CursorLikedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+	}
+
+	_, err = cfg.Db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.RespondWithError(w, http.StatusNotFound, "Пользователь не найден")
+			return
+		}
+		log.Printf("❌ Ошибка получения пользователя %s: %v", userID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось получить лайки")
+		return
+	}
+
+	rows, err := cfg.Db.ListUserLikedChirps(r.Context(), params)
+	if err != nil {
+		log.Printf("❌ Ошибка получения лайков пользователя %s: %v", userID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось получить лайки")
+		return
+	}
+
+	hasMore := len(rows) > limit
+	if hasMore {
+		rows = rows[:limit]
+	}
+
+	page := LikedChirpsPage{Chirps: make([]LikedChirp, len(rows))}
+	decorated := make([]*Chirp, len(rows))
+	for i, row := range rows {
+		chirp := chirpFromDB(chirpRow{
+			ID:          row.ID,
+			CreatedAt:   row.CreatedAt,
+			UpdatedAt:   row.UpdatedAt,
+			Body:        row.Body,
+			UserID:      row.UserID,
+			EditedAt:    row.EditedAt,
+			ParentID:    row.ParentID,
+			RootID:      row.RootID,
+			DeletedAt:   row.DeletedAt,
+			LikeCount:   row.LikeCount,
+			RechirpOfID: row.RechirpOfID,
+			QuoteOfID:   row.QuoteOfID,
+		}, time.RFC3339Nano)
+		page.Chirps[i] = LikedChirp{Chirp: chirp, LikedAt: row.LikedAt.Format(time.RFC3339Nano)}
+		decorated[i] = &page.Chirps[i].Chirp
+	}
+
+	if err := cfg.decorateChirps(r.Context(), decorated); err != nil {
+		log.Printf("❌ Ошибка получения оригиналов и лайков chirps: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось получить лайки")
+		return
+	}
+
+	if hasMore {
+		last := rows[len(rows)-1]
+		page.Next = pagination.PageURL(r.URL, "after", pagination.Encode(pagination.Cursor{Kind: cursorKindLikes, CreatedAt: last.LikedAt, ID: last.ID}, cfg.CursorSecret))
+		w.Header().Set("Link", pagination.LinkHeader(page.Next, ""))
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, page)
+}
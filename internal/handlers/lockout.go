@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/IdrisovMarat/httpserver/internal/auth"
+	"github.com/IdrisovMarat/httpserver/internal/database"
+	"github.com/IdrisovMarat/httpserver/internal/helpers"
+	"github.com/google/uuid"
+)
+
+// Ключи счетчиков неудачных попыток входа (login_attempts.attempt_key)
+func emailAttemptKey(email string) string        { return "email:" + strings.ToLower(email) }
+func ipAttemptKey(ip string) string              { return "ip:" + ip }
+func mfaAttemptKey(userID uuid.UUID) string      { return "mfa:" + userID.String() }
+func sudoCodeAttemptKey(userID uuid.UUID) string { return "sudo-code:" + userID.String() }
+
+// loginAttempt - счетчик попыток входа по ключу и его политика блокировки
+type loginAttempt struct {
+	Key    string
+	Policy auth.LockoutPolicy
+}
+
+// beginLoginAttempt засчитывает попытку входа неудачной по всем счетчикам еще
+// до проверки пароля или кода и возвращает оставшееся время блокировки (0 -
+// попытку можно проверять). Счетчики блокируются FOR UPDATE, поэтому
+// параллельные запросы не проходят проверку блокировки все сразу: каждый видит
+// счетчик, увеличенный предыдущим, и блокировку, которую тот установил.
+// Успешную попытку сбрасывает ClearLoginAttempts или refundLoginAttempt
+func (cfg *ApiConfig) beginLoginAttempt(ctx context.Context, attempts ...loginAttempt) (time.Duration, error) {
+	policies := make(map[string]auth.LockoutPolicy, len(attempts))
+	keys := make([]string, 0, len(attempts))
+	for _, attempt := range attempts {
+		policies[attempt.Key] = attempt.Policy
+		keys = append(keys, attempt.Key)
+	}
+	// Одинаковый порядок блокировки строк исключает взаимные блокировки
+	slices.Sort(keys)
+
+	tx, err := cfg.DBConn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка проверки блокировки входа: %w", err)
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.Db.WithTx(tx)
+
+	if err := qtx.CreateLoginAttempts(ctx, keys); err != nil {
+		return 0, fmt.Errorf("ошибка проверки блокировки входа: %w", err)
+	}
+	rows, err := qtx.ListLoginAttemptsForUpdate(ctx, keys)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка проверки блокировки входа: %w", err)
+	}
+
+	now := time.Now()
+	var retryAfter time.Duration
+	for _, row := range rows {
+		if row.LockedUntil.Valid && row.LockedUntil.Time.After(now) {
+			retryAfter = max(retryAfter, row.LockedUntil.Time.Sub(now), time.Second)
+		}
+	}
+	if retryAfter > 0 {
+		return retryAfter, nil
+	}
+
+	for _, row := range rows {
+		policy := policies[row.AttemptKey]
+		failures := row.Failures + 1
+		// Счетчик начинается заново, если ошибок давно не было
+		if row.LastFailureAt.Before(now.Add(-policy.ResetAfter)) {
+			failures = 1
+		}
+
+		var lockedUntil sql.NullTime
+		if delay := policy.Delay(int(failures)); delay > 0 {
+			lockedUntil = sql.NullTime{Time: now.Add(delay), Valid: true}
+			log.Printf("🚨 SECURITY: %d неудачных попыток входа для %s, вход заблокирован на %v", failures, row.AttemptKey, delay)
+		}
+
+		err := qtx.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+			AttemptKey:  row.AttemptKey,
+			Failures:    failures,
+			LockedUntil: lockedUntil,
+		})
+		if err != nil {
+			return 0, fmt.Errorf("ошибка записи попытки входа %s: %w", row.AttemptKey, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("ошибка записи попытки входа: %w", err)
+	}
+	return 0, nil
+}
+
+// refundLoginAttempt возвращает попытку, засчитанную beginLoginAttempt, если
+// она оказалась успешной, но счетчик не сбрасывается (например, счетчик IP).
+// Ошибки БД только логируются: вход уже выполнен
+func (cfg *ApiConfig) refundLoginAttempt(ctx context.Context, attempt loginAttempt) {
+	err := cfg.Db.RefundLoginFailure(ctx, database.RefundLoginFailureParams{
+		FreeAttempts: int32(attempt.Policy.FreeAttempts),
+		AttemptKey:   attempt.Key,
+	})
+	if err != nil {
+		log.Printf("⚠️ Ошибка возврата попытки входа %s: %v", attempt.Key, err)
+	}
+}
+
+// respondLocked отвечает 429 с заголовком Retry-After (в секундах)
+func respondLocked(w http.ResponseWriter, retryAfter time.Duration) {
+	respondRateLimited(w, retryAfter, "Слишком много неудачных попыток входа. Повторите позже")
+}
+
+// UnlockUserHandler снимает блокировку входа пользователя (требует scope admin).
+// Параметр ?ip= дополнительно снимает блокировку с IP адреса
+func (cfg *ApiConfig) UnlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Требуется аутентификация")
+		return
+	}
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат ID пользователя")
+		return
+	}
+
+	dbUser, err := cfg.Db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.RespondWithError(w, http.StatusNotFound, "Пользователь не найден")
+			return
+		}
+		log.Printf("❌ Ошибка получения пользователя %s: %v", userID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	keys := []string{emailAttemptKey(dbUser.Email), mfaAttemptKey(dbUser.ID)}
+	if ip := r.URL.Query().Get("ip"); ip != "" {
+		keys = append(keys, ipAttemptKey(ip))
+	}
+
+	err = cfg.Db.ClearLoginAttempts(r.Context(), keys)
+	if err != nil {
+		log.Printf("❌ Ошибка снятия блокировки входа: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	// Production: Логируем снятие блокировки для аудита
+	log.Printf("🛡️ Администратор %s снял блокировку входа: %s", principal.UserID, strings.Join(keys, ", "))
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/IdrisovMarat/httpserver/internal/auth"
+	"github.com/IdrisovMarat/httpserver/internal/database"
+	"github.com/IdrisovMarat/httpserver/internal/helpers"
+	"github.com/IdrisovMarat/httpserver/internal/mailer"
+)
+
+const (
+	// magicLinkTTL - срок действия ссылки для входа без пароля
+	magicLinkTTL = 15 * time.Minute
+	// magicLinkCookie - cookie с nonce браузера, запросившего ссылку
+	magicLinkCookie = "chirpy_magic_link"
+	// magicLinkCookiePath - cookie отправляется только на endpoints входа по ссылке
+	magicLinkCookiePath = "/api/login/magic"
+)
+
+// setMagicLinkCookie сохраняет nonce в браузере. maxAge < 0 удаляет cookie
+func (cfg *ApiConfig) setMagicLinkCookie(w http.ResponseWriter, nonce string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     magicLinkCookie,
+		Value:    nonce,
+		Path:     magicLinkCookiePath,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   cfg.secureCookies(),
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// RequestMagicLinkHandler отправляет на email одноразовую ссылку для входа без
+// пароля и привязывает ее к браузеру через cookie. Production: ответ всегда 202,
+// чтобы по нему нельзя было узнать, зарегистрирован ли email
+func (cfg *ApiConfig) RequestMagicLinkHandler(w http.ResponseWriter, r *http.Request) {
+	if !cfg.MagicLinkLogin {
+		helpers.RespondWithError(w, http.StatusNotFound, "Вход по ссылке отключен")
+		return
+	}
+
+	type requestBody struct {
+		Email string `json:"email"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	reqBody := requestBody{}
+	err := decoder.Decode(&reqBody)
+	if err != nil {
+		log.Printf("❌ Ошибка декодирования JSON: %v", err)
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат запроса")
+		return
+	}
+
+	if reqBody.Email == "" {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Email обязателен")
+		return
+	}
+
+	if len(reqBody.Email) > 255 {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Email слишком длинный")
+		return
+	}
+
+	// 🛡️ Лимиты считаются до поиска пользователя и для незарегистрированного
+	// email тоже, поэтому 429 не выдает, зарегистрирован ли адрес
+	retryAfter, err := cfg.hitRateLimits(r.Context(),
+		rateLimitHit{Key: magicLinkIPKey(helpers.ClientIP(r, cfg.TrustProxy)), Limit: magicLinkIPLimit},
+		rateLimitHit{Key: magicLinkEmailKey(reqBody.Email), Limit: magicLinkEmailLimit},
+	)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+	if retryAfter > 0 {
+		respondRateLimited(w, retryAfter, "Слишком много запросов ссылки для входа. Повторите позже")
+		return
+	}
+
+	// Cookie выдается и для незарегистрированного email: ответы не отличаются
+	nonce, err := auth.MakeOneTimeToken()
+	if err != nil {
+		log.Printf("❌ Ошибка создания nonce для входа по ссылке: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+	cfg.setMagicLinkCookie(w, nonce, int(magicLinkTTL.Seconds()))
+
+	dbUser, err := cfg.Db.GetUserByEmail(r.Context(), reqBody.Email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			log.Printf("⚠️ Запрошен вход по ссылке для несуществующего email: %s", reqBody.Email)
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		log.Printf("❌ Ошибка поиска пользователя: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	token, err := auth.MakeOneTimeToken()
+	if err != nil {
+		log.Printf("❌ Ошибка создания токена входа по ссылке: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	// Действует только ссылка из последнего письма
+	err = cfg.Db.InvalidateMagicLinkTokens(r.Context(), dbUser.ID)
+	if err != nil {
+		log.Printf("❌ Ошибка аннулирования ссылок для входа: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	err = cfg.Db.CreateMagicLinkToken(r.Context(), database.CreateMagicLinkTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    dbUser.ID,
+		NonceHash: auth.HashToken(nonce),
+		ExpiresAt: time.Now().Add(magicLinkTTL),
+	})
+	if err != nil {
+		log.Printf("❌ Ошибка сохранения ссылки для входа: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	link := cfg.PublicURL + "/app/magic-login/#token=" + url.QueryEscape(token)
+
+	go cfg.sendMail(mailer.Message{
+		To:      dbUser.Email,
+		Subject: "Вход в Chirpy",
+		Body: fmt.Sprintf("Чтобы войти в Chirpy, перейдите по ссылке:\n\n%s\n\n"+
+			"Ссылка действует %d минут, может быть использована один раз и только в том браузере, "+
+			"где вы запросили вход.\n"+
+			"Если вы не пытались войти, просто проигнорируйте это письмо.\n",
+			link, int(magicLinkTTL.Minutes())),
+	})
+
+	log.Printf("📧 Отправлена ссылка для входа пользователю: %s", dbUser.ID)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ConfirmMagicLinkHandler выполняет вход по токену из письма. Ответ такой же,
+// как у POST /api/login (в том числе mfa_token при включенном TOTP)
+func (cfg *ApiConfig) ConfirmMagicLinkHandler(w http.ResponseWriter, r *http.Request) {
+	if !cfg.MagicLinkLogin {
+		helpers.RespondWithError(w, http.StatusNotFound, "Вход по ссылке отключен")
+		return
+	}
+
+	type requestBody struct {
+		Token string `json:"token"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	reqBody := requestBody{}
+	err := decoder.Decode(&reqBody)
+	if err != nil {
+		log.Printf("❌ Ошибка декодирования JSON: %v", err)
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат запроса")
+		return
+	}
+
+	// Production: Проверяем формат токена (должен быть 64 hex символа)
+	if len(reqBody.Token) != 64 {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверная или истекшая ссылка для входа")
+		return
+	}
+
+	// 🛡️ Ссылка, перехваченная из письма, бесполезна без cookie браузера
+	cookie, err := r.Cookie(magicLinkCookie)
+	if err != nil || cookie.Value == "" {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Откройте ссылку в том же браузере, где запрашивали вход")
+		return
+	}
+
+	magicLink, err := cfg.Db.ConsumeMagicLinkToken(r.Context(), database.ConsumeMagicLinkTokenParams{
+		TokenHash: auth.HashToken(reqBody.Token),
+		NonceHash: auth.HashToken(cookie.Value),
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			log.Printf("❌ Неверная, истекшая, использованная или открытая в другом браузере ссылка для входа: %s...", reqBody.Token[:8])
+			helpers.RespondWithError(w, http.StatusBadRequest, "Неверная или истекшая ссылка для входа")
+			return
+		}
+		log.Printf("❌ Ошибка проверки ссылки для входа: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	cfg.setMagicLinkCookie(w, "", -1)
+
+	dbUser, err := cfg.Db.GetUserByID(r.Context(), magicLink.UserID)
+	if err != nil {
+		log.Printf("❌ Ошибка получения пользователя %s: %v", magicLink.UserID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	log.Printf("🔑 Вход по ссылке из письма пользователя: %s", dbUser.ID)
+
+	cfg.completeLogin(w, r, dbUser)
+}
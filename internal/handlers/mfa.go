@@ -0,0 +1,418 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/IdrisovMarat/httpserver/internal/auth"
+	"github.com/IdrisovMarat/httpserver/internal/database"
+	"github.com/IdrisovMarat/httpserver/internal/helpers"
+)
+
+const (
+	// mfaTokenTTL - время на ввод второго фактора после проверки пароля
+	mfaTokenTTL = 5 * time.Minute
+	// totpIssuer - название сервиса в приложении-аутентификаторе
+	totpIssuer = "Chirpy"
+	// recoveryCodesCount - количество кодов восстановления, выдаваемых при включении TOTP
+	recoveryCodesCount = 10
+)
+
+// EnrollTOTPHandler начинает настройку TOTP: генерирует секрет и otpauth:// URI.
+// Требует подтверждения личности (sudo). TOTP включается только после
+// подтверждения кодом (ConfirmTOTPHandler)
+func (cfg *ApiConfig) EnrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Требуется аутентификация")
+		return
+	}
+	// 🔐 Второй фактор настраивает только сам пользователь после входа в Chirpy
+	if !requireInteractiveAuth(w, principal) {
+		return
+	}
+
+	type requestBody struct {
+		sudoProof
+	}
+
+	type response struct {
+		Secret     string `json:"secret"`      // Для ручного ввода в приложение
+		OtpauthURI string `json:"otpauth_uri"` // Для QR-кода
+	}
+
+	// Тело необязательно: с sudo токеном его можно не передавать
+	decoder := json.NewDecoder(r.Body)
+	reqBody := requestBody{}
+	err := decoder.Decode(&reqBody)
+	if err != nil && err != io.EOF {
+		log.Printf("❌ Ошибка декодирования JSON: %v", err)
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат запроса")
+		return
+	}
+
+	dbUser, err := cfg.Db.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		log.Printf("❌ Ошибка получения пользователя %s: %v", principal.UserID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	// Иначе украденный токен позволил бы привязать к аккаунту свое приложение
+	if !cfg.requireSudo(w, r, dbUser, reqBody.sudoProof) {
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		log.Printf("❌ Ошибка генерации TOTP секрета: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	// Повторный вызов до подтверждения заменяет секрет; включенный TOTP не меняется
+	rows, err := cfg.Db.SetUserTOTPSecret(r.Context(), database.SetUserTOTPSecretParams{
+		ID:         dbUser.ID,
+		TotpSecret: sql.NullString{String: secret, Valid: true},
+	})
+	if err != nil {
+		log.Printf("❌ Ошибка сохранения TOTP секрета: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+	if rows == 0 {
+		helpers.RespondWithError(w, http.StatusConflict, "Двухфакторная аутентификация уже включена")
+		return
+	}
+
+	log.Printf("🔐 Начата настройка TOTP для пользователя: %s", dbUser.ID)
+
+	helpers.RespondWithJSON(w, http.StatusOK, response{
+		Secret:     secret,
+		OtpauthURI: auth.TOTPURI(secret, dbUser.Email, totpIssuer),
+	})
+}
+
+// ConfirmTOTPHandler включает TOTP после проверки первого кода из приложения
+// и возвращает коды восстановления (показываются один раз)
+func (cfg *ApiConfig) ConfirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Требуется аутентификация")
+		return
+	}
+	if !requireInteractiveAuth(w, principal) {
+		return
+	}
+
+	type requestBody struct {
+		Code string `json:"code"`
+	}
+
+	type response struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	reqBody := requestBody{}
+	err := decoder.Decode(&reqBody)
+	if err != nil {
+		log.Printf("❌ Ошибка декодирования JSON: %v", err)
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат запроса")
+		return
+	}
+
+	dbUser, err := cfg.Db.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		log.Printf("❌ Ошибка получения пользователя %s: %v", principal.UserID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	if dbUser.TotpEnabledAt.Valid {
+		helpers.RespondWithError(w, http.StatusConflict, "Двухфакторная аутентификация уже включена")
+		return
+	}
+	if !dbUser.TotpSecret.Valid {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Сначала начните настройку TOTP")
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(dbUser.TotpSecret.String, reqBody.Code, time.Now())
+	if !ok {
+		log.Printf("❌ Неверный TOTP код при подтверждении для пользователя: %s", dbUser.ID)
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный код подтверждения")
+		return
+	}
+
+	recoveryCodes, err := auth.GenerateRecoveryCodes(recoveryCodesCount)
+	if err != nil {
+		log.Printf("❌ Ошибка генерации кодов восстановления: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	err = cfg.enableTOTP(r.Context(), dbUser, step, recoveryCodes)
+	if err != nil {
+		log.Printf("❌ Ошибка включения TOTP: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	log.Printf("✅ TOTP включен для пользователя: %s", dbUser.ID)
+
+	helpers.RespondWithJSON(w, http.StatusOK, response{RecoveryCodes: recoveryCodes})
+}
+
+// enableTOTP в одной транзакции включает TOTP и заменяет коды восстановления
+func (cfg *ApiConfig) enableTOTP(ctx context.Context, dbUser database.User, step int64, recoveryCodes []string) error {
+	tx, err := cfg.DBConn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.Db.WithTx(tx)
+
+	// Сохраняем шаг подтверждающего кода: он не должен сработать повторно при входе
+	err = qtx.EnableUserTOTP(ctx, database.EnableUserTOTPParams{
+		ID:           dbUser.ID,
+		TotpLastStep: step,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = qtx.DeleteRecoveryCodes(ctx, dbUser.ID)
+	if err != nil {
+		return err
+	}
+
+	// В базе храним только хеши кодов
+	for _, code := range recoveryCodes {
+		err = qtx.CreateRecoveryCode(ctx, database.CreateRecoveryCodeParams{
+			UserID:   dbUser.ID,
+			CodeHash: auth.HashRecoveryCode(code),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DisableTOTPHandler выключает TOTP. Требует подтверждения личности (sudo)
+// и действующий код или код восстановления
+func (cfg *ApiConfig) DisableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Требуется аутентификация")
+		return
+	}
+	if !requireInteractiveAuth(w, principal) {
+		return
+	}
+
+	// code и recovery_code из sudoProof - второй фактор для выключения TOTP
+	type requestBody struct {
+		sudoProof
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	reqBody := requestBody{}
+	err := decoder.Decode(&reqBody)
+	if err != nil {
+		log.Printf("❌ Ошибка декодирования JSON: %v", err)
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат запроса")
+		return
+	}
+
+	dbUser, err := cfg.Db.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		log.Printf("❌ Ошибка получения пользователя %s: %v", principal.UserID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	if !dbUser.TotpEnabledAt.Valid {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Двухфакторная аутентификация не включена")
+		return
+	}
+
+	// Без sudo токена requireSudo проверяет пароль вместе со вторым фактором
+	if !cfg.requireSudo(w, r, dbUser, reqBody.sudoProof) {
+		return
+	}
+	// С sudo токеном код в этом запросе еще не проверен
+	if r.Header.Get(sudoTokenHeader) != "" && !cfg.checkSecondFactor(w, r, dbUser, reqBody.Code, reqBody.RecoveryCode) {
+		return
+	}
+
+	err = cfg.Db.DisableUserTOTP(r.Context(), dbUser.ID)
+	if err != nil {
+		log.Printf("❌ Ошибка выключения TOTP: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	err = cfg.Db.DeleteRecoveryCodes(r.Context(), dbUser.ID)
+	if err != nil {
+		log.Printf("⚠️ Ошибка удаления кодов восстановления: %v", err)
+		// Не прерываем выполнение: без TOTP коды не используются
+	}
+
+	log.Printf("🔓 TOTP выключен для пользователя: %s", dbUser.ID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LoginMFAHandler - второй шаг входа: обменивает MFA токен из LoginHandler
+// и TOTP код (или код восстановления) на access и refresh токены
+func (cfg *ApiConfig) LoginMFAHandler(w http.ResponseWriter, r *http.Request) {
+	type requestBody struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	reqBody := requestBody{}
+	err := decoder.Decode(&reqBody)
+	if err != nil {
+		log.Printf("❌ Ошибка декодирования JSON: %v", err)
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат запроса")
+		return
+	}
+
+	if reqBody.Code == "" && reqBody.RecoveryCode == "" {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Необходимо указать code или recovery_code")
+		return
+	}
+
+	userID, err := cfg.Keys.ParseChallengeToken(reqBody.MFAToken, auth.AudienceMFA)
+	if err != nil {
+		log.Printf("❌ Неверный MFA токен: %v", err)
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Неверный или истекший MFA токен")
+		return
+	}
+
+	dbUser, err := cfg.Db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.RespondWithError(w, http.StatusUnauthorized, "Неверный или истекший MFA токен")
+			return
+		}
+		log.Printf("❌ Ошибка получения пользователя %s: %v", userID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	if dbUser.BannedAt.Valid {
+		helpers.RespondWithError(w, http.StatusForbidden, "Аккаунт заблокирован")
+		return
+	}
+
+	// TOTP могли выключить после выдачи MFA токена
+	if !dbUser.TotpEnabledAt.Valid {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Неверный или истекший MFA токен")
+		return
+	}
+
+	// 🛡️ Защита от перебора 6-значных кодов: попытка засчитывается
+	// неудачной до проверки кода
+	mfaKey := mfaAttemptKey(dbUser.ID)
+	retryAfter, err := cfg.beginLoginAttempt(r.Context(), loginAttempt{Key: mfaKey, Policy: auth.EmailLockoutPolicy})
+	if err != nil {
+		log.Printf("❌ %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+	if retryAfter > 0 {
+		respondLocked(w, retryAfter)
+		return
+	}
+
+	ok, err := cfg.verifySecondFactor(r.Context(), dbUser, reqBody.Code, reqBody.RecoveryCode)
+	if err != nil {
+		log.Printf("❌ Ошибка проверки второго фактора: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Неверный код подтверждения")
+		return
+	}
+
+	err = cfg.Db.ClearLoginAttempts(r.Context(), []string{mfaKey})
+	if err != nil {
+		log.Printf("⚠️ Ошибка сброса счетчика попыток входа: %v", err)
+	}
+
+	resp, err := cfg.issueTokens(r, dbUser)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось создать токен")
+		return
+	}
+
+	log.Printf("✅ Успешный вход пользователя с двухфакторной аутентификацией: %s", dbUser.ID)
+
+	cfg.respondWithLogin(w, resp)
+}
+
+// verifySecondFactor проверяет TOTP код или одноразовый код восстановления.
+// Принятый TOTP шаг и использованный код восстановления повторно не принимаются
+func (cfg *ApiConfig) verifySecondFactor(ctx context.Context, dbUser database.User, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		step, ok := auth.ValidateTOTP(dbUser.TotpSecret.String, code, time.Now())
+		if !ok {
+			log.Printf("❌ Неверный TOTP код для пользователя: %s", dbUser.ID)
+			return false, nil
+		}
+
+		// Атомарно сдвигаем последний шаг: параллельный запрос с тем же кодом не пройдет
+		rows, err := cfg.Db.UpdateTOTPLastStep(ctx, database.UpdateTOTPLastStepParams{
+			ID:           dbUser.ID,
+			TotpLastStep: step,
+		})
+		if err != nil {
+			return false, err
+		}
+		if rows == 0 {
+			log.Printf("⚠️ Повторное использование TOTP кода пользователем: %s", dbUser.ID)
+			return false, nil
+		}
+
+		return true, nil
+	}
+
+	if recoveryCode == "" {
+		return false, nil
+	}
+
+	rows, err := cfg.Db.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+		UserID:   dbUser.ID,
+		CodeHash: auth.HashRecoveryCode(recoveryCode),
+	})
+	if err != nil {
+		return false, err
+	}
+	if rows == 0 {
+		log.Printf("❌ Неверный код восстановления для пользователя: %s", dbUser.ID)
+		return false, nil
+	}
+
+	remaining, err := cfg.Db.CountUnusedRecoveryCodes(ctx, dbUser.ID)
+	if err != nil {
+		log.Printf("⚠️ Ошибка подсчета кодов восстановления: %v", err)
+	}
+	log.Printf("🔑 Использован код восстановления пользователя %s, осталось: %d", dbUser.ID, remaining)
+
+	return true, nil
+}
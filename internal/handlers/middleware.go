@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/IdrisovMarat/httpserver/internal/auth"
+	"github.com/IdrisovMarat/httpserver/internal/helpers"
+	"github.com/google/uuid"
+)
+
+// RequireAuth аутентифицирует запрос (см. authenticate), кладет auth.Principal
+// в контекст и проверяет, что у пользователя есть все scopes.
+// Scopes указываются при регистрации маршрута в main.go
+func (cfg *ApiConfig) RequireAuth(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := cfg.authenticate(w, r)
+			if !ok {
+				return
+			}
+
+			// 🔐 АВТОРИЗАЦИЯ: Проверяем scopes маршрута
+			for _, scope := range scopes {
+				if !principal.HasScope(scope) {
+					log.Printf("🚫 Пользователю %s (роль %s) не хватает scope %s для %s %s",
+						principal.UserID, principal.Role, scope, r.Method, r.URL.Path)
+					helpers.RespondWithError(w, http.StatusForbidden, "Недостаточно прав для выполнения этой операции")
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+// OptionalAuth пропускает анонимный запрос без auth.Principal в контексте, а
+// запрос с токеном аутентифицирует как RequireAuth: неверный или отозванный
+// токен из заголовка Authorization - ошибка, а не аноним. Неверный, истекший
+// или отозванный access token из cookie сессии удаляется, и запрос
+// обрабатывается как анонимный: иначе браузер с устаревшей cookie не смог бы
+// читать публичные страницы
+func (cfg *ApiConfig) OptionalAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" && cookieValue(r, accessTokenCookie) == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		principal, fromCookie, err := cfg.verifyToken(r)
+		if err != nil {
+			var authErr *authError
+			if fromCookie && errors.As(err, &authErr) && authErr.status == http.StatusUnauthorized {
+				log.Printf("🍪 Устаревшая cookie сессии %s %s: %v, запрос анонимный", r.Method, r.URL.Path, err)
+				cfg.setSessionCookie(w, accessTokenCookie, "", "/", -1, true)
+				next.ServeHTTP(w, r)
+				return
+			}
+			respondAuthError(w, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// authError - отказ в аутентификации с кодом и сообщением ответа клиенту
+type authError struct {
+	status  int
+	message string
+}
+
+func (e *authError) Error() string {
+	return e.message
+}
+
+// respondAuthError отвечает клиенту ошибкой verifyToken: отказом authError
+// или 500 при внутренней ошибке
+func respondAuthError(w http.ResponseWriter, err error) {
+	var authErr *authError
+	if errors.As(err, &authErr) {
+		helpers.RespondWithError(w, authErr.status, authErr.message)
+		return
+	}
+	helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+}
+
+// authenticate проверяет токен запроса (см. verifyToken). При ошибке отвечает
+// клиенту и возвращает false
+func (cfg *ApiConfig) authenticate(w http.ResponseWriter, r *http.Request) (auth.Principal, bool) {
+	principal, _, err := cfg.verifyToken(r)
+	if err != nil {
+		respondAuthError(w, err)
+		return auth.Principal{}, false
+	}
+	return principal, true
+}
+
+// verifyToken проверяет access token или персональный токен из заголовка
+// Authorization (или access token из cookie сессии с проверкой CSRF), его
+// отзыв и блокировку пользователя. fromCookie - токен взят из cookie сессии.
+// Отказ возвращается как *authError, остальные ошибки - внутренние
+func (cfg *ApiConfig) verifyToken(r *http.Request) (principal auth.Principal, fromCookie bool, err error) {
+	// 🔐 АУТЕНТИФИКАЦИЯ: Проверяем access token из заголовка, а без
+	// заголовка - из cookie сессии браузера
+	tokenString, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		tokenString = cookieValue(r, accessTokenCookie)
+		if tokenString == "" {
+			log.Printf("❌ Ошибка извлечения токена %s %s: %v", r.Method, r.URL.Path, err)
+			return auth.Principal{}, false, &authError{http.StatusUnauthorized, "Неверный или отсутствующий токен"}
+		}
+		fromCookie = true
+	}
+
+	if !fromCookie && auth.IsPersonalAccessToken(tokenString) {
+		principal, err = cfg.authenticatePersonalToken(r.Context(), tokenString)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				log.Printf("❌ Неверный, истекший или отозванный персональный токен %s %s", r.Method, r.URL.Path)
+				return auth.Principal{}, fromCookie, &authError{http.StatusUnauthorized, "Неверный токен"}
+			}
+			log.Printf("❌ Ошибка проверки персонального токена: %v", err)
+			return auth.Principal{}, fromCookie, err
+		}
+	} else {
+		principal, err = cfg.Keys.ParseAccessToken(tokenString)
+		if err != nil {
+			log.Printf("❌ Ошибка валидации токена %s %s: %v", r.Method, r.URL.Path, err)
+			return auth.Principal{}, fromCookie, &authError{http.StatusUnauthorized, "Неверный токен"}
+		}
+	}
+
+	// 🛡️ CSRF: браузер отправляет cookie и с запросами, инициированными
+	// чужим сайтом, поэтому изменяющий запрос должен повторить CSRF токен,
+	// к которому привязан access token
+	if fromCookie {
+		if principal.CSRFHash == "" {
+			log.Printf("❌ В cookie передан access token без CSRF привязки %s %s", r.Method, r.URL.Path)
+			return auth.Principal{}, fromCookie, &authError{http.StatusUnauthorized, "Неверный токен"}
+		}
+		if !auth.IsSafeMethod(r.Method) && !auth.CheckCSRFToken(r.Header.Get(auth.CSRFHeader), principal.CSRFHash) {
+			log.Printf("🚫 Неверный CSRF токен пользователя %s для %s %s", principal.UserID, r.Method, r.URL.Path)
+			return auth.Principal{}, fromCookie, &authError{http.StatusForbidden, "Неверный CSRF токен"}
+		}
+	}
+
+	// 🔐 Токен мог быть отозван после выдачи: сверяем версию и блокировку
+	state, err := cfg.TokenStates.Get(r.Context(), principal.UserID, cfg.loadTokenState)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			log.Printf("❌ Пользователь токена %s не найден", principal.UserID)
+			return auth.Principal{}, fromCookie, &authError{http.StatusUnauthorized, "Неверный токен"}
+		}
+		log.Printf("❌ Ошибка проверки версии токена: %v", err)
+		return auth.Principal{}, fromCookie, err
+	}
+	if state.Banned {
+		return auth.Principal{}, fromCookie, &authError{http.StatusForbidden, "Аккаунт заблокирован"}
+	}
+	// Персональные токены отзываются по отдельности и версией не ограничены
+	if principal.PersonalTokenID == uuid.Nil && principal.TokenVersion != state.Version {
+		log.Printf("❌ Отозванный access token пользователя %s (версия %d, актуальная %d)",
+			principal.UserID, principal.TokenVersion, state.Version)
+		return auth.Principal{}, fromCookie, &authError{http.StatusUnauthorized, "Токен отозван"}
+	}
+
+	return principal, fromCookie, nil
+}
+
+// authenticatePersonalToken проверяет персональный токен доступа и отмечает его
+// использование. sql.ErrNoRows означает неверный, истекший или отозванный токен
+func (cfg *ApiConfig) authenticatePersonalToken(ctx context.Context, token string) (auth.Principal, error) {
+	pat, err := cfg.Db.GetActivePersonalAccessToken(ctx, auth.HashToken(token))
+	if err != nil {
+		return auth.Principal{}, err
+	}
+
+	// Ошибка записи last_used_at не должна мешать запросу
+	if err := cfg.Db.TouchPersonalAccessToken(ctx, pat.ID); err != nil {
+		log.Printf("❌ Ошибка обновления last_used_at персонального токена %s: %v", pat.ID, err)
+	}
+
+	return auth.PersonalTokenPrincipal(pat.ID, pat.UserID, pat.Role, pat.Scopes), nil
+}
+
+// loadTokenState загружает из БД версию токенов и признак блокировки пользователя
+func (cfg *ApiConfig) loadTokenState(ctx context.Context, userID uuid.UUID) (auth.TokenState, error) {
+	row, err := cfg.Db.GetUserTokenState(ctx, userID)
+	if err != nil {
+		return auth.TokenState{}, err
+	}
+	return auth.TokenState{Version: row.TokenVersion, Banned: row.BannedAt.Valid}, nil
+}
+
+// revokeAccessTokens увеличивает версию токенов пользователя: все выданные
+// access tokens перестают приниматься сразу
+func (cfg *ApiConfig) revokeAccessTokens(ctx context.Context, userID uuid.UUID) error {
+	_, err := cfg.Db.BumpUserTokenVersion(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка отзыва access tokens: %w", err)
+	}
+	cfg.TokenStates.Invalidate(userID)
+	return nil
+}
@@ -0,0 +1,842 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/IdrisovMarat/httpserver/internal/auth"
+	"github.com/IdrisovMarat/httpserver/internal/database"
+	"github.com/IdrisovMarat/httpserver/internal/helpers"
+	"github.com/google/uuid"
+)
+
+// oauthCodeTTL - срок действия кода авторизации: клиент обменивает его на
+// токены сразу после redirect
+const oauthCodeTTL = time.Minute
+
+// scopeDescriptions - описания scopes для страницы согласия
+var scopeDescriptions = map[string]string{
+	auth.ScopeChirpsWrite:    "Публиковать и удалять chirps от вашего имени",
+	auth.ScopeUsersWrite:     "Изменять настройки вашего аккаунта",
+	auth.ScopeChirpsModerate: "Модерировать chirps (если вы модератор)",
+}
+
+// oauthError - ошибка протокола OAuth 2.0 (RFC 6749 4.1.2.1 и 5.2). Клиенту
+// отдается в формате {error, error_description}, а не в обычном формате API
+type oauthError struct {
+	Status      int
+	Code        string
+	Description string
+}
+
+func (e *oauthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// respondOAuthError отвечает на запрос к endpoint токенов ошибкой OAuth.
+// Ошибки, не относящиеся к протоколу, логируются и становятся server_error
+func respondOAuthError(w http.ResponseWriter, err error) {
+	var oerr *oauthError
+	if !errors.As(err, &oerr) {
+		log.Printf("❌ %v", err)
+		oerr = &oauthError{Status: http.StatusInternalServerError, Code: "server_error", Description: "Внутренняя ошибка сервера"}
+	}
+
+	if oerr.Code == "invalid_client" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	helpers.RespondWithJSON(w, oerr.Status, map[string]string{
+		"error":             oerr.Code,
+		"error_description": oerr.Description,
+	})
+}
+
+// authorizationRequest - проверенный запрос авторизации (RFC 6749 4.1.1)
+type authorizationRequest struct {
+	Client        database.OauthClient
+	RedirectURI   string
+	Scopes        []string
+	State         string
+	CodeChallenge string
+}
+
+// parseAuthorizationRequest проверяет параметры запроса авторизации. Пока
+// client_id и redirect_uri не проверены, RedirectURI результата пуст: о такой
+// ошибке нельзя сообщить клиенту через redirect (RFC 6749 4.1.2.1)
+func (cfg *ApiConfig) parseAuthorizationRequest(ctx context.Context, params url.Values) (authorizationRequest, error) {
+	req := authorizationRequest{}
+
+	clientID, err := uuid.Parse(params.Get("client_id"))
+	if err != nil {
+		return req, &oauthError{Status: http.StatusBadRequest, Code: "invalid_request", Description: "Неизвестное приложение"}
+	}
+	client, err := cfg.Db.GetOAuthClient(ctx, clientID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return req, &oauthError{Status: http.StatusBadRequest, Code: "invalid_request", Description: "Неизвестное приложение"}
+		}
+		return req, fmt.Errorf("ошибка получения OAuth клиента %s: %w", clientID, err)
+	}
+
+	// 🛡️ redirect_uri сравнивается точно: иначе код ушел бы на чужой адрес
+	redirectURI := params.Get("redirect_uri")
+	if redirectURI == "" && len(client.RedirectUris) == 1 {
+		redirectURI = client.RedirectUris[0]
+	}
+	if !slices.Contains(client.RedirectUris, redirectURI) {
+		return req, &oauthError{Status: http.StatusBadRequest, Code: "invalid_request", Description: "redirect_uri не зарегистрирован для приложения"}
+	}
+
+	req.Client = client
+	req.RedirectURI = redirectURI
+	req.State = params.Get("state")
+
+	if params.Get("response_type") != "code" {
+		return req, &oauthError{Status: http.StatusBadRequest, Code: "unsupported_response_type", Description: "Поддерживается только response_type=code"}
+	}
+
+	// PKCE обязателен для всех клиентов, метод plain не принимается
+	if params.Get("code_challenge_method") != "S256" || !auth.IsValidCodeChallenge(params.Get("code_challenge")) {
+		return req, &oauthError{Status: http.StatusBadRequest, Code: "invalid_request", Description: "Требуется PKCE: code_challenge и code_challenge_method=S256"}
+	}
+	req.CodeChallenge = params.Get("code_challenge")
+
+	req.Scopes = auth.ParseScope(params.Get("scope"))
+	if len(req.Scopes) == 0 {
+		req.Scopes = client.Scopes
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(client.Scopes, scope) {
+			return req, &oauthError{Status: http.StatusBadRequest, Code: "invalid_scope", Description: "Scope не разрешен приложению: " + scope}
+		}
+	}
+
+	return req, nil
+}
+
+// redirectToClient возвращает браузер на redirect_uri клиента с параметрами
+// ответа (code или error) и state из запроса
+func redirectToClient(w http.ResponseWriter, r *http.Request, req authorizationRequest, params url.Values) {
+	u, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		log.Printf("❌ Ошибка разбора redirect_uri %s: %v", req.RedirectURI, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	query := u.Query()
+	for key := range params {
+		query.Set(key, params.Get(key))
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	u.RawQuery = query.Encode()
+
+	http.Redirect(w, r, u.String(), http.StatusSeeOther)
+}
+
+// consentField - скрытое поле формы согласия с параметром запроса авторизации
+type consentField struct {
+	Name  string
+	Value string
+}
+
+// consentPage - данные страницы согласия. Без ClientName показывается только ошибка
+type consentPage struct {
+	ClientName   string
+	RedirectHost string
+	Scopes       []string
+	Fields       []consentField
+	Email        string
+	Error        string
+}
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head>
+  <meta charset="utf-8">
+  <title>Доступ к аккаунту Chirpy</title>
+</head>
+<body>
+  {{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+  {{if .ClientName}}
+  <h1>Приложение «{{.ClientName}}» запрашивает доступ к вашему аккаунту Chirpy</h1>
+  <p>Приложение сможет:</p>
+  <ul>
+    {{range .Scopes}}<li>{{.}}</li>{{end}}
+    <li>Читать данные вашего аккаунта</li>
+  </ul>
+  <form method="post" action="/oauth/authorize">
+    {{range .Fields}}<input type="hidden" name="{{.Name}}" value="{{.Value}}">
+    {{end}}
+    <p><label>Email <input type="email" name="email" value="{{.Email}}" autocomplete="username"></label></p>
+    <p><label>Пароль <input type="password" name="password" autocomplete="current-password"></label></p>
+    <p><label>Код из приложения 2FA (если включена) <input name="code" inputmode="numeric" autocomplete="one-time-code"></label></p>
+    <button type="submit" name="decision" value="approve">Разрешить</button>
+    <button type="submit" name="decision" value="deny">Отклонить</button>
+  </form>
+  <p>После ответа вы вернетесь на {{.RedirectHost}}</p>
+  {{end}}
+</body>
+</html>
+`))
+
+// consentPageFor собирает страницу согласия для проверенного запроса
+func consentPageFor(req authorizationRequest, email, errMsg string) consentPage {
+	page := consentPage{
+		ClientName: req.Client.Name,
+		Email:      email,
+		Error:      errMsg,
+		Fields: []consentField{
+			{Name: "client_id", Value: req.Client.ID.String()},
+			{Name: "redirect_uri", Value: req.RedirectURI},
+			{Name: "response_type", Value: "code"},
+			{Name: "scope", Value: strings.Join(req.Scopes, " ")},
+			{Name: "state", Value: req.State},
+			{Name: "code_challenge", Value: req.CodeChallenge},
+			{Name: "code_challenge_method", Value: "S256"},
+		},
+	}
+	if u, err := url.Parse(req.RedirectURI); err == nil {
+		page.RedirectHost = u.Host
+	}
+	for _, scope := range req.Scopes {
+		page.Scopes = append(page.Scopes, scopeDescriptions[scope])
+	}
+	return page
+}
+
+// renderConsent отдает страницу согласия
+func renderConsent(w http.ResponseWriter, status int, page consentPage) {
+	w.Header().Set("Content-Type", helpers.ContentTypeHTML)
+	w.Header().Set("Cache-Control", "no-store")
+	// 🛡️ Защита от clickjacking: страницу нельзя встроить в чужой iframe
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+	w.WriteHeader(status)
+
+	if err := consentTemplate.Execute(w, page); err != nil {
+		log.Printf("Ошибка записи страницы согласия: %v", err)
+	}
+}
+
+// respondAuthorizeError сообщает об ошибке запроса авторизации: через
+// redirect к клиенту, если redirect_uri уже проверен, иначе на странице
+func respondAuthorizeError(w http.ResponseWriter, r *http.Request, req authorizationRequest, err error) {
+	var oerr *oauthError
+	if !errors.As(err, &oerr) {
+		log.Printf("❌ %v", err)
+		renderConsent(w, http.StatusInternalServerError, consentPage{Error: "Внутренняя ошибка сервера"})
+		return
+	}
+
+	if req.RedirectURI == "" {
+		renderConsent(w, oerr.Status, consentPage{Error: oerr.Description})
+		return
+	}
+
+	redirectToClient(w, r, req, url.Values{
+		"error":             {oerr.Code},
+		"error_description": {oerr.Description},
+	})
+}
+
+// OAuthAuthorizeHandler показывает страницу согласия на доступ приложения
+// к аккаунту (authorization code flow, RFC 6749 4.1)
+func (cfg *ApiConfig) OAuthAuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	req, err := cfg.parseAuthorizationRequest(r.Context(), r.URL.Query())
+	if err != nil {
+		respondAuthorizeError(w, r, req, err)
+		return
+	}
+
+	renderConsent(w, http.StatusOK, consentPageFor(req, "", ""))
+}
+
+// OAuthConsentHandler принимает ответ пользователя со страницы согласия:
+// проверяет его email, пароль и TOTP и возвращает клиенту код авторизации
+func (cfg *ApiConfig) OAuthConsentHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		renderConsent(w, http.StatusBadRequest, consentPage{Error: "Неверный формат запроса"})
+		return
+	}
+
+	req, err := cfg.parseAuthorizationRequest(r.Context(), r.PostForm)
+	if err != nil {
+		respondAuthorizeError(w, r, req, err)
+		return
+	}
+
+	if r.PostForm.Get("decision") != "approve" {
+		log.Printf("⚠️ Пользователь отказал приложению %s в доступе", req.Client.ID)
+		redirectToClient(w, r, req, url.Values{
+			"error":             {"access_denied"},
+			"error_description": {"Пользователь отказал в доступе"},
+		})
+		return
+	}
+
+	email := r.PostForm.Get("email")
+	dbUser, err := cfg.consentLogin(r, email, r.PostForm.Get("password"), r.PostForm.Get("code"))
+	if err != nil {
+		var oerr *oauthError
+		if !errors.As(err, &oerr) {
+			log.Printf("❌ %v", err)
+			renderConsent(w, http.StatusInternalServerError, consentPageFor(req, email, "Внутренняя ошибка сервера"))
+			return
+		}
+		renderConsent(w, oerr.Status, consentPageFor(req, email, oerr.Description))
+		return
+	}
+
+	code, err := auth.MakeOneTimeToken()
+	if err != nil {
+		respondAuthorizeError(w, r, req, fmt.Errorf("ошибка создания кода авторизации: %w", err))
+		return
+	}
+
+	// Необмененные коды не копятся в таблице
+	if err := cfg.Db.DeleteExpiredOAuthAuthorizationCodes(r.Context()); err != nil {
+		log.Printf("⚠️ Ошибка удаления истекших кодов авторизации: %v", err)
+	}
+
+	err = cfg.Db.CreateOAuthAuthorizationCode(r.Context(), database.CreateOAuthAuthorizationCodeParams{
+		CodeHash:      auth.HashToken(code),
+		ClientID:      req.Client.ID,
+		UserID:        dbUser.ID,
+		RedirectUri:   req.RedirectURI,
+		Scopes:        req.Scopes,
+		CodeChallenge: req.CodeChallenge,
+		FamilyID:      uuid.New(),
+		ExpiresAt:     time.Now().Add(oauthCodeTTL),
+	})
+	if err != nil {
+		respondAuthorizeError(w, r, req, fmt.Errorf("ошибка сохранения кода авторизации: %w", err))
+		return
+	}
+
+	log.Printf("🔑 Пользователь %s разрешил приложению %s доступ (%v)", dbUser.ID, req.Client.ID, req.Scopes)
+
+	redirectToClient(w, r, req, url.Values{"code": {code}})
+}
+
+// consentLogin проверяет email, пароль и TOTP код со страницы согласия с той
+// же защитой от перебора, что и вход через POST /api/login. Ошибка
+// *oauthError содержит текст для страницы и HTTP статус
+func (cfg *ApiConfig) consentLogin(r *http.Request, email, password, code string) (database.User, error) {
+	ctx := r.Context()
+
+	if email == "" || password == "" {
+		return database.User{}, &oauthError{Status: http.StatusBadRequest, Description: "Введите email и пароль"}
+	}
+	if len(email) > 255 {
+		return database.User{}, &oauthError{Status: http.StatusBadRequest, Description: "Email слишком длинный"}
+	}
+
+	// 🛡️ Защита от перебора: общие с POST /api/login счетчики по email и IP
+	emailKey := emailAttemptKey(email)
+	ipAttempt := loginAttempt{Key: ipAttemptKey(helpers.ClientIP(r, cfg.TrustProxy)), Policy: auth.IPLockoutPolicy}
+	errLocked := &oauthError{Status: http.StatusTooManyRequests, Description: "Слишком много неудачных попыток входа. Повторите позже"}
+	errInvalid := &oauthError{Status: http.StatusUnauthorized, Description: "Неверный email или пароль"}
+
+	retryAfter, err := cfg.beginLoginAttempt(ctx, loginAttempt{Key: emailKey, Policy: auth.EmailLockoutPolicy}, ipAttempt)
+	if err != nil {
+		return database.User{}, err
+	}
+	if retryAfter > 0 {
+		return database.User{}, errLocked
+	}
+
+	dbUser, err := cfg.Db.GetUserByEmail(ctx, email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			auth.CheckDummyPassword(password)
+			return database.User{}, errInvalid
+		}
+		return database.User{}, fmt.Errorf("ошибка поиска пользователя: %w", err)
+	}
+
+	if dbUser.HashedPassword == auth.UnsetPasswordHash {
+		auth.CheckDummyPassword(password)
+		return database.User{}, &oauthError{Status: http.StatusForbidden, Description: "Пароль не установлен. Задайте пароль через сброс пароля"}
+	}
+
+	match, err := auth.CheckPasswordHash(password, dbUser.HashedPassword)
+	if err != nil {
+		return database.User{}, fmt.Errorf("ошибка проверки пароля: %w", err)
+	}
+	if !match {
+		log.Printf("❌ Неверный пароль на странице согласия для пользователя: %s", dbUser.ID)
+		return database.User{}, errInvalid
+	}
+
+	if err := cfg.Db.ClearLoginAttempts(ctx, []string{emailKey}); err != nil {
+		log.Printf("⚠️ Ошибка сброса счетчика попыток входа: %v", err)
+	}
+	cfg.refundLoginAttempt(ctx, ipAttempt)
+	if auth.NeedsRehash(dbUser.HashedPassword) {
+		cfg.rehashPassword(ctx, dbUser, password)
+	}
+
+	if dbUser.BannedAt.Valid {
+		return database.User{}, &oauthError{Status: http.StatusForbidden, Description: "Аккаунт заблокирован"}
+	}
+
+	// 🔐 2FA: при включенном TOTP согласие требует и второй фактор
+	if dbUser.TotpEnabledAt.Valid {
+		if code == "" {
+			return database.User{}, &oauthError{Status: http.StatusUnauthorized, Description: "Введите код из приложения 2FA"}
+		}
+
+		mfaKey := mfaAttemptKey(dbUser.ID)
+		retryAfter, err := cfg.beginLoginAttempt(ctx, loginAttempt{Key: mfaKey, Policy: auth.EmailLockoutPolicy})
+		if err != nil {
+			return database.User{}, err
+		}
+		if retryAfter > 0 {
+			return database.User{}, errLocked
+		}
+		ok, err := cfg.verifySecondFactor(ctx, dbUser, code, "")
+		if err != nil {
+			return database.User{}, fmt.Errorf("ошибка проверки второго фактора: %w", err)
+		}
+		if !ok {
+			return database.User{}, &oauthError{Status: http.StatusUnauthorized, Description: "Неверный код подтверждения"}
+		}
+		if err := cfg.Db.ClearLoginAttempts(ctx, []string{mfaKey}); err != nil {
+			log.Printf("⚠️ Ошибка сброса счетчика попыток входа: %v", err)
+		}
+	}
+
+	return dbUser, nil
+}
+
+// oauthTokenResponse - ответ endpoint токенов (RFC 6749 5.1)
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+// authenticateOAuthClient проверяет клиента endpoint токенов: client_secret
+// через HTTP Basic (RFC 6749 2.3.1) или в теле запроса. Публичный клиент
+// передает только client_id
+func (cfg *ApiConfig) authenticateOAuthClient(r *http.Request) (database.OauthClient, error) {
+	errInvalidClient := &oauthError{Status: http.StatusUnauthorized, Code: "invalid_client", Description: "Неверная аутентификация приложения"}
+
+	rawID, secret, hasBasic := r.BasicAuth()
+	if hasBasic {
+		// Значения Basic закодированы как application/x-www-form-urlencoded
+		var errID, errSecret error
+		rawID, errID = url.QueryUnescape(rawID)
+		secret, errSecret = url.QueryUnescape(secret)
+		if errID != nil || errSecret != nil {
+			return database.OauthClient{}, errInvalidClient
+		}
+	} else {
+		rawID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	clientID, err := uuid.Parse(rawID)
+	if err != nil {
+		return database.OauthClient{}, errInvalidClient
+	}
+
+	client, err := cfg.Db.GetOAuthClient(r.Context(), clientID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return database.OauthClient{}, errInvalidClient
+		}
+		return database.OauthClient{}, fmt.Errorf("ошибка получения OAuth клиента %s: %w", clientID, err)
+	}
+
+	if client.SecretHash.Valid && !auth.CheckOAuthClientSecret(secret, client.SecretHash.String) {
+		log.Printf("❌ Неверный client_secret приложения %s", clientID)
+		return database.OauthClient{}, errInvalidClient
+	}
+
+	return client, nil
+}
+
+// OAuthTokenHandler выдает токены приложению: обмен кода авторизации
+// (с проверкой PKCE) и обновление по refresh token (RFC 6749 4.1.3 и 6)
+func (cfg *ApiConfig) OAuthTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondOAuthError(w, &oauthError{Status: http.StatusBadRequest, Code: "invalid_request", Description: "Неверный формат запроса"})
+		return
+	}
+
+	client, err := cfg.authenticateOAuthClient(r)
+	if err != nil {
+		respondOAuthError(w, err)
+		return
+	}
+
+	var resp oauthTokenResponse
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		resp, err = cfg.exchangeAuthorizationCode(r, client)
+	case "refresh_token":
+		resp, err = cfg.refreshOAuthToken(r, client)
+	default:
+		err = &oauthError{Status: http.StatusBadRequest, Code: "unsupported_grant_type", Description: "Поддерживаются authorization_code и refresh_token"}
+	}
+	if err != nil {
+		respondOAuthError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	helpers.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// exchangeAuthorizationCode обменивает код авторизации на access и refresh
+// токены, открывая сессию, заданную при выдаче кода
+func (cfg *ApiConfig) exchangeAuthorizationCode(r *http.Request, client database.OauthClient) (oauthTokenResponse, error) {
+	errInvalidGrant := &oauthError{Status: http.StatusBadRequest, Code: "invalid_grant", Description: "Неверный или истекший код авторизации"}
+
+	code := r.PostForm.Get("code")
+	if len(code) != 64 {
+		return oauthTokenResponse{}, errInvalidGrant
+	}
+
+	authCode, err := cfg.Db.ConsumeOAuthAuthorizationCode(r.Context(), auth.HashToken(code))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return oauthTokenResponse{}, fmt.Errorf("ошибка проверки кода авторизации: %w", err)
+		}
+
+		// 🚨 БЕЗОПАСНОСТЬ: повторный обмен кода - код перехвачен. Отзываем
+		// токены, уже выданные по нему (RFC 6749 4.1.2)
+		usedCode, err := cfg.Db.GetUsedOAuthAuthorizationCode(r.Context(), auth.HashToken(code))
+		if err == nil {
+			log.Printf("🚨 SECURITY: повторное использование кода авторизации приложения %s, отзываем семейство %s",
+				usedCode.ClientID, usedCode.FamilyID)
+			if err := cfg.Db.RevokeRefreshTokenFamily(r.Context(), usedCode.FamilyID); err != nil {
+				return oauthTokenResponse{}, fmt.Errorf("ошибка отзыва семейства refresh tokens %s: %w", usedCode.FamilyID, err)
+			}
+		} else if err != sql.ErrNoRows {
+			return oauthTokenResponse{}, fmt.Errorf("ошибка проверки кода авторизации: %w", err)
+		}
+		return oauthTokenResponse{}, errInvalidGrant
+	}
+
+	if authCode.ClientID != client.ID || authCode.RedirectUri != r.PostForm.Get("redirect_uri") {
+		log.Printf("❌ Код авторизации предъявлен с другим client_id или redirect_uri (приложение %s)", client.ID)
+		return oauthTokenResponse{}, errInvalidGrant
+	}
+	if !auth.VerifyCodeChallenge(r.PostForm.Get("code_verifier"), authCode.CodeChallenge) {
+		log.Printf("❌ Неверный code_verifier при обмене кода приложением %s", client.ID)
+		return oauthTokenResponse{}, errInvalidGrant
+	}
+
+	dbUser, err := cfg.Db.GetUserByID(r.Context(), authCode.UserID)
+	if err != nil {
+		return oauthTokenResponse{}, fmt.Errorf("ошибка получения пользователя %s: %w", authCode.UserID, err)
+	}
+	if dbUser.BannedAt.Valid {
+		return oauthTokenResponse{}, &oauthError{Status: http.StatusBadRequest, Code: "invalid_grant", Description: "Аккаунт заблокирован"}
+	}
+
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return oauthTokenResponse{}, fmt.Errorf("ошибка создания refresh token: %w", err)
+	}
+
+	userAgent, ip := cfg.clientInfo(r)
+	_, err = cfg.Db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		TokenHash: auth.HashToken(refreshToken),
+		UserID:    dbUser.ID,
+		ExpiresAt: time.Now().Add(refreshTokenTTL),
+		FamilyID:  authCode.FamilyID,
+		UserAgent: userAgent,
+		Ip:        ip,
+		ClientID:  uuid.NullUUID{UUID: client.ID, Valid: true},
+		Scopes:    authCode.Scopes,
+	})
+	if err != nil {
+		return oauthTokenResponse{}, fmt.Errorf("ошибка сохранения refresh token: %w", err)
+	}
+
+	log.Printf("🔐 Приложение %s получило токены пользователя %s (семейство %s)", client.ID, dbUser.ID, authCode.FamilyID)
+
+	return cfg.makeOAuthTokens(dbUser, client.ID, authCode.FamilyID, authCode.Scopes, refreshToken)
+}
+
+// refreshOAuthToken ротирует refresh token приложения так же, как
+// POST /api/refresh, и выдает новый access token с согласованными scopes.
+// Параметр scope может только сузить scopes нового access token
+func (cfg *ApiConfig) refreshOAuthToken(r *http.Request, client database.OauthClient) (oauthTokenResponse, error) {
+	errInvalidGrant := &oauthError{Status: http.StatusBadRequest, Code: "invalid_grant", Description: "Неверный или истекший refresh token"}
+
+	tokenString := r.PostForm.Get("refresh_token")
+	if len(tokenString) != 64 {
+		return oauthTokenResponse{}, errInvalidGrant
+	}
+
+	dbToken, err := cfg.Db.GetRefreshToken(r.Context(), auth.HashToken(tokenString))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return oauthTokenResponse{}, errInvalidGrant
+		}
+		return oauthTokenResponse{}, fmt.Errorf("ошибка поиска refresh token: %w", err)
+	}
+
+	// 🔐 Токен выдан другому приложению (или это токен входа в Chirpy)
+	if !dbToken.ClientID.Valid || dbToken.ClientID.UUID != client.ID {
+		log.Printf("❌ Приложение %s предъявило чужой refresh token", client.ID)
+		return oauthTokenResponse{}, errInvalidGrant
+	}
+
+	if dbToken.RevokedAt.Valid {
+		// 🚨 БЕЗОПАСНОСТЬ: повторное использование ротированного токена
+		if dbToken.ReplacedByHash.Valid {
+			log.Printf("🚨 SECURITY: повторное использование ротированного refresh token приложения %s, отзываем семейство %s",
+				client.ID, dbToken.FamilyID)
+			if err := cfg.Db.RevokeRefreshTokenFamily(r.Context(), dbToken.FamilyID); err != nil {
+				return oauthTokenResponse{}, fmt.Errorf("ошибка отзыва семейства refresh tokens %s: %w", dbToken.FamilyID, err)
+			}
+		}
+		return oauthTokenResponse{}, errInvalidGrant
+	}
+	if time.Now().After(dbToken.ExpiresAt) {
+		return oauthTokenResponse{}, errInvalidGrant
+	}
+
+	scopes := dbToken.Scopes
+	if requested := auth.ParseScope(r.PostForm.Get("scope")); len(requested) > 0 {
+		for _, scope := range requested {
+			if !slices.Contains(dbToken.Scopes, scope) {
+				return oauthTokenResponse{}, &oauthError{Status: http.StatusBadRequest, Code: "invalid_scope", Description: "Scope не был согласован: " + scope}
+			}
+		}
+		scopes = requested
+	}
+
+	dbUser, err := cfg.Db.GetUserByID(r.Context(), dbToken.UserID)
+	if err != nil {
+		return oauthTokenResponse{}, fmt.Errorf("ошибка получения пользователя %s: %w", dbToken.UserID, err)
+	}
+	if dbUser.BannedAt.Valid {
+		return oauthTokenResponse{}, &oauthError{Status: http.StatusBadRequest, Code: "invalid_grant", Description: "Аккаунт заблокирован"}
+	}
+
+	newRefreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return oauthTokenResponse{}, fmt.Errorf("ошибка создания refresh token: %w", err)
+	}
+
+	err = cfg.rotateRefreshToken(r, dbToken, newRefreshToken)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// Токен был ротирован параллельным запросом между чтением и обновлением
+			return oauthTokenResponse{}, errInvalidGrant
+		}
+		return oauthTokenResponse{}, fmt.Errorf("ошибка ротации refresh token: %w", err)
+	}
+
+	log.Printf("🔄 Приложение %s обновило токены пользователя %s (семейство %s)", client.ID, dbUser.ID, dbToken.FamilyID)
+
+	return cfg.makeOAuthTokens(dbUser, client.ID, dbToken.FamilyID, scopes, newRefreshToken)
+}
+
+// makeOAuthTokens создает access token приложения и собирает ответ
+// endpoint токенов. В scope попадают только scopes, которые есть у роли
+func (cfg *ApiConfig) makeOAuthTokens(dbUser database.User, clientID, familyID uuid.UUID, scopes []string, refreshToken string) (oauthTokenResponse, error) {
+	accessToken, err := cfg.Keys.MakeAccessToken(auth.Principal{
+		UserID:       dbUser.ID,
+		Role:         dbUser.Role,
+		Scopes:       scopes,
+		SessionID:    familyID,
+		TokenVersion: dbUser.TokenVersion,
+		ClientID:     clientID.String(),
+	}, AccessTokenTTL)
+	if err != nil {
+		return oauthTokenResponse{}, fmt.Errorf("ошибка создания access token: %w", err)
+	}
+
+	return oauthTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(AccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        strings.Join(auth.GrantedScopes(dbUser.Role, scopes), " "),
+	}, nil
+}
+
+// OAuthRevokeHandler отзывает токен приложения (RFC 7009). Отзыв refresh или
+// access token завершает всю сессию: refresh tokens перестают действовать,
+// выданные access tokens - по истечении срока. Для чужих и неизвестных
+// токенов ответ тоже 200
+func (cfg *ApiConfig) OAuthRevokeHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondOAuthError(w, &oauthError{Status: http.StatusBadRequest, Code: "invalid_request", Description: "Неверный формат запроса"})
+		return
+	}
+
+	client, err := cfg.authenticateOAuthClient(r)
+	if err != nil {
+		respondOAuthError(w, err)
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		respondOAuthError(w, &oauthError{Status: http.StatusBadRequest, Code: "invalid_request", Description: "Параметр token обязателен"})
+		return
+	}
+
+	familyID, ok, err := cfg.oauthTokenFamily(r.Context(), client, token)
+	if err != nil {
+		respondOAuthError(w, err)
+		return
+	}
+
+	if ok {
+		if err := cfg.Db.RevokeRefreshTokenFamily(r.Context(), familyID); err != nil {
+			respondOAuthError(w, fmt.Errorf("ошибка отзыва семейства refresh tokens %s: %w", familyID, err))
+			return
+		}
+		log.Printf("🔐 Приложение %s отозвало токены сессии %s", client.ID, familyID)
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+// oauthTokenFamily находит сессию (семейство refresh tokens) refresh или
+// access token, выданного приложению. ok == false - токен неизвестен или чужой
+func (cfg *ApiConfig) oauthTokenFamily(ctx context.Context, client database.OauthClient, token string) (uuid.UUID, bool, error) {
+	if len(token) == 64 {
+		dbToken, err := cfg.Db.GetRefreshToken(ctx, auth.HashToken(token))
+		if err == sql.ErrNoRows {
+			return uuid.Nil, false, nil
+		}
+		if err != nil {
+			return uuid.Nil, false, fmt.Errorf("ошибка поиска refresh token: %w", err)
+		}
+		ok := dbToken.ClientID.Valid && dbToken.ClientID.UUID == client.ID
+		return dbToken.FamilyID, ok, nil
+	}
+
+	principal, err := cfg.Keys.ParseAccessToken(token)
+	if err != nil || principal.ClientID != client.ID.String() || principal.SessionID == uuid.Nil {
+		return uuid.Nil, false, nil
+	}
+	return principal.SessionID, true, nil
+}
+
+// OAuthIntrospectHandler сообщает приложению, действует ли его токен и с
+// какими scopes (RFC 7662). Токены других приложений, удаленных приложений и
+// отозванных сессий считаются неактивными
+func (cfg *ApiConfig) OAuthIntrospectHandler(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Active    bool   `json:"active"`
+		Scope     string `json:"scope,omitempty"`
+		ClientID  string `json:"client_id,omitempty"`
+		Subject   string `json:"sub,omitempty"`
+		TokenType string `json:"token_type,omitempty"`
+		ExpiresAt int64  `json:"exp,omitempty"`
+	}
+
+	if err := r.ParseForm(); err != nil {
+		respondOAuthError(w, &oauthError{Status: http.StatusBadRequest, Code: "invalid_request", Description: "Неверный формат запроса"})
+		return
+	}
+
+	client, err := cfg.authenticateOAuthClient(r)
+	if err != nil {
+		respondOAuthError(w, err)
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		respondOAuthError(w, &oauthError{Status: http.StatusBadRequest, Code: "invalid_request", Description: "Параметр token обязателен"})
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	inactive := response{Active: false}
+
+	// tokenVersion задан для access token: он отзывается версией токенов
+	// пользователя, как в RequireAuth
+	var userID, familyID uuid.UUID
+	var tokenVersion *int32
+	resp := response{Active: true, ClientID: client.ID.String()}
+
+	if len(token) == 64 {
+		dbToken, err := cfg.Db.GetRefreshToken(r.Context(), auth.HashToken(token))
+		if err != nil && err != sql.ErrNoRows {
+			respondOAuthError(w, fmt.Errorf("ошибка поиска refresh token: %w", err))
+			return
+		}
+		if err == sql.ErrNoRows || !dbToken.ClientID.Valid || dbToken.ClientID.UUID != client.ID ||
+			dbToken.RevokedAt.Valid || time.Now().After(dbToken.ExpiresAt) {
+			helpers.RespondWithJSON(w, http.StatusOK, inactive)
+			return
+		}
+
+		userID = dbToken.UserID
+		familyID = dbToken.FamilyID
+		resp.Scope = strings.Join(dbToken.Scopes, " ")
+		resp.TokenType = "refresh_token"
+		resp.ExpiresAt = dbToken.ExpiresAt.Unix()
+	} else {
+		principal, err := cfg.Keys.ParseAccessToken(token)
+		if err != nil || principal.ClientID != client.ID.String() || principal.SessionID == uuid.Nil {
+			helpers.RespondWithJSON(w, http.StatusOK, inactive)
+			return
+		}
+
+		userID = principal.UserID
+		familyID = principal.SessionID
+		tokenVersion = &principal.TokenVersion
+		resp.Scope = strings.Join(principal.Scopes, " ")
+		resp.TokenType = "Bearer"
+		resp.ExpiresAt = principal.ExpiresAt.Unix()
+	}
+
+	// 🔐 Access token живет до exp и после отзыва сессии или удаления
+	// приложения: проверяем, что его семейство refresh tokens еще действует.
+	// Клиент проверяется и здесь, а не только при аутентификации: его могли
+	// удалить параллельно
+	active, err := cfg.Db.IsOAuthSessionActive(r.Context(), database.IsOAuthSessionActiveParams{
+		FamilyID: familyID,
+		ClientID: uuid.NullUUID{UUID: client.ID, Valid: true},
+	})
+	if err != nil {
+		respondOAuthError(w, fmt.Errorf("ошибка проверки сессии приложения: %w", err))
+		return
+	}
+	if !active {
+		helpers.RespondWithJSON(w, http.StatusOK, inactive)
+		return
+	}
+
+	state, err := cfg.TokenStates.Get(r.Context(), userID, cfg.loadTokenState)
+	if err != nil && err != sql.ErrNoRows {
+		respondOAuthError(w, fmt.Errorf("ошибка проверки версии токена: %w", err))
+		return
+	}
+	if err == sql.ErrNoRows || state.Banned || (tokenVersion != nil && *tokenVersion != state.Version) {
+		helpers.RespondWithJSON(w, http.StatusOK, inactive)
+		return
+	}
+
+	resp.Subject = userID.String()
+	helpers.RespondWithJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/IdrisovMarat/httpserver/internal/auth"
+	"github.com/IdrisovMarat/httpserver/internal/database"
+	"github.com/IdrisovMarat/httpserver/internal/helpers"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxOAuthClientNameLength - максимальная длина названия приложения
+	maxOAuthClientNameLength = 100
+	// maxRedirectURIs - максимальное число redirect_uri одного клиента
+	maxRedirectURIs = 10
+	// maxRedirectURILength - максимальная длина одного redirect_uri
+	maxRedirectURILength = 2000
+)
+
+// OAuthClient - зарегистрированное стороннее приложение. Секрет
+// (ClientSecret) возвращается только при регистрации
+type OAuthClient struct {
+	ID           uuid.UUID `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	// Confidential - клиент с секретом (серверное приложение); публичные
+	// клиенты (SPA, мобильные) защищены только PKCE
+	Confidential bool      `json:"confidential"`
+	CreatedAt    time.Time `json:"created_at"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+}
+
+func oauthClientFromDB(dbClient database.OauthClient) OAuthClient {
+	return OAuthClient{
+		ID:           dbClient.ID,
+		Name:         dbClient.Name,
+		RedirectURIs: dbClient.RedirectUris,
+		Scopes:       dbClient.Scopes,
+		Confidential: dbClient.SecretHash.Valid,
+		CreatedAt:    dbClient.CreatedAt,
+	}
+}
+
+// isValidRedirectURI проверяет redirect_uri при регистрации клиента: абсолютный
+// https адрес без fragment (RFC 6749 3.1.2). http разрешен только для
+// loopback адресов нативных приложений (RFC 8252 7.3)
+func isValidRedirectURI(raw string) bool {
+	if len(raw) > maxRedirectURILength {
+		return false
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.Fragment != "" || u.User != nil {
+		return false
+	}
+
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := u.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	default:
+		return false
+	}
+}
+
+// CreateOAuthClientHandler регистрирует стороннее приложение. Для
+// конфиденциального клиента возвращает client_secret (показывается один раз)
+func (cfg *ApiConfig) CreateOAuthClientHandler(w http.ResponseWriter, r *http.Request) {
+	type requestBody struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Scopes       []string `json:"scopes"`
+		Confidential bool     `json:"confidential"`
+	}
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Требуется аутентификация")
+		return
+	}
+	if !requireInteractiveAuth(w, principal) {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	reqBody := requestBody{}
+	err := decoder.Decode(&reqBody)
+	if err != nil {
+		log.Printf("❌ Ошибка декодирования JSON: %v", err)
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат запроса")
+		return
+	}
+
+	if reqBody.Name == "" {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Название приложения обязательно")
+		return
+	}
+	if len(reqBody.Name) > maxOAuthClientNameLength {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Название приложения слишком длинное")
+		return
+	}
+
+	if len(reqBody.RedirectURIs) == 0 || len(reqBody.RedirectURIs) > maxRedirectURIs {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Укажите от 1 до 10 redirect_uris")
+		return
+	}
+	for _, redirectURI := range reqBody.RedirectURIs {
+		if !isValidRedirectURI(redirectURI) {
+			helpers.RespondWithError(w, http.StatusBadRequest,
+				"Недопустимый redirect_uri (нужен https или http://localhost): "+redirectURI)
+			return
+		}
+	}
+
+	if len(reqBody.Scopes) == 0 {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Укажите хотя бы один scope")
+		return
+	}
+	scopes := make([]string, 0, len(reqBody.Scopes))
+	for _, scope := range reqBody.Scopes {
+		if !auth.IsOAuthScope(scope) {
+			helpers.RespondWithError(w, http.StatusBadRequest, "Недопустимый scope: "+scope)
+			return
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	var secret string
+	var secretHash sql.NullString
+	if reqBody.Confidential {
+		secret, err = auth.MakeOAuthClientSecret()
+		if err != nil {
+			log.Printf("❌ Ошибка создания секрета OAuth клиента: %v", err)
+			helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+	}
+
+	dbClient, err := cfg.Db.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		OwnerID:      principal.UserID,
+		Name:         reqBody.Name,
+		SecretHash:   secretHash,
+		RedirectUris: reqBody.RedirectURIs,
+		Scopes:       scopes,
+	})
+	if err != nil {
+		log.Printf("❌ Ошибка сохранения OAuth клиента: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	log.Printf("🔑 Пользователь %s зарегистрировал OAuth клиента %s (%v)", principal.UserID, dbClient.ID, scopes)
+
+	resp := oauthClientFromDB(dbClient)
+	resp.ClientSecret = secret
+	helpers.RespondWithJSON(w, http.StatusCreated, resp)
+}
+
+// ListOAuthClientsHandler возвращает приложения, зарегистрированные
+// пользователем (без секретов)
+func (cfg *ApiConfig) ListOAuthClientsHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Требуется аутентификация")
+		return
+	}
+
+	dbClients, err := cfg.Db.ListOAuthClients(r.Context(), principal.UserID)
+	if err != nil {
+		log.Printf("❌ Ошибка получения OAuth клиентов пользователя %s: %v", principal.UserID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	clients := make([]OAuthClient, 0, len(dbClients))
+	for _, dbClient := range dbClients {
+		clients = append(clients, oauthClientFromDB(dbClient))
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, clients)
+}
+
+// DeleteOAuthClientHandler удаляет приложение пользователя и отзывает все
+// выданные ему refresh tokens. Access tokens действуют до истечения срока
+func (cfg *ApiConfig) DeleteOAuthClientHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Требуется аутентификация")
+		return
+	}
+	if !requireInteractiveAuth(w, principal) {
+		return
+	}
+
+	clientID, err := uuid.Parse(r.PathValue("clientID"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат client_id")
+		return
+	}
+
+	rows, err := cfg.deleteOAuthClient(r.Context(), clientID, principal.UserID)
+	if err != nil {
+		log.Printf("❌ Ошибка удаления OAuth клиента %s: %v", clientID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+	if rows == 0 {
+		helpers.RespondWithError(w, http.StatusNotFound, "Приложение не найдено")
+		return
+	}
+
+	log.Printf("🗑️ Пользователь %s удалил OAuth клиента %s", principal.UserID, clientID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteOAuthClient в одной транзакции помечает клиента удаленным и отзывает
+// его refresh tokens. 0 строк - клиент не найден или принадлежит другому пользователю
+func (cfg *ApiConfig) deleteOAuthClient(ctx context.Context, clientID, ownerID uuid.UUID) (int64, error) {
+	tx, err := cfg.DBConn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.Db.WithTx(tx)
+
+	// 🔐 АВТОРИЗАЦИЯ: запрос ограничен клиентами текущего пользователя
+	rows, err := qtx.RevokeOAuthClient(ctx, database.RevokeOAuthClientParams{
+		ID:      clientID,
+		OwnerID: ownerID,
+	})
+	if err != nil || rows == 0 {
+		return 0, err
+	}
+
+	err = qtx.RevokeOAuthClientTokens(ctx, uuid.NullUUID{UUID: clientID, Valid: true})
+	if err != nil {
+		return 0, err
+	}
+
+	return rows, tx.Commit()
+}
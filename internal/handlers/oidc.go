@@ -0,0 +1,544 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/IdrisovMarat/httpserver/internal/auth"
+	"github.com/IdrisovMarat/httpserver/internal/database"
+	"github.com/IdrisovMarat/httpserver/internal/helpers"
+	"github.com/IdrisovMarat/httpserver/internal/oidc"
+	"github.com/google/uuid"
+)
+
+const (
+	// oidcStateTTL - сколько пользователь может провести на странице провайдера
+	oidcStateTTL = 10 * time.Minute
+	// oidcBrowserCookie - cookie браузера, начавшего вход через провайдера
+	oidcBrowserCookie = "chirpy_oidc"
+	// oidcBrowserCookiePath - cookie отправляется только на endpoints входа через провайдеров
+	oidcBrowserCookiePath = "/api/auth/"
+	// oidcLoginCodeTTL - срок действия кода, с которым callback возвращает браузер в приложение
+	oidcLoginCodeTTL = time.Minute
+	// oidcAppPath - страница приложения, завершающая вход и привязку аккаунта
+	oidcAppPath = "/app/oidc/"
+)
+
+var (
+	// errIdentityNoEmail - провайдер не передал email, а без него нельзя создать пользователя
+	errIdentityNoEmail = errors.New("провайдер не передал email")
+	// errIdentityEmailUnverified - провайдер не подтвердил email: создать
+	// пользователя с этим адресом значило бы занять чужой email
+	errIdentityEmailUnverified = errors.New("провайдер не подтвердил email")
+	// errIdentityEmailTaken - email занят пользователем, с которым нельзя
+	// безопасно связать внешний аккаунт автоматически
+	errIdentityEmailTaken = errors.New("email уже зарегистрирован")
+)
+
+// Identity - внешний аккаунт, привязанный к пользователю
+type Identity struct {
+	ID        uuid.UUID `json:"id"`
+	Provider  string    `json:"provider"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// oidcProvider возвращает провайдер из пути запроса или отвечает 404
+func (cfg *ApiConfig) oidcProvider(w http.ResponseWriter, r *http.Request) (oidc.Provider, bool) {
+	provider, ok := cfg.OIDCProviders[r.PathValue("provider")]
+	if !ok {
+		helpers.RespondWithError(w, http.StatusNotFound, "Провайдер входа не найден")
+		return nil, false
+	}
+	return provider, true
+}
+
+// setOIDCBrowserCookie сохраняет в браузере одноразовую cookie входа через
+// провайдера. SameSite=Lax: cookie должна прийти с redirect от провайдера.
+// maxAge < 0 удаляет cookie
+func (cfg *ApiConfig) setOIDCBrowserCookie(w http.ResponseWriter, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcBrowserCookie,
+		Value:    value,
+		Path:     oidcBrowserCookiePath,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   cfg.secureCookies(),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// startOIDCFlow сохраняет state, nonce и PKCE verifier нового входа через
+// провайдера, привязывает вход к браузеру через cookie и возвращает адрес
+// страницы входа провайдера. linkUserID задан, если внешний аккаунт
+// привязывается к уже вошедшему пользователю
+func (cfg *ApiConfig) startOIDCFlow(ctx context.Context, w http.ResponseWriter, provider oidc.Provider, linkUserID uuid.NullUUID) (string, error) {
+	state, err := auth.MakeOneTimeToken()
+	if err != nil {
+		return "", err
+	}
+	browserNonce, err := auth.MakeOneTimeToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := auth.MakeOneTimeToken()
+	if err != nil {
+		return "", err
+	}
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		return "", err
+	}
+
+	// Брошенные на странице провайдера входы не копятся в таблице
+	if err := cfg.Db.DeleteExpiredOIDCLoginStates(ctx); err != nil {
+		log.Printf("⚠️ Ошибка удаления истекших OIDC state: %v", err)
+	}
+
+	err = cfg.Db.CreateOIDCLoginState(ctx, database.CreateOIDCLoginStateParams{
+		StateHash:    auth.HashToken(state),
+		Provider:     provider.Name(),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		LinkUserID:   linkUserID,
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+		BrowserHash:  auth.HashToken(browserNonce),
+	})
+	if err != nil {
+		return "", fmt.Errorf("ошибка сохранения OIDC state: %w", err)
+	}
+
+	// 🛡️ Без cookie callback не примет state: чужая ссылка на callback с
+	// кодом злоумышленника не войдет в браузере жертвы в его аккаунт
+	cfg.setOIDCBrowserCookie(w, browserNonce, int(oidcStateTTL.Seconds()))
+
+	return provider.AuthCodeURL(state, nonce, oidc.CodeChallengeS256(verifier)), nil
+}
+
+// OIDCLoginHandler перенаправляет браузер на страницу входа провайдера
+func (cfg *ApiConfig) OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := cfg.oidcProvider(w, r)
+	if !ok {
+		return
+	}
+
+	authURL, err := cfg.startOIDCFlow(r.Context(), w, provider, uuid.NullUUID{})
+	if err != nil {
+		log.Printf("❌ %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCLinkHandler начинает привязку внешнего аккаунта к текущему пользователю.
+// Требует подтверждения личности (current_password или X-Sudo-Token) и
+// возвращает адрес страницы входа провайдера
+func (cfg *ApiConfig) OIDCLinkHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Требуется аутентификация")
+		return
+	}
+	if !requireInteractiveAuth(w, principal) {
+		return
+	}
+
+	provider, ok := cfg.oidcProvider(w, r)
+	if !ok {
+		return
+	}
+
+	type requestBody struct {
+		sudoProof
+	}
+
+	type response struct {
+		AuthorizationURL string `json:"authorization_url"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	reqBody := requestBody{}
+	err := decoder.Decode(&reqBody)
+	if err != nil && err != io.EOF {
+		log.Printf("❌ Ошибка декодирования JSON: %v", err)
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат запроса")
+		return
+	}
+
+	dbUser, err := cfg.Db.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		log.Printf("❌ Ошибка получения пользователя %s: %v", principal.UserID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	// 🔐 Привязанный чужой аккаунт провайдера дал бы постоянный доступ к аккаунту
+	if !cfg.requireSudo(w, r, dbUser, reqBody.sudoProof) {
+		return
+	}
+
+	authURL, err := cfg.startOIDCFlow(r.Context(), w, provider, uuid.NullUUID{UUID: dbUser.ID, Valid: true})
+	if err != nil {
+		log.Printf("❌ %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, response{AuthorizationURL: authURL})
+}
+
+// OIDCCallbackHandler принимает пользователя, вернувшегося от провайдера:
+// проверяет state и cookie браузера, начавшего вход, обменивает код на ID
+// token и возвращает браузер в приложение (/app/oidc/) с одноразовым кодом
+// входа для POST /api/auth/exchange или после привязки внешнего аккаунта,
+// если flow начат через OIDCLinkHandler
+func (cfg *ApiConfig) OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := cfg.oidcProvider(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		log.Printf("⚠️ Провайдер %s вернул ошибку: %s %s", provider.Name(), providerErr, query.Get("error_description"))
+		helpers.RespondWithError(w, http.StatusBadRequest, "Вход через провайдера не выполнен: "+providerErr)
+		return
+	}
+
+	state, code := query.Get("state"), query.Get("code")
+	if state == "" || code == "" {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Отсутствует state или code")
+		return
+	}
+
+	cookie, err := r.Cookie(oidcBrowserCookie)
+	if err != nil || cookie.Value == "" {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Завершите вход в том же браузере, где его начали")
+		return
+	}
+
+	// 🛡️ state защищает от CSRF: callback принимается только для входа,
+	// начатого у нас и в этом же браузере
+	loginState, err := cfg.Db.ConsumeOIDCLoginState(r.Context(), database.ConsumeOIDCLoginStateParams{
+		StateHash:   auth.HashToken(state),
+		BrowserHash: auth.HashToken(cookie.Value),
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.RespondWithError(w, http.StatusBadRequest, "Неверный или истекший state, начните вход заново")
+			return
+		}
+		log.Printf("❌ Ошибка проверки OIDC state: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+	// Cookie одноразовая, как и state
+	cfg.setOIDCBrowserCookie(w, "", -1)
+
+	if loginState.Provider != provider.Name() {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный или истекший state, начните вход заново")
+		return
+	}
+
+	identity, err := provider.Exchange(r.Context(), code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Не удалось подтвердить вход через провайдера")
+		return
+	}
+
+	if loginState.LinkUserID.Valid {
+		if !cfg.linkIdentity(w, r, loginState.LinkUserID.UUID, provider.Name(), identity) {
+			return
+		}
+		http.Redirect(w, r, oidcAppPath+"#linked="+url.QueryEscape(provider.Name()), http.StatusFound)
+		return
+	}
+
+	dbUser, err := cfg.userForIdentity(r.Context(), provider.Name(), identity)
+	if err != nil {
+		switch {
+		case errors.Is(err, errIdentityNoEmail):
+			helpers.RespondWithError(w, http.StatusBadRequest, "Провайдер не передал email, вход невозможен")
+		case errors.Is(err, errIdentityEmailUnverified):
+			helpers.RespondWithError(w, http.StatusForbidden,
+				"Провайдер не подтвердил email: зарегистрируйтесь по email и привяжите аккаунт провайдера")
+		case errors.Is(err, errIdentityEmailTaken):
+			helpers.RespondWithError(w, http.StatusConflict,
+				"Email уже зарегистрирован: войдите по паролю и привяжите аккаунт провайдера")
+		default:
+			log.Printf("❌ Ошибка входа через провайдера %s: %v", provider.Name(), err)
+			helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		}
+		return
+	}
+
+	// Токены не отдаются в ответ на redirect браузера: приложение получает их
+	// по одноразовому коду, привязанному к этому же браузеру новой cookie
+	loginCode, err := auth.MakeOneTimeToken()
+	if err != nil {
+		log.Printf("❌ Ошибка создания кода входа: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+	browserNonce, err := auth.MakeOneTimeToken()
+	if err != nil {
+		log.Printf("❌ Ошибка создания nonce входа: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	if err := cfg.Db.DeleteExpiredOIDCLoginCodes(r.Context()); err != nil {
+		log.Printf("⚠️ Ошибка удаления истекших кодов входа: %v", err)
+	}
+
+	err = cfg.Db.CreateOIDCLoginCode(r.Context(), database.CreateOIDCLoginCodeParams{
+		CodeHash:    auth.HashToken(loginCode),
+		UserID:      dbUser.ID,
+		BrowserHash: auth.HashToken(browserNonce),
+		ExpiresAt:   time.Now().Add(oidcLoginCodeTTL),
+	})
+	if err != nil {
+		log.Printf("❌ Ошибка сохранения кода входа: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+	cfg.setOIDCBrowserCookie(w, browserNonce, int(oidcLoginCodeTTL.Seconds()))
+
+	log.Printf("🔑 Вход через провайдера %s пользователя: %s", provider.Name(), dbUser.ID)
+
+	// Код во фрагменте URL не попадает в логи сервера и заголовок Referer
+	http.Redirect(w, r, oidcAppPath+"#code="+url.QueryEscape(loginCode), http.StatusFound)
+}
+
+// OIDCExchangeHandler завершает вход через провайдера: обменивает одноразовый
+// код из redirect callback на токены. Ответ такой же, как у POST /api/login
+// (в том числе mfa_token при включенном TOTP и cookie при X-Auth-Mode: cookie)
+func (cfg *ApiConfig) OIDCExchangeHandler(w http.ResponseWriter, r *http.Request) {
+	type requestBody struct {
+		Code string `json:"code"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	reqBody := requestBody{}
+	err := decoder.Decode(&reqBody)
+	if err != nil {
+		log.Printf("❌ Ошибка декодирования JSON: %v", err)
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат запроса")
+		return
+	}
+
+	// Production: Проверяем формат кода (должен быть 64 hex символа)
+	if len(reqBody.Code) != 64 {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный или истекший код входа")
+		return
+	}
+
+	cookie, err := r.Cookie(oidcBrowserCookie)
+	if err != nil || cookie.Value == "" {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Завершите вход в том же браузере, где его начали")
+		return
+	}
+
+	loginCode, err := cfg.Db.ConsumeOIDCLoginCode(r.Context(), database.ConsumeOIDCLoginCodeParams{
+		CodeHash:    auth.HashToken(reqBody.Code),
+		BrowserHash: auth.HashToken(cookie.Value),
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.RespondWithError(w, http.StatusBadRequest, "Неверный или истекший код входа, начните вход заново")
+			return
+		}
+		log.Printf("❌ Ошибка проверки кода входа: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+	cfg.setOIDCBrowserCookie(w, "", -1)
+
+	dbUser, err := cfg.Db.GetUserByID(r.Context(), loginCode.UserID)
+	if err != nil {
+		log.Printf("❌ Ошибка получения пользователя %s: %v", loginCode.UserID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	cfg.completeLogin(w, r, dbUser)
+}
+
+// linkIdentity привязывает проверенный внешний аккаунт к пользователю. При
+// ошибке сам отвечает клиенту и возвращает false
+func (cfg *ApiConfig) linkIdentity(w http.ResponseWriter, r *http.Request, userID uuid.UUID, provider string, identity oidc.Identity) bool {
+	_, err := cfg.Db.CreateUserIdentity(r.Context(), database.CreateUserIdentityParams{
+		UserID:   userID,
+		Provider: provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "unique") {
+			helpers.RespondWithError(w, http.StatusConflict, "Этот аккаунт провайдера уже привязан")
+			return false
+		}
+		log.Printf("❌ Ошибка привязки аккаунта провайдера %s: %v", provider, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return false
+	}
+
+	log.Printf("🔗 Пользователь %s привязал аккаунт провайдера %s", userID, provider)
+
+	return true
+}
+
+// ListIdentitiesHandler возвращает внешние аккаунты текущего пользователя
+func (cfg *ApiConfig) ListIdentitiesHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Требуется аутентификация")
+		return
+	}
+
+	dbIdentities, err := cfg.Db.ListUserIdentities(r.Context(), principal.UserID)
+	if err != nil {
+		log.Printf("❌ Ошибка получения внешних аккаунтов пользователя %s: %v", principal.UserID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	identities := make([]Identity, 0, len(dbIdentities))
+	for _, dbIdentity := range dbIdentities {
+		identities = append(identities, Identity{
+			ID:        dbIdentity.ID,
+			Provider:  dbIdentity.Provider,
+			Email:     dbIdentity.Email,
+			CreatedAt: dbIdentity.CreatedAt,
+		})
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, identities)
+}
+
+// UnlinkIdentityHandler отвязывает внешний аккаунт от текущего пользователя
+func (cfg *ApiConfig) UnlinkIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Требуется аутентификация")
+		return
+	}
+	if !requireInteractiveAuth(w, principal) {
+		return
+	}
+
+	identityID, err := uuid.Parse(r.PathValue("identityID"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат ID внешнего аккаунта")
+		return
+	}
+
+	// 🔐 АВТОРИЗАЦИЯ: запрос ограничен аккаунтами текущего пользователя
+	rows, err := cfg.Db.DeleteUserIdentity(r.Context(), database.DeleteUserIdentityParams{
+		ID:     identityID,
+		UserID: principal.UserID,
+	})
+	if err != nil {
+		log.Printf("❌ Ошибка отвязки внешнего аккаунта %s: %v", identityID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+	if rows == 0 {
+		helpers.RespondWithError(w, http.StatusNotFound, "Внешний аккаунт не найден")
+		return
+	}
+
+	log.Printf("🔗 Пользователь %s отвязал внешний аккаунт %s", principal.UserID, identityID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// userForIdentity находит пользователя внешнего аккаунта. При первом входе
+// аккаунт связывается с существующим пользователем, только если email
+// подтвержден и провайдером, и у нас; иначе создается новый пользователь
+// без пароля - тоже только с подтвержденным провайдером email
+func (cfg *ApiConfig) userForIdentity(ctx context.Context, provider string, identity oidc.Identity) (database.User, error) {
+	dbUser, err := cfg.Db.GetUserByIdentity(ctx, database.GetUserByIdentityParams{
+		Provider: provider,
+		Subject:  identity.Subject,
+	})
+	if err == nil {
+		if err := cfg.Db.TouchUserIdentity(ctx, database.TouchUserIdentityParams{Provider: provider, Subject: identity.Subject}); err != nil {
+			log.Printf("⚠️ Ошибка обновления last_login_at внешнего аккаунта: %v", err)
+		}
+		return dbUser, nil
+	}
+	if err != sql.ErrNoRows {
+		return database.User{}, err
+	}
+
+	if identity.Email == "" {
+		return database.User{}, errIdentityNoEmail
+	}
+
+	tx, err := cfg.DBConn.BeginTx(ctx, nil)
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.Db.WithTx(tx)
+
+	created := false
+	dbUser, err = qtx.GetUserByEmail(ctx, identity.Email)
+	switch {
+	case err == nil:
+		// 🛡️ Без двойного подтверждения email чужой аккаунт провайдера
+		// с тем же адресом получил бы доступ к пользователю
+		if !identity.EmailVerified || !dbUser.EmailVerifiedAt.Valid {
+			return database.User{}, errIdentityEmailTaken
+		}
+	case err == sql.ErrNoRows:
+		// 🛡️ Иначе любой аккаунт провайдера с чужим адресом занял бы этот email
+		if !identity.EmailVerified {
+			return database.User{}, errIdentityEmailUnverified
+		}
+		dbUser, err = qtx.CreateExternalUser(ctx, database.CreateExternalUserParams{
+			Email:           identity.Email,
+			EmailVerifiedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		})
+		if err != nil {
+			return database.User{}, err
+		}
+		created = true
+	default:
+		return database.User{}, err
+	}
+
+	_, err = qtx.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+		UserID:   dbUser.ID,
+		Provider: provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return database.User{}, err
+	}
+
+	if created {
+		log.Printf("✅ Создан пользователь %s при первом входе через %s", dbUser.ID, provider)
+	}
+
+	return dbUser, nil
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/IdrisovMarat/httpserver/internal/helpers"
+)
+
+// checkPasswordPolicy проверяет новый пароль пользователя с указанным email.
+// При нарушениях сам отвечает клиенту ошибками по полю password и возвращает false
+func (cfg *ApiConfig) checkPasswordPolicy(w http.ResponseWriter, r *http.Request, password, email string) bool {
+	violations, err := cfg.PasswordPolicy.Check(r.Context(), password, email)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return false
+	}
+	if len(violations) == 0 {
+		return true
+	}
+
+	fields := make([]helpers.FieldError, 0, len(violations))
+	for _, v := range violations {
+		fields = append(fields, helpers.FieldError{Field: "password", Code: v.Code, Message: v.Message})
+	}
+	helpers.RespondWithValidationErrors(w, fields)
+	return false
+}
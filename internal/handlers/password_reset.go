@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/IdrisovMarat/httpserver/internal/auth"
+	"github.com/IdrisovMarat/httpserver/internal/database"
+	"github.com/IdrisovMarat/httpserver/internal/helpers"
+	"github.com/IdrisovMarat/httpserver/internal/mailer"
+)
+
+const (
+	// passwordResetTTL - срок действия ссылки для сброса пароля
+	passwordResetTTL = time.Hour
+	// mailSendTimeout - максимальное время отправки одного письма
+	mailSendTimeout = 30 * time.Second
+)
+
+// RequestPasswordResetHandler отправляет на email ссылку для сброса пароля.
+// Production: ответ всегда 202 (или 429 при превышении лимита), чтобы по нему
+// нельзя было узнать, зарегистрирован ли email
+func (cfg *ApiConfig) RequestPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	type requestBody struct {
+		Email string `json:"email"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	reqBody := requestBody{}
+	err := decoder.Decode(&reqBody)
+	if err != nil {
+		log.Printf("❌ Ошибка декодирования JSON: %v", err)
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат запроса")
+		return
+	}
+
+	if reqBody.Email == "" {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Email обязателен")
+		return
+	}
+
+	if len(reqBody.Email) > 255 {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Email слишком длинный")
+		return
+	}
+
+	retryAfter, err := cfg.startPasswordReset(r.Context(), reqBody.Email, helpers.ClientIP(r, cfg.TrustProxy))
+	if err != nil {
+		log.Printf("❌ %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+	if retryAfter > 0 {
+		respondRateLimited(w, retryAfter, "Слишком много запросов сброса пароля. Повторите позже")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// startPasswordReset учитывает запрос сброса пароля в лимитах для email и IP
+// и, если они не превышены, запускает в фоне отправку ссылки. Лимиты
+// считаются и для незарегистрированного email, а поиск пользователя идет уже
+// после ответа, поэтому ни ответ, ни его время не выдают, существует ли аккаунт.
+// Возвращает, через сколько можно повторить (0 - запрос принят)
+func (cfg *ApiConfig) startPasswordReset(ctx context.Context, email, ip string) (time.Duration, error) {
+	retryAfter, err := cfg.hitRateLimits(ctx,
+		rateLimitHit{Key: passwordResetIPKey(ip), Limit: passwordResetIPLimit},
+		rateLimitHit{Key: passwordResetEmailKey(email), Limit: passwordResetEmailLimit},
+	)
+	if err != nil || retryAfter > 0 {
+		return retryAfter, err
+	}
+
+	go cfg.sendPasswordReset(email)
+
+	return 0, nil
+}
+
+// sendPasswordReset создает токен сброса и отправляет ссылку, если email
+// зарегистрирован. Выполняется после ответа клиенту, ошибки только логируются
+func (cfg *ApiConfig) sendPasswordReset(email string) {
+	ctx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+	defer cancel()
+
+	dbUser, err := cfg.Db.GetUserByEmail(ctx, email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			log.Printf("⚠️ Запрошен сброс пароля для несуществующего email: %s", email)
+			return
+		}
+		log.Printf("❌ Ошибка поиска пользователя: %v", err)
+		return
+	}
+
+	token, err := auth.MakeOneTimeToken()
+	if err != nil {
+		log.Printf("❌ Ошибка создания токена сброса пароля: %v", err)
+		return
+	}
+
+	// Действует только ссылка из последнего письма
+	err = cfg.Db.InvalidatePasswordResetTokens(ctx, dbUser.ID)
+	if err != nil {
+		log.Printf("❌ Ошибка аннулирования токенов сброса пароля: %v", err)
+		return
+	}
+
+	err = cfg.Db.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    dbUser.ID,
+		ExpiresAt: time.Now().Add(passwordResetTTL),
+	})
+	if err != nil {
+		log.Printf("❌ Ошибка сохранения токена сброса пароля: %v", err)
+		return
+	}
+
+	link := cfg.PublicURL + "/app/reset-password/#token=" + url.QueryEscape(token)
+
+	cfg.sendMail(mailer.Message{
+		To:      dbUser.Email,
+		Subject: "Сброс пароля Chirpy",
+		Body: fmt.Sprintf("Чтобы задать новый пароль, перейдите по ссылке:\n\n%s\n\n"+
+			"Ссылка действует %d минут и может быть использована один раз.\n"+
+			"Если вы не запрашивали сброс пароля, просто проигнорируйте это письмо.\n",
+			link, int(passwordResetTTL.Minutes())),
+	})
+
+	log.Printf("📧 Отправлена ссылка для сброса пароля пользователю: %s", dbUser.ID)
+}
+
+// ConfirmPasswordResetHandler устанавливает новый пароль по токену из письма
+// и отзывает все токены пользователя
+func (cfg *ApiConfig) ConfirmPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	type requestBody struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	reqBody := requestBody{}
+	err := decoder.Decode(&reqBody)
+	if err != nil {
+		log.Printf("❌ Ошибка декодирования JSON: %v", err)
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат запроса")
+		return
+	}
+
+	if reqBody.Password == "" {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Пароль обязателен")
+		return
+	}
+
+	// Production: Проверяем формат токена (должен быть 64 hex символа)
+	if len(reqBody.Token) != 64 {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный или истекший токен сброса пароля")
+		return
+	}
+
+	email, err := cfg.Db.GetPasswordResetTokenEmail(r.Context(), auth.HashToken(reqBody.Token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			log.Printf("❌ Неверный, истекший или использованный токен сброса пароля: %s...", reqBody.Token[:8])
+			helpers.RespondWithError(w, http.StatusBadRequest, "Неверный или истекший токен сброса пароля")
+			return
+		}
+		log.Printf("❌ Ошибка проверки токена сброса пароля: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	// Токен остается действующим, если новый пароль не прошел проверку
+	if !cfg.checkPasswordPolicy(w, r, reqBody.Password, email) {
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(reqBody.Password)
+	if err != nil {
+		log.Printf("❌ Ошибка хеширования пароля: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось обновить пароль")
+		return
+	}
+
+	resetToken, err := cfg.resetPassword(r.Context(), reqBody.Token, hashedPassword)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			log.Printf("❌ Неверный, истекший или использованный токен сброса пароля: %s...", reqBody.Token[:8])
+			helpers.RespondWithError(w, http.StatusBadRequest, "Неверный или истекший токен сброса пароля")
+			return
+		}
+		log.Printf("❌ Ошибка сброса пароля: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось обновить пароль")
+		return
+	}
+
+	cfg.TokenStates.Invalidate(resetToken.UserID)
+
+	log.Printf("🔐 Пароль сброшен, отозваны все токены пользователя: %s", resetToken.UserID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// resetPassword в одной транзакции использует токен сброса, меняет пароль
+// и отзывает все refresh, access и персональные токены. sql.ErrNoRows означает неверный токен
+func (cfg *ApiConfig) resetPassword(ctx context.Context, token, hashedPassword string) (database.PasswordResetToken, error) {
+	tx, err := cfg.DBConn.BeginTx(ctx, nil)
+	if err != nil {
+		return database.PasswordResetToken{}, err
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.Db.WithTx(tx)
+
+	resetToken, err := qtx.ConsumePasswordResetToken(ctx, auth.HashToken(token))
+	if err != nil {
+		return database.PasswordResetToken{}, err
+	}
+
+	err = qtx.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{
+		ID:             resetToken.UserID,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		return database.PasswordResetToken{}, err
+	}
+
+	// 🛡️ БЕЗОПАСНОСТЬ: завершаем все сессии - пароль мог быть скомпрометирован
+	err = qtx.RevokeAllUserRefreshTokens(ctx, resetToken.UserID)
+	if err != nil {
+		return database.PasswordResetToken{}, err
+	}
+
+	_, err = qtx.BumpUserTokenVersion(ctx, resetToken.UserID)
+	if err != nil {
+		return database.PasswordResetToken{}, err
+	}
+
+	err = qtx.RevokeAllPersonalAccessTokens(ctx, resetToken.UserID)
+	if err != nil {
+		return database.PasswordResetToken{}, err
+	}
+
+	err = qtx.InvalidatePasswordResetTokens(ctx, resetToken.UserID)
+	if err != nil {
+		return database.PasswordResetToken{}, err
+	}
+
+	return resetToken, tx.Commit()
+}
+
+// sendMail отправляет письмо с собственным таймаутом (запрос к этому моменту
+// может быть уже завершен). Ошибки только логируются
+func (cfg *ApiConfig) sendMail(msg mailer.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+	defer cancel()
+
+	if err := cfg.Mailer.Send(ctx, msg); err != nil {
+		log.Printf("❌ Ошибка отправки письма для %s: %v", msg.To, err)
+	}
+}
@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/IdrisovMarat/httpserver/internal/auth"
+	"github.com/IdrisovMarat/httpserver/internal/database"
+	"github.com/IdrisovMarat/httpserver/internal/helpers"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxPersonalTokenNameLength - максимальная длина названия токена
+	maxPersonalTokenNameLength = 100
+	// maxPersonalTokenDays - максимальный срок действия токена в днях
+	maxPersonalTokenDays = 365
+)
+
+// PersonalAccessToken - персональный токен доступа. Сам токен (Token)
+// возвращается только при создании
+type PersonalAccessToken struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+	// ExpiresAt - срок действия (null - бессрочный)
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Token      string     `json:"token,omitempty"`
+}
+
+func personalTokenFromDB(dbToken database.PersonalAccessToken) PersonalAccessToken {
+	return PersonalAccessToken{
+		ID:         dbToken.ID,
+		Name:       dbToken.Name,
+		Scopes:     dbToken.Scopes,
+		CreatedAt:  dbToken.CreatedAt,
+		ExpiresAt:  timeOrNil(dbToken.ExpiresAt),
+		LastUsedAt: timeOrNil(dbToken.LastUsedAt),
+	}
+}
+
+// timeOrNil превращает NULL в null JSON
+func timeOrNil(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// requireInteractiveAuth отклоняет запросы с персональным токеном или токеном
+// OAuth клиента: выпускать и отзывать токены можно только после входа в Chirpy
+func requireInteractiveAuth(w http.ResponseWriter, principal auth.Principal) bool {
+	if principal.PersonalTokenID != uuid.Nil {
+		helpers.RespondWithError(w, http.StatusForbidden, "Операция недоступна с персональным токеном")
+		return false
+	}
+	if principal.ClientID != "" {
+		helpers.RespondWithError(w, http.StatusForbidden, "Операция недоступна стороннему приложению")
+		return false
+	}
+	return true
+}
+
+// CreatePersonalTokenHandler создает персональный токен доступа с заданными
+// scopes (подмножество scopes роли) и необязательным сроком действия
+func (cfg *ApiConfig) CreatePersonalTokenHandler(w http.ResponseWriter, r *http.Request) {
+	type requestBody struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+		// ExpiresInDays - срок действия в днях (не указан - бессрочный)
+		ExpiresInDays *int `json:"expires_in_days"`
+	}
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Требуется аутентификация")
+		return
+	}
+	if !requireInteractiveAuth(w, principal) {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	reqBody := requestBody{}
+	err := decoder.Decode(&reqBody)
+	if err != nil {
+		log.Printf("❌ Ошибка декодирования JSON: %v", err)
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат запроса")
+		return
+	}
+
+	if reqBody.Name == "" {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Название токена обязательно")
+		return
+	}
+	if len(reqBody.Name) > maxPersonalTokenNameLength {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Название токена слишком длинное")
+		return
+	}
+
+	if len(reqBody.Scopes) == 0 {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Укажите хотя бы один scope")
+		return
+	}
+	// 🔐 АВТОРИЗАЦИЯ: токен не может получить больше прав, чем роль пользователя
+	scopes := make([]string, 0, len(reqBody.Scopes))
+	for _, scope := range reqBody.Scopes {
+		if !principal.HasScope(scope) {
+			helpers.RespondWithError(w, http.StatusBadRequest, "Недопустимый scope: "+scope)
+			return
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	var expiresAt sql.NullTime
+	if reqBody.ExpiresInDays != nil {
+		days := *reqBody.ExpiresInDays
+		if days < 1 || days > maxPersonalTokenDays {
+			helpers.RespondWithError(w, http.StatusBadRequest, "Срок действия должен быть от 1 до 365 дней")
+			return
+		}
+		expiresAt = sql.NullTime{Time: time.Now().AddDate(0, 0, days), Valid: true}
+	}
+
+	token, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		log.Printf("❌ Ошибка создания персонального токена: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	dbToken, err := cfg.Db.CreatePersonalAccessToken(r.Context(), database.CreatePersonalAccessTokenParams{
+		UserID:    principal.UserID,
+		Name:      reqBody.Name,
+		TokenHash: auth.HashToken(token),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		log.Printf("❌ Ошибка сохранения персонального токена: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	log.Printf("🔑 Пользователь %s создал персональный токен %s (%v)", principal.UserID, dbToken.ID, scopes)
+
+	resp := personalTokenFromDB(dbToken)
+	resp.Token = token
+	helpers.RespondWithJSON(w, http.StatusCreated, resp)
+}
+
+// ListPersonalTokensHandler возвращает действующие персональные токены
+// пользователя (без самих токенов)
+func (cfg *ApiConfig) ListPersonalTokensHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Требуется аутентификация")
+		return
+	}
+
+	dbTokens, err := cfg.Db.ListPersonalAccessTokens(r.Context(), principal.UserID)
+	if err != nil {
+		log.Printf("❌ Ошибка получения персональных токенов пользователя %s: %v", principal.UserID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	tokens := make([]PersonalAccessToken, 0, len(dbTokens))
+	for _, dbToken := range dbTokens {
+		// Истекшие токены не показываем: пользоваться ими уже нельзя
+		if dbToken.ExpiresAt.Valid && dbToken.ExpiresAt.Time.Before(time.Now()) {
+			continue
+		}
+		tokens = append(tokens, personalTokenFromDB(dbToken))
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, tokens)
+}
+
+// RevokePersonalTokenHandler отзывает персональный токен пользователя.
+// Запросы с ним отклоняются сразу
+func (cfg *ApiConfig) RevokePersonalTokenHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Требуется аутентификация")
+		return
+	}
+	if !requireInteractiveAuth(w, principal) {
+		return
+	}
+
+	tokenID, err := uuid.Parse(r.PathValue("tokenID"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат ID токена")
+		return
+	}
+
+	// 🔐 АВТОРИЗАЦИЯ: запрос ограничен токенами текущего пользователя
+	rows, err := cfg.Db.RevokePersonalAccessToken(r.Context(), database.RevokePersonalAccessTokenParams{
+		ID:     tokenID,
+		UserID: principal.UserID,
+	})
+	if err != nil {
+		log.Printf("❌ Ошибка отзыва персонального токена %s: %v", tokenID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+	if rows == 0 {
+		helpers.RespondWithError(w, http.StatusNotFound, "Токен не найден")
+		return
+	}
+
+	log.Printf("🔑 Пользователь %s отозвал персональный токен %s", principal.UserID, tokenID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/IdrisovMarat/httpserver/internal/database"
+	"github.com/IdrisovMarat/httpserver/internal/helpers"
+	"github.com/google/uuid"
+)
+
+// rateLimit - не больше Max запросов за Window
+type rateLimit struct {
+	Max    int
+	Window time.Duration
+}
+
+// Лимиты отправки писем для входа по ссылке: на один адрес (защита ящика от
+// спама) и с одного IP (защита от перебора адресов)
+var (
+	magicLinkEmailLimit = rateLimit{Max: 3, Window: magicLinkTTL}
+	magicLinkIPLimit    = rateLimit{Max: 20, Window: time.Hour}
+)
+
+// Ключи счетчиков отправки писем для входа по ссылке (rate_limits.limit_key)
+func magicLinkEmailKey(email string) string { return "magic:email:" + strings.ToLower(email) }
+func magicLinkIPKey(ip string) string       { return "magic:ip:" + ip }
+
+// Лимиты запросов сброса пароля: на один адрес и с одного IP
+var (
+	passwordResetEmailLimit = rateLimit{Max: 3, Window: passwordResetTTL}
+	passwordResetIPLimit    = rateLimit{Max: 20, Window: time.Hour}
+)
+
+// Ключи счетчиков запросов сброса пароля
+func passwordResetEmailKey(email string) string { return "reset:email:" + strings.ToLower(email) }
+func passwordResetIPKey(ip string) string       { return "reset:ip:" + ip }
+
+// Лимиты повторной отправки письма подтверждения email: на пользователя и с одного IP
+var (
+	verificationResendUserLimit = rateLimit{Max: 3, Window: time.Hour}
+	verificationResendIPLimit   = rateLimit{Max: 20, Window: time.Hour}
+)
+
+// Ключи счетчиков повторной отправки письма подтверждения email
+func verificationResendUserKey(userID uuid.UUID) string { return "verify:user:" + userID.String() }
+func verificationResendIPKey(ip string) string          { return "verify:ip:" + ip }
+
+// Лимиты отправки кода подтверждения личности (POST /api/reauth/email): на
+// пользователя и с одного IP
+var (
+	sudoEmailCodeUserLimit = rateLimit{Max: 3, Window: sudoEmailCodeTTL}
+	sudoEmailCodeIPLimit   = rateLimit{Max: 20, Window: time.Hour}
+)
+
+// Ключи счетчиков отправки кода подтверждения личности
+func sudoEmailCodeUserKey(userID uuid.UUID) string { return "sudo:user:" + userID.String() }
+func sudoEmailCodeIPKey(ip string) string          { return "sudo:ip:" + ip }
+
+// rateLimitHit - ключ счетчика и лимит для него
+type rateLimitHit struct {
+	Key   string
+	Limit rateLimit
+}
+
+// hitRateLimit учитывает запрос по ключу и возвращает, через сколько можно
+// повторить, если лимит превышен (0 - запрос разрешен). Счетчик
+// увеличивается атомарно, поэтому параллельные запросы не обходят лимит
+func (cfg *ApiConfig) hitRateLimit(ctx context.Context, key string, limit rateLimit) (time.Duration, error) {
+	counter, err := cfg.Db.HitRateLimit(ctx, database.HitRateLimitParams{
+		LimitKey:    key,
+		WindowStart: time.Now().Add(-limit.Window),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("ошибка учета запроса %s: %w", key, err)
+	}
+
+	if int(counter.Hits) <= limit.Max {
+		return 0, nil
+	}
+	return max(time.Until(counter.WindowStartedAt.Add(limit.Window)), time.Second), nil
+}
+
+// hitRateLimits учитывает запрос по каждому ключу по порядку и останавливается
+// на первом превышенном лимите, возвращая, через сколько можно повторить
+func (cfg *ApiConfig) hitRateLimits(ctx context.Context, hits ...rateLimitHit) (time.Duration, error) {
+	for _, hit := range hits {
+		retryAfter, err := cfg.hitRateLimit(ctx, hit.Key, hit.Limit)
+		if err != nil {
+			return 0, err
+		}
+		if retryAfter > 0 {
+			log.Printf("🚨 SECURITY: превышен лимит запросов: %s", hit.Key)
+			return retryAfter, nil
+		}
+	}
+	return 0, nil
+}
+
+// respondRateLimited отвечает 429 с заголовком Retry-After (в секундах)
+func respondRateLimited(w http.ResponseWriter, retryAfter time.Duration, message string) {
+	w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(retryAfter.Seconds()))))
+	helpers.RespondWithError(w, http.StatusTooManyRequests, message)
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/IdrisovMarat/httpserver/internal/auth"
+	"github.com/IdrisovMarat/httpserver/internal/database"
+	"github.com/IdrisovMarat/httpserver/internal/helpers"
+	"github.com/google/uuid"
+)
+
+// errAlreadyRechirped - пользователь уже сделал rechirp этого chirp
+var errAlreadyRechirped = errors.New("chirp уже отмечен rechirp")
+
+// OriginalChirp - оригинал rechirp или цитаты, встроенный в ответ. Удаленный
+// оригинал цитаты приходит надгробием: Deleted = true и пустой текст
+type OriginalChirp struct {
+	Chirp
+	Deleted bool `json:"deleted"`
+}
+
+// RechirpHandler делает rechirp chirp от имени текущего пользователя.
+// Rechirp rechirp относится к оригиналу; повторный rechirp - 409
+func (cfg *ApiConfig) RechirpHandler(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат ID chirp")
+		return
+	}
+
+	// 🔐 Пользователь аутентифицирован middleware RequireAuth
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Требуется аутентификация")
+		return
+	}
+
+	// 📧 Rechirp - публикация, как и новый chirp
+	dbUser, err := cfg.Db.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		log.Printf("❌ Ошибка получения пользователя %s: %v", principal.UserID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось сделать rechirp")
+		return
+	}
+	if !dbUser.EmailVerifiedAt.Valid {
+		helpers.RespondWithError(w, http.StatusForbidden, "Подтвердите email, чтобы публиковать chirps")
+		return
+	}
+
+	dbChirp, err := cfg.rechirp(r.Context(), principal.UserID, chirpID)
+	if err != nil {
+		switch {
+		case err == sql.ErrNoRows:
+			helpers.RespondWithError(w, http.StatusNotFound, "Chirp не найден")
+		case errors.Is(err, errAlreadyRechirped):
+			helpers.RespondWithError(w, http.StatusConflict, "Вы уже сделали rechirp этого chirp")
+		default:
+			log.Printf("❌ Ошибка rechirp chirp %s пользователем %s: %v", chirpID, principal.UserID, err)
+			helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось сделать rechirp")
+		}
+		return
+	}
+
+	log.Printf("🔁 Пользователь %s сделал rechirp chirp %s", principal.UserID, dbChirp.RechirpOfID.UUID)
+
+	response := chirpFromDB(dbChirp, time.RFC3339Nano)
+	if err := cfg.decorateChirps(r.Context(), []*Chirp{&response}); err != nil {
+		log.Printf("❌ Ошибка получения оригинала rechirp %s: %v", dbChirp.ID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось сделать rechirp")
+		return
+	}
+
+	helpers.RespondWithJSON(w, http.StatusCreated, response)
+}
+
+// UnrechirpHandler отменяет rechirp текущего пользователя. chirpID - оригинал
+func (cfg *ApiConfig) UnrechirpHandler(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат ID chirp")
+		return
+	}
+
+	// 🔐 Пользователь аутентифицирован middleware RequireAuth
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Требуется аутентификация")
+		return
+	}
+
+	rows, err := cfg.Db.DeleteRechirp(r.Context(), database.DeleteRechirpParams{
+		UserID:      principal.UserID,
+		RechirpOfID: chirpID,
+	})
+	if err != nil {
+		log.Printf("❌ Ошибка отмены rechirp chirp %s пользователем %s: %v", chirpID, principal.UserID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось отменить rechirp")
+		return
+	}
+	if rows == 0 {
+		helpers.RespondWithError(w, http.StatusNotFound, "Rechirp не найден")
+		return
+	}
+
+	log.Printf("🗑️ Пользователь %s отменил rechirp chirp %s", principal.UserID, chirpID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// rechirp в одной транзакции создает rechirp оригинала chirpID. Оригинал
+// заблокирован FOR SHARE, поэтому параллельное удаление не оставит rechirp
+// без оригинала. sql.ErrNoRows - chirp не найден или удален
+func (cfg *ApiConfig) rechirp(ctx context.Context, userID, chirpID uuid.UUID) (chirpRow, error) {
+	tx, err := cfg.DBConn.BeginTx(ctx, nil)
+	if err != nil {
+		return chirpRow{}, err
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.Db.WithTx(tx)
+
+	original, err := qtx.GetChirpForShare(ctx, chirpID)
+	if err != nil {
+		return chirpRow{}, err
+	}
+	if original.RechirpOfID.Valid {
+		original, err = qtx.GetChirpForShare(ctx, original.RechirpOfID.UUID)
+		if err != nil {
+			return chirpRow{}, err
+		}
+	}
+
+	dbChirp, err := qtx.CreateRechirp(ctx, database.CreateRechirpParams{
+		UserID:      userID,
+		RechirpOfID: original.ID,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return chirpRow{}, errAlreadyRechirped
+		}
+		return chirpRow{}, err
+	}
+
+	return chirpRow(dbChirp), tx.Commit()
+}
+
+// sharedChirp возвращает chirp, на который ссылаются ответ, цитата, rechirp
+// или лайк: для простого rechirp - его оригинал. Chirp блокируется FOR SHARE
+// до конца транзакции q, чтобы параллельное удаление дождалось новой ссылки.
+// sql.ErrNoRows - chirp не найден или удален
+func sharedChirp(ctx context.Context, q *database.Queries, chirpID uuid.UUID) (chirpRow, error) {
+	dbChirp, err := q.GetChirpForShare(ctx, chirpID)
+	if err != nil {
+		return chirpRow{}, err
+	}
+	if dbChirp.RechirpOfID.Valid {
+		dbChirp, err = q.GetChirpForShare(ctx, dbChirp.RechirpOfID.UUID)
+	}
+	return chirpRow(dbChirp), err
+}
+
+// decorateChirps дополняет страницу chirps встроенными оригиналами rechirps
+// и цитат и флагами liked_by_me: по одному запросу на страницу, без запроса
+// на каждый chirp
+func (cfg *ApiConfig) decorateChirps(ctx context.Context, chirps []*Chirp) error {
+	var originalIDs []uuid.UUID
+	for _, chirp := range chirps {
+		if id := chirp.originalID(); id != nil {
+			originalIDs = append(originalIDs, *id)
+		}
+	}
+
+	originals := make(map[uuid.UUID]*OriginalChirp, len(originalIDs))
+	if len(originalIDs) > 0 {
+		dbOriginals, err := cfg.Db.ListChirpsByIDs(ctx, originalIDs)
+		if err != nil {
+			return err
+		}
+		for _, dbOriginal := range dbOriginals {
+			originals[dbOriginal.ID] = &OriginalChirp{
+				Chirp:   chirpFromDB(chirpRow(dbOriginal), time.RFC3339Nano),
+				Deleted: dbOriginal.DeletedAt.Valid,
+			}
+		}
+	}
+
+	// ❤️ liked_by_me для страницы и встроенных оригиналов одним запросом
+	chirpIDs := make([]uuid.UUID, 0, len(chirps)+len(originals))
+	for _, chirp := range chirps {
+		chirpIDs = append(chirpIDs, chirp.ID)
+	}
+	for id := range originals {
+		chirpIDs = append(chirpIDs, id)
+	}
+	liked, err := cfg.likedChirpIDs(ctx, chirpIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, original := range originals {
+		original.LikedByMe = liked[original.ID]
+	}
+	for _, chirp := range chirps {
+		chirp.LikedByMe = liked[chirp.ID]
+		// Оригинал мог быть удален после выборки страницы: тогда не встраивается
+		if id := chirp.originalID(); id != nil {
+			chirp.Original = originals[*id]
+		}
+	}
+
+	return nil
+}
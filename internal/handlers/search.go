@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/IdrisovMarat/httpserver/internal/database"
+	"github.com/IdrisovMarat/httpserver/internal/helpers"
+	"github.com/IdrisovMarat/httpserver/internal/pagination"
+	"github.com/google/uuid"
+)
+
+const (
+	// Production: ограничиваем длину запроса и глубину offset-пагинации
+	maxSearchQueryLength = 256
+	maxSearchOffset      = 10000
+)
+
+// SearchResult - chirp из результатов поиска с рангом и подсвеченным фрагментом
+type SearchResult struct {
+	Chirp
+	Rank    float32 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+// SearchPage - страница результатов поиска
+type SearchPage struct {
+	Results []SearchResult `json:"results"`
+	Next    string         `json:"next,omitempty"`
+	Prev    string         `json:"prev,omitempty"`
+}
+
+func (cfg *ApiConfig) SearchChirpsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := query.Get("q")
+
+	if q == "" {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Параметр q обязателен")
+		return
+	}
+
+	if len(q) > maxSearchQueryLength {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Поисковый запрос слишком длинный")
+		return
+	}
+
+	tsQuery, err := helpers.BuildSearchQuery(q)
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Поисковый запрос не содержит слов")
+		return
+	}
+
+	limit, err := pagination.ParseLimit(query.Get("limit"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	offset := 0
+	if offsetStr := query.Get("offset"); offsetStr != "" {
+		offset, err = strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 || offset > maxSearchOffset {
+			helpers.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("offset должен быть числом от 0 до %d", maxSearchOffset))
+			return
+		}
+	}
+
+	params := database.SearchChirpsParams{
+		Query:      tsQuery,
+		PageLimit:  int32(limit + 1),
+		PageOffset: int32(offset),
+	}
+
+	// 🔍 Дополнительные фильтры: автор и диапазон дат
+	if authorIDStr := query.Get("author_id"); authorIDStr != "" {
+		authorID, err := uuid.Parse(authorIDStr)
+		if err != nil {
+			log.Printf("❌ Неверный формат UUID author_id: %s, ошибка: %v", authorIDStr, err)
+			helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат author_id")
+			return
+		}
+		params.AuthorID = uuid.NullUUID{UUID: authorID, Valid: true}
+	}
+
+	if params.CreatedFrom, err = parseSearchDate(query.Get("from"), false); err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат from (ожидается RFC3339 или YYYY-MM-DD)")
+		return
+	}
+
+	if params.CreatedTo, err = parseSearchDate(query.Get("to"), true); err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат to (ожидается RFC3339 или YYYY-MM-DD)")
+		return
+	}
+
+	log.Printf("🔄 Поиск chirps: %q (tsquery: %s)", q, tsQuery)
+
+	rows, err := cfg.Db.SearchChirps(r.Context(), params)
+	if err != nil {
+		log.Printf("❌ Ошибка поиска chirps в БД: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось выполнить поиск")
+		return
+	}
+
+	hasMore := len(rows) > limit
+	if hasMore {
+		rows = rows[:limit]
+	}
+
+	log.Printf("✅ Найдено %d chirps по запросу %q", len(rows), q)
+
+	results := make([]SearchResult, len(rows))
+	for i, row := range rows {
+		results[i] = SearchResult{
+			Chirp: Chirp{
+				ID:        row.ID,
+				CreatedAt: row.CreatedAt.Format(time.RFC3339Nano),
+				UpdatedAt: row.UpdatedAt.Format(time.RFC3339Nano),
+				Body:      row.Body,
+				UserID:    nullUUIDPtr(row.UserID),
+				Edited:    row.EditedAt.Valid,
+				InReplyTo: nullUUIDPtr(row.ParentID),
+				RootID:    nullUUIDPtr(row.RootID),
+				LikeCount: row.LikeCount,
+				QuoteOf:   nullUUIDPtr(row.QuoteOfID),
+			},
+			Rank:    row.Rank,
+			Snippet: helpers.HighlightSnippet(row.Snippet),
+		}
+	}
+
+	decorated := make([]*Chirp, len(results))
+	for i := range results {
+		decorated[i] = &results[i].Chirp
+	}
+	if err := cfg.decorateChirps(r.Context(), decorated); err != nil {
+		log.Printf("❌ Ошибка получения оригиналов и лайков chirps: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось выполнить поиск")
+		return
+	}
+
+	page := SearchPage{Results: results}
+
+	// 🔗 Результаты упорядочены по релевантности, поэтому пагинация по offset
+	if hasMore {
+		page.Next = searchPageURL(r.URL, offset+limit)
+	}
+	if offset > 0 {
+		page.Prev = searchPageURL(r.URL, max(offset-limit, 0))
+	}
+
+	if link := pagination.LinkHeader(page.Next, page.Prev); link != "" {
+		w.Header().Set("Link", link)
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, page)
+}
+
+// parseSearchDate разбирает границу диапазона дат. Для даты без времени
+// верхняя граница включает весь день
+func parseSearchDate(raw string, upper bool) (sql.NullTime, error) {
+	if raw == "" {
+		return sql.NullTime{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return sql.NullTime{Time: t.UTC(), Valid: true}, nil
+	}
+
+	t, err := time.Parse(time.DateOnly, raw)
+	if err != nil {
+		return sql.NullTime{}, err
+	}
+
+	if upper {
+		t = t.AddDate(0, 0, 1)
+	}
+
+	return sql.NullTime{Time: t, Valid: true}, nil
+}
+
+// searchPageURL строит ссылку на страницу поиска с заданным offset
+func searchPageURL(u *url.URL, offset int) string {
+	query := u.Query()
+	query.Set("offset", strconv.Itoa(offset))
+
+	return u.Path + "?" + query.Encode()
+}
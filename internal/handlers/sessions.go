@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/IdrisovMarat/httpserver/internal/auth"
+	"github.com/IdrisovMarat/httpserver/internal/database"
+	"github.com/IdrisovMarat/httpserver/internal/helpers"
+	"github.com/google/uuid"
+)
+
+// maxUserAgentLength - User-Agent длиннее этого обрезается перед сохранением
+const maxUserAgentLength = 512
+
+// Session - сессия входа (семейство refresh tokens) на одном устройстве
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// Current - сессия, в которой выдан access token текущего запроса
+	Current bool `json:"current"`
+}
+
+// clientInfo возвращает User-Agent и IP клиента для сохранения в сессии.
+// PostgreSQL отклоняет неверный UTF-8 и нулевые байты в TEXT, поэтому они
+// удаляются, а длинный User-Agent обрезается по границе символа
+func (cfg *ApiConfig) clientInfo(r *http.Request) (string, string) {
+	userAgent := strings.ToValidUTF8(r.UserAgent(), "")
+	userAgent = strings.ReplaceAll(userAgent, "\x00", "")
+	if len(userAgent) > maxUserAgentLength {
+		cut := maxUserAgentLength
+		for cut > 0 && !utf8.RuneStart(userAgent[cut]) {
+			cut--
+		}
+		userAgent = userAgent[:cut]
+	}
+	return userAgent, helpers.ClientIP(r, cfg.TrustProxy)
+}
+
+// ListSessionsHandler возвращает активные сессии текущего пользователя
+func (cfg *ApiConfig) ListSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Требуется аутентификация")
+		return
+	}
+
+	dbSessions, err := cfg.Db.ListUserSessions(r.Context(), principal.UserID)
+	if err != nil {
+		log.Printf("❌ Ошибка получения сессий пользователя %s: %v", principal.UserID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	sessions := make([]Session, 0, len(dbSessions))
+	for _, dbSession := range dbSessions {
+		sessions = append(sessions, Session{
+			ID:         dbSession.FamilyID,
+			UserAgent:  dbSession.UserAgent,
+			IP:         dbSession.Ip,
+			CreatedAt:  dbSession.StartedAt,
+			LastUsedAt: dbSession.LastUsedAt,
+			ExpiresAt:  dbSession.ExpiresAt,
+			Current:    dbSession.FamilyID == principal.SessionID,
+		})
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, sessions)
+}
+
+// RevokeSessionHandler завершает одну сессию текущего пользователя.
+// Уже выданные access tokens сессии действуют до истечения срока
+func (cfg *ApiConfig) RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Требуется аутентификация")
+		return
+	}
+	if !requireInteractiveAuth(w, principal) {
+		return
+	}
+
+	sessionID, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат ID сессии")
+		return
+	}
+
+	// 🔐 АВТОРИЗАЦИЯ: запрос ограничен сессиями текущего пользователя
+	rows, err := cfg.Db.RevokeUserSession(r.Context(), database.RevokeUserSessionParams{
+		FamilyID: sessionID,
+		UserID:   principal.UserID,
+	})
+	if err != nil {
+		log.Printf("❌ Ошибка завершения сессии %s: %v", sessionID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+	if rows == 0 {
+		helpers.RespondWithError(w, http.StatusNotFound, "Сессия не найдена")
+		return
+	}
+
+	log.Printf("🔐 Пользователь %s завершил сессию %s", principal.UserID, sessionID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeOtherSessionsHandler завершает все сессии пользователя, кроме текущей
+func (cfg *ApiConfig) RevokeOtherSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Требуется аутентификация")
+		return
+	}
+	if !requireInteractiveAuth(w, principal) {
+		return
+	}
+
+	// Токены, выпущенные до введения сессий, не знают своей сессии
+	if principal.SessionID == uuid.Nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Текущая сессия неизвестна, войдите заново")
+		return
+	}
+
+	err := cfg.Db.RevokeOtherUserSessions(r.Context(), database.RevokeOtherUserSessionsParams{
+		UserID:   principal.UserID,
+		FamilyID: principal.SessionID,
+	})
+	if err != nil {
+		log.Printf("❌ Ошибка завершения сессий пользователя %s: %v", principal.UserID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	log.Printf("🔐 Пользователь %s завершил все сессии, кроме %s", principal.UserID, principal.SessionID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeAllSessionsHandler - выход на всех устройствах, включая текущее:
+// отзывает все refresh tokens и сразу все выданные access tokens
+func (cfg *ApiConfig) RevokeAllSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Требуется аутентификация")
+		return
+	}
+	if !requireInteractiveAuth(w, principal) {
+		return
+	}
+
+	err := cfg.Db.RevokeAllUserRefreshTokens(r.Context(), principal.UserID)
+	if err != nil {
+		log.Printf("❌ Ошибка отзыва refresh tokens пользователя %s: %v", principal.UserID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	err = cfg.revokeAccessTokens(r.Context(), principal.UserID)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	log.Printf("🔐 Пользователь %s вышел на всех устройствах", principal.UserID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/IdrisovMarat/httpserver/internal/auth"
+	"github.com/IdrisovMarat/httpserver/internal/database"
+)
+
+// signingKeyStore хранит ключи подписи JWT в таблице jwt_signing_keys, чтобы
+// все экземпляры сервера подписывали и проверяли токены одними ключами и
+// ключи переживали перезапуск
+type signingKeyStore struct {
+	db     *database.Queries
+	secret string
+	// legacySecret - JWT_SECRET, которым ключи шифровались раньше: такие
+	// ключи при загрузке перешифровываются secret
+	legacySecret string
+}
+
+// NewSigningKeyStore создает хранилище ключей подписи в БД. Приватные ключи
+// шифруются ключом, производным от secret (JWT_KEY_ENCRYPTION_SECRET)
+func NewSigningKeyStore(db *database.Queries, secret, legacySecret string) auth.KeyStore {
+	return &signingKeyStore{db: db, secret: secret, legacySecret: legacySecret}
+}
+
+func (s *signingKeyStore) LoadKeys(ctx context.Context) ([]*auth.SigningKey, error) {
+	rows, err := s.db.ListJWTSigningKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]*auth.SigningKey, 0, len(rows))
+	for _, row := range rows {
+		key, err := s.openKey(ctx, row)
+		if err != nil {
+			return nil, err
+		}
+		key.CreatedAt = row.CreatedAt.UTC()
+		key.ActivatesAt = row.ActivatesAt.UTC()
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// openKey расшифровывает приватный ключ. Ключ, зашифрованный JWT_SECRET до
+// появления JWT_KEY_ENCRYPTION_SECRET, перешифровывается новым секретом
+func (s *signingKeyStore) openKey(ctx context.Context, row database.JwtSigningKey) (*auth.SigningKey, error) {
+	key, err := auth.OpenPrivateKey(row.Kid, row.PrivateKey, s.secret)
+	if err == nil || s.legacySecret == "" {
+		return key, err
+	}
+
+	key, legacyErr := auth.OpenPrivateKey(row.Kid, row.PrivateKey, s.legacySecret)
+	if legacyErr != nil {
+		return nil, err
+	}
+
+	sealed, err := auth.SealPrivateKey(key, s.secret)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.UpdateJWTSigningKeyPrivateKey(ctx, database.UpdateJWTSigningKeyPrivateKeyParams{
+		Kid:        row.Kid,
+		PrivateKey: sealed,
+	}); err != nil {
+		return nil, err
+	}
+	log.Printf("🔐 Ключ подписи %s перешифрован JWT_KEY_ENCRYPTION_SECRET", row.Kid)
+
+	return key, nil
+}
+
+func (s *signingKeyStore) SaveKey(ctx context.Context, key *auth.SigningKey) error {
+	sealed, err := auth.SealPrivateKey(key, s.secret)
+	if err != nil {
+		return err
+	}
+
+	return s.db.CreateJWTSigningKey(ctx, database.CreateJWTSigningKeyParams{
+		Kid:         key.ID,
+		Alg:         key.Method.Alg(),
+		PrivateKey:  sealed,
+		CreatedAt:   key.CreatedAt.UTC(),
+		ActivatesAt: key.ActivatesAt.UTC(),
+	})
+}
+
+func (s *signingKeyStore) DeleteKey(ctx context.Context, id string) error {
+	return s.db.DeleteJWTSigningKey(ctx, id)
+}
+
+func (s *signingKeyStore) LegacyCutover(ctx context.Context, now time.Time) (time.Time, error) {
+	cutover, err := s.db.GetJWTLegacyCutover(ctx, now.UTC())
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cutover.UTC(), nil
+}
@@ -0,0 +1,350 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/IdrisovMarat/httpserver/internal/auth"
+	"github.com/IdrisovMarat/httpserver/internal/database"
+	"github.com/IdrisovMarat/httpserver/internal/helpers"
+	"github.com/IdrisovMarat/httpserver/internal/mailer"
+)
+
+const (
+	// sudoTokenTTL - сколько действует подтверждение после повторного ввода пароля
+	sudoTokenTTL = 10 * time.Minute
+	// sudoTokenHeader - заголовок с токеном режима sudo
+	sudoTokenHeader = "X-Sudo-Token"
+	// sudoEmailCodeTTL - срок действия кода подтверждения из письма
+	sudoEmailCodeTTL = 10 * time.Minute
+)
+
+// RequestSudoEmailCodeHandler отправляет пользователю без пароля (вход через
+// OIDC или по ссылке) одноразовый код для POST /api/reauth
+func (cfg *ApiConfig) RequestSudoEmailCodeHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Требуется аутентификация")
+		return
+	}
+	if !requireInteractiveAuth(w, principal) {
+		return
+	}
+
+	dbUser, err := cfg.Db.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		log.Printf("❌ Ошибка получения пользователя %s: %v", principal.UserID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	if dbUser.HashedPassword != auth.UnsetPasswordHash {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Подтвердите личность паролем")
+		return
+	}
+	// 📧 Код на неподтвержденный адрес получил бы тот, кто указал чужой email
+	if !dbUser.EmailVerifiedAt.Valid {
+		helpers.RespondWithError(w, http.StatusForbidden, "Email не подтвержден")
+		return
+	}
+
+	// 🛡️ Украденный access token не должен позволить засыпать ящик письмами
+	retryAfter, err := cfg.hitRateLimits(r.Context(),
+		rateLimitHit{Key: sudoEmailCodeIPKey(helpers.ClientIP(r, cfg.TrustProxy)), Limit: sudoEmailCodeIPLimit},
+		rateLimitHit{Key: sudoEmailCodeUserKey(dbUser.ID), Limit: sudoEmailCodeUserLimit},
+	)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+	if retryAfter > 0 {
+		respondRateLimited(w, retryAfter, "Слишком много запросов кода подтверждения. Повторите позже")
+		return
+	}
+
+	code, err := auth.MakeOneTimeToken()
+	if err != nil {
+		log.Printf("❌ Ошибка создания кода подтверждения: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	// Действует только код из последнего письма
+	err = cfg.Db.InvalidateSudoEmailCodes(r.Context(), dbUser.ID)
+	if err != nil {
+		log.Printf("❌ Ошибка аннулирования кодов подтверждения: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	err = cfg.Db.CreateSudoEmailCode(r.Context(), database.CreateSudoEmailCodeParams{
+		CodeHash:  auth.HashToken(code),
+		UserID:    dbUser.ID,
+		ExpiresAt: time.Now().Add(sudoEmailCodeTTL),
+	})
+	if err != nil {
+		log.Printf("❌ Ошибка сохранения кода подтверждения: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	go cfg.sendMail(mailer.Message{
+		To:      dbUser.Email,
+		Subject: "Код подтверждения Chirpy",
+		Body: fmt.Sprintf("Код для подтверждения изменений аккаунта Chirpy:\n\n%s\n\n"+
+			"Код действует %d минут и может быть использован один раз.\n"+
+			"Если вы не запрашивали код, смените пароль или выйдите из всех сессий.\n",
+			code, int(sudoEmailCodeTTL.Minutes())),
+	})
+
+	log.Printf("📧 Отправлен код подтверждения пользователю: %s", dbUser.ID)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ReauthenticateHandler повторно проверяет пароль (или код из письма для
+// пользователей без пароля) и TOTP, если включен, и выдает sudo токен для
+// изменений аккаунта без повторного ввода пароля
+func (cfg *ApiConfig) ReauthenticateHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Требуется аутентификация")
+		return
+	}
+	if !requireInteractiveAuth(w, principal) {
+		return
+	}
+
+	type requestBody struct {
+		Password     string `json:"password"`
+		EmailCode    string `json:"email_code"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	type response struct {
+		SudoToken string `json:"sudo_token"`
+		ExpiresIn int    `json:"expires_in"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	reqBody := requestBody{}
+	err := decoder.Decode(&reqBody)
+	if err != nil {
+		log.Printf("❌ Ошибка декодирования JSON: %v", err)
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат запроса")
+		return
+	}
+
+	if reqBody.Password == "" && reqBody.EmailCode == "" {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Пароль или email_code обязателен")
+		return
+	}
+
+	dbUser, err := cfg.Db.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		log.Printf("❌ Ошибка получения пользователя %s: %v", principal.UserID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	if !cfg.checkSudoProof(w, r, dbUser, sudoProof{
+		CurrentPassword: reqBody.Password,
+		EmailCode:       reqBody.EmailCode,
+		Code:            reqBody.Code,
+		RecoveryCode:    reqBody.RecoveryCode,
+	}) {
+		return
+	}
+
+	// Токен привязан к сессии и версии токенов: после выхода или смены пароля он не действует
+	sudoToken, err := cfg.Keys.MakeSudoToken(auth.Principal{
+		UserID:       dbUser.ID,
+		SessionID:    principal.SessionID,
+		TokenVersion: dbUser.TokenVersion,
+	}, sudoTokenTTL)
+	if err != nil {
+		log.Printf("❌ Ошибка создания sudo токена: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось создать токен")
+		return
+	}
+
+	log.Printf("🔐 Пользователь %s подтвердил пароль, режим sudo на %v", dbUser.ID, sudoTokenTTL)
+
+	helpers.RespondWithJSON(w, http.StatusOK, response{
+		SudoToken: sudoToken,
+		ExpiresIn: int(sudoTokenTTL.Seconds()),
+	})
+}
+
+// sudoProof - подтверждение личности в теле запроса, если нет заголовка
+// X-Sudo-Token: текущий пароль (для пользователя без пароля - код из письма)
+// и, при включенном TOTP, второй фактор
+type sudoProof struct {
+	CurrentPassword string `json:"current_password"`
+	EmailCode       string `json:"email_code"`
+	Code            string `json:"code"`
+	RecoveryCode    string `json:"recovery_code"`
+}
+
+// requireSudo проверяет, что пользователь недавно подтвердил личность: по
+// заголовку X-Sudo-Token этой же сессии или по sudoProof из запроса. Иначе
+// сам отвечает клиенту и возвращает false
+func (cfg *ApiConfig) requireSudo(w http.ResponseWriter, r *http.Request, dbUser database.User, proof sudoProof) bool {
+	if sudoToken := r.Header.Get(sudoTokenHeader); sudoToken != "" {
+		principal, _ := auth.PrincipalFromContext(r.Context())
+
+		// 🔐 Токен действует только в сессии, где выдан, и до смены версии токенов
+		sudo, err := cfg.Keys.ParseSudoToken(sudoToken)
+		if err != nil || sudo.UserID != dbUser.ID || sudo.SessionID != principal.SessionID ||
+			sudo.TokenVersion != dbUser.TokenVersion {
+			log.Printf("❌ Неверный или истекший sudo токен пользователя %s: %v", dbUser.ID, err)
+			helpers.RespondWithError(w, http.StatusForbidden, "Неверный или истекший sudo токен")
+			return false
+		}
+		return true
+	}
+
+	if proof.CurrentPassword == "" && proof.EmailCode == "" {
+		helpers.RespondWithError(w, http.StatusForbidden,
+			"Требуется подтверждение: укажите current_password, email_code или заголовок "+sudoTokenHeader)
+		return false
+	}
+
+	return cfg.checkSudoProof(w, r, dbUser, proof)
+}
+
+// checkSudoProof проверяет пароль (у пользователя без пароля - код из письма)
+// и, при включенном TOTP, второй фактор. Иначе сам отвечает клиенту и
+// возвращает false
+func (cfg *ApiConfig) checkSudoProof(w http.ResponseWriter, r *http.Request, dbUser database.User, proof sudoProof) bool {
+	if dbUser.HashedPassword == auth.UnsetPasswordHash {
+		if !cfg.checkSudoEmailCode(w, r, dbUser, proof.EmailCode) {
+			return false
+		}
+	} else if !cfg.checkCurrentPassword(w, r, dbUser, proof.CurrentPassword) {
+		return false
+	}
+
+	// 🔐 2FA: при включенном TOTP режим sudo требует и второй фактор
+	if dbUser.TotpEnabledAt.Valid {
+		return cfg.checkSecondFactor(w, r, dbUser, proof.Code, proof.RecoveryCode)
+	}
+
+	return true
+}
+
+// checkSecondFactor проверяет TOTP код или код восстановления с защитой от
+// перебора. Иначе сам отвечает клиенту и возвращает false
+func (cfg *ApiConfig) checkSecondFactor(w http.ResponseWriter, r *http.Request, dbUser database.User, code, recoveryCode string) bool {
+	// 🛡️ Защита от перебора: украденный access token не должен позволить подобрать код
+	mfaAttempt := loginAttempt{Key: mfaAttemptKey(dbUser.ID), Policy: auth.EmailLockoutPolicy}
+	retryAfter, err := cfg.beginLoginAttempt(r.Context(), mfaAttempt)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return false
+	}
+	if retryAfter > 0 {
+		respondLocked(w, retryAfter)
+		return false
+	}
+
+	ok, err := cfg.verifySecondFactor(r.Context(), dbUser, code, recoveryCode)
+	if err != nil {
+		log.Printf("❌ Ошибка проверки второго фактора: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return false
+	}
+	if !ok {
+		helpers.RespondWithError(w, http.StatusForbidden, "Неверный код подтверждения")
+		return false
+	}
+
+	cfg.refundLoginAttempt(r.Context(), mfaAttempt)
+	return true
+}
+
+// checkSudoEmailCode проверяет и тратит одноразовый код из письма
+// (POST /api/reauth/email). Иначе сам отвечает клиенту и возвращает false
+func (cfg *ApiConfig) checkSudoEmailCode(w http.ResponseWriter, r *http.Request, dbUser database.User, code string) bool {
+	if code == "" {
+		helpers.RespondWithError(w, http.StatusForbidden,
+			"Пароль не установлен. Запросите код через POST /api/reauth/email и укажите email_code")
+		return false
+	}
+
+	// 🛡️ Защита от перебора: неверные коды блокируют проверку так же, как
+	// неверный второй фактор
+	codeAttempt := loginAttempt{Key: sudoCodeAttemptKey(dbUser.ID), Policy: auth.EmailLockoutPolicy}
+	retryAfter, err := cfg.beginLoginAttempt(r.Context(), codeAttempt)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return false
+	}
+	if retryAfter > 0 {
+		respondLocked(w, retryAfter)
+		return false
+	}
+
+	rows, err := cfg.Db.ConsumeSudoEmailCode(r.Context(), database.ConsumeSudoEmailCodeParams{
+		CodeHash: auth.HashToken(code),
+		UserID:   dbUser.ID,
+	})
+	if err != nil {
+		log.Printf("❌ Ошибка проверки кода подтверждения: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return false
+	}
+	if rows == 0 {
+		log.Printf("❌ Неверный или истекший код подтверждения пользователя: %s", dbUser.ID)
+		helpers.RespondWithError(w, http.StatusForbidden, "Неверный или истекший код подтверждения")
+		return false
+	}
+
+	cfg.refundLoginAttempt(r.Context(), codeAttempt)
+	return true
+}
+
+// checkCurrentPassword проверяет текущий пароль пользователя с защитой от
+// перебора (общий счетчик с входом по email). Иначе сам отвечает клиенту
+// и возвращает false
+func (cfg *ApiConfig) checkCurrentPassword(w http.ResponseWriter, r *http.Request, dbUser database.User, password string) bool {
+	// 🛡️ Защита от перебора: украденный access token не должен позволить подобрать пароль
+	if dbUser.HashedPassword == auth.UnsetPasswordHash {
+		helpers.RespondWithError(w, http.StatusForbidden, "Пароль не установлен. Задайте пароль через POST /api/password-reset")
+		return false
+	}
+
+	emailAttempt := loginAttempt{Key: emailAttemptKey(dbUser.Email), Policy: auth.EmailLockoutPolicy}
+	retryAfter, err := cfg.beginLoginAttempt(r.Context(), emailAttempt)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return false
+	}
+	if retryAfter > 0 {
+		respondLocked(w, retryAfter)
+		return false
+	}
+
+	match, err := auth.CheckPasswordHash(password, dbUser.HashedPassword)
+	if err != nil {
+		log.Printf("❌ Ошибка проверки пароля: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return false
+	}
+	if !match {
+		log.Printf("❌ Неверный текущий пароль пользователя: %s", dbUser.ID)
+		helpers.RespondWithError(w, http.StatusForbidden, "Неверный пароль")
+		return false
+	}
+
+	cfg.refundLoginAttempt(r.Context(), emailAttempt)
+	return true
+}
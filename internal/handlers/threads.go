@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/IdrisovMarat/httpserver/internal/database"
+	"github.com/IdrisovMarat/httpserver/internal/helpers"
+	"github.com/IdrisovMarat/httpserver/internal/pagination"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxThreadDepth - сколько уровней ответов возвращается за один запрос.
+	// Более глубокие ответы загружаются запросом ветки вложенного chirp
+	maxThreadDepth = 10
+	// maxThreadRows - максимальное число ответов в дереве одной страницы
+	maxThreadRows = 500
+)
+
+// ThreadChirp - chirp в ветке обсуждения. Удаленный chirp, на который есть
+// ответы, остается в ветке надгробием: Deleted = true и пустой текст
+type ThreadChirp struct {
+	Chirp
+	Deleted    bool           `json:"deleted"`
+	ReplyCount int64          `json:"reply_count"`       // Число прямых ответов
+	Replies    []*ThreadChirp `json:"replies,omitempty"` // Загруженные ответы в порядке публикации
+}
+
+// Thread - ветка обсуждения вокруг chirp
+type Thread struct {
+	Ancestors []*ThreadChirp `json:"ancestors"` // Предки от первого chirp ветки до родителя
+	Chirp     *ThreadChirp   `json:"chirp"`     // Запрошенный chirp с деревом ответов
+	Next      string         `json:"next,omitempty"`
+}
+
+func threadChirpFromDB(row database.ListThreadRepliesRow) *ThreadChirp {
+	return &ThreadChirp{
+		Chirp: Chirp{
+			ID:        row.ID,
+			CreatedAt: row.CreatedAt.Format(time.RFC3339Nano),
+			UpdatedAt: row.UpdatedAt.Format(time.RFC3339Nano),
+			Body:      row.Body,
+			UserID:    nullUUIDPtr(row.UserID),
+			Edited:    row.EditedAt.Valid,
+			InReplyTo: nullUUIDPtr(row.ParentID),
+			RootID:    nullUUIDPtr(row.RootID),
+			LikeCount: row.LikeCount,
+			QuoteOf:   nullUUIDPtr(row.QuoteOfID),
+		},
+		Deleted:    row.DeletedAt.Valid,
+		ReplyCount: row.ReplyCount,
+	}
+}
+
+// GetChirpThreadHandler возвращает ветку обсуждения chirp: цепочку предков и
+// дерево ответов. Пагинация (limit, after) - по прямым ответам chirp, каждый
+// приходит со своими ответами до maxThreadDepth уровней
+func (cfg *ApiConfig) GetChirpThreadHandler(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат ID chirp")
+		return
+	}
+
+	query := r.URL.Query()
+	limit, err := pagination.ParseLimit(query.Get("limit"))
+	if err != nil {
+		helpers.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 🔐 Курсор подписан сервером, подделанный или чужой курсор отклоняем
+	params := database.ListThreadRepliesParams{
+		ChirpID:   chirpID,
+		PageLimit: int32(limit + 1), // +1 - признак следующей страницы
+	}
+	if after := query.Get("after"); after != "" {
+		cursor, err := pagination.Decode(after, cursorKindThread, cfg.CursorSecret)
+		if err != nil {
+			log.Printf("❌ Неверный курсор пагинации: %v", err)
+			helpers.RespondWithError(w, http.StatusBadRequest, "Неверный курсор")
+			return
+		}
+		params.CursorCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+	}
+
+	// Сам chirp (depth 0) и его предки, от первого chirp ветки
+	ancestorRows, err := cfg.Db.ListThreadAncestors(r.Context(), chirpID)
+	if err != nil {
+		log.Printf("❌ Ошибка получения ветки chirp %s: %v", chirpID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось получить ветку")
+		return
+	}
+	if len(ancestorRows) == 0 {
+		helpers.RespondWithError(w, http.StatusNotFound, "Chirp не найден")
+		return
+	}
+
+	replyRows, err := cfg.Db.ListThreadReplies(r.Context(), params)
+	if err != nil {
+		log.Printf("❌ Ошибка получения ответов на chirp %s: %v", chirpID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось получить ветку")
+		return
+	}
+
+	thread := Thread{Ancestors: make([]*ThreadChirp, 0, len(ancestorRows)-1)}
+	for _, row := range ancestorRows[:len(ancestorRows)-1] {
+		thread.Ancestors = append(thread.Ancestors, threadChirpFromDB(database.ListThreadRepliesRow(row)))
+	}
+	thread.Chirp = threadChirpFromDB(database.ListThreadRepliesRow(ancestorRows[len(ancestorRows)-1]))
+
+	// Лишний прямой ответ только сообщает о следующей странице
+	hasMore := len(replyRows) > limit
+	if hasMore {
+		replyRows = replyRows[:limit]
+	}
+
+	// 🌳 Дерево загружается по уровням: каждый запрос читает только ответы на
+	// chirps предыдущего уровня и не больше оставшегося бюджета строк, поэтому
+	// большое поддерево не обходится целиком ради одной страницы. Внутри уровня
+	// строки идут по времени, и ответы каждого chirp добавляются в порядке
+	// публикации
+	nodes := map[uuid.UUID]*ThreadChirp{chirpID: thread.Chirp}
+	level := replyRows
+	budget := maxThreadRows
+	for depth := int32(2); ; depth++ {
+		if len(level) > budget {
+			level = level[:budget]
+		}
+		budget -= len(level)
+
+		parentIDs := make([]uuid.UUID, 0, len(level))
+		for _, row := range level {
+			parent, ok := nodes[row.ParentID.UUID]
+			if !ok {
+				continue
+			}
+			node := threadChirpFromDB(row)
+			parent.Replies = append(parent.Replies, node)
+			nodes[row.ID] = node
+			if row.ReplyCount > 0 {
+				parentIDs = append(parentIDs, row.ID)
+			}
+		}
+
+		if depth > maxThreadDepth || budget == 0 || len(parentIDs) == 0 {
+			break
+		}
+
+		levelRows, err := cfg.Db.ListThreadLevel(r.Context(), database.ListThreadLevelParams{
+			Depth:     depth,
+			ParentIds: parentIDs,
+			RowLimit:  int32(budget),
+		})
+		if err != nil {
+			log.Printf("❌ Ошибка получения ответов ветки chirp %s: %v", chirpID, err)
+			helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось получить ветку")
+			return
+		}
+		level = make([]database.ListThreadRepliesRow, len(levelRows))
+		for i, row := range levelRows {
+			level[i] = database.ListThreadRepliesRow(row)
+		}
+	}
+
+	// ❤️ Процитированные chirps и liked_by_me для всей ветки
+	decorated := make([]*Chirp, 0, len(nodes)+len(thread.Ancestors))
+	for _, node := range nodes {
+		decorated = append(decorated, &node.Chirp)
+	}
+	for _, ancestor := range thread.Ancestors {
+		decorated = append(decorated, &ancestor.Chirp)
+	}
+	if err := cfg.decorateChirps(r.Context(), decorated); err != nil {
+		log.Printf("❌ Ошибка получения цитат и лайков ветки chirp %s: %v", chirpID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось получить ветку")
+		return
+	}
+
+	if hasMore {
+		last := replyRows[len(replyRows)-1]
+		thread.Next = pagination.PageURL(r.URL, "after", pagination.Encode(pagination.Cursor{Kind: cursorKindThread, CreatedAt: last.CreatedAt, ID: last.ID}, cfg.CursorSecret))
+		w.Header().Set("Link", pagination.LinkHeader(thread.Next, ""))
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, thread)
+}
+
+// deleteChirp удаляет chirp в одной транзакции вместе с его rechirps. Chirp с
+// ответами или цитатами становится надгробием (без текста и истории правок),
+// чтобы ветка не распалась, а цитаты показывали удаленный оригинал; после
+// удаления последней ссылки надгробия без ответов и цитат удаляются тоже.
+// sql.ErrNoRows - chirp не найден или уже удален
+func (cfg *ApiConfig) deleteChirp(ctx context.Context, chirpID uuid.UUID) error {
+	tx, err := cfg.DBConn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.Db.WithTx(tx)
+
+	// Блокировка ждет завершения параллельных ответов на этот chirp (они
+	// удерживают ссылку на него), поэтому проверка ответов ниже актуальна
+	dbChirp, err := qtx.GetChirpForUpdate(ctx, chirpID)
+	if err != nil {
+		return err
+	}
+	if dbChirp.DeletedAt.Valid {
+		return sql.ErrNoRows
+	}
+
+	// Rechirps не переживают оригинал, даже если он остается надгробием
+	if err := qtx.DeleteRechirpsOf(ctx, chirpID); err != nil {
+		return err
+	}
+
+	isReferenced, err := qtx.ChirpIsReferenced(ctx, chirpID)
+	if err != nil {
+		return err
+	}
+
+	if isReferenced {
+		if err := qtx.TombstoneChirp(ctx, chirpID); err != nil {
+			return err
+		}
+		if err := qtx.DeleteChirpRevisions(ctx, chirpID); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	if err := qtx.DeleteChirp(ctx, chirpID); err != nil {
+		return err
+	}
+
+	// 🧹 Удаляем надгробия, на которые больше никто не ссылается: родителя и
+	// процитированный chirp, а от них - дальше по ветке и цитатам
+	candidates := []uuid.NullUUID{dbChirp.ParentID, dbChirp.QuoteOfID}
+	for len(candidates) > 0 {
+		id := candidates[len(candidates)-1]
+		candidates = candidates[:len(candidates)-1]
+		if !id.Valid {
+			continue
+		}
+
+		refs, err := qtx.DeleteOrphanTombstone(ctx, id.UUID)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		candidates = append(candidates, refs.ParentID, refs.QuoteOfID)
+	}
+
+	return tx.Commit()
+}
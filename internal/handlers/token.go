@@ -2,23 +2,137 @@ package handlers
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
 	"net/http"
 	"time"
 
 	"github.com/IdrisovMarat/httpserver/internal/auth"
+	"github.com/IdrisovMarat/httpserver/internal/database"
 	"github.com/IdrisovMarat/httpserver/internal/helpers"
+	"github.com/google/uuid"
 )
 
+const (
+	// AccessTokenTTL - срок жизни access token (JWT)
+	AccessTokenTTL = time.Hour
+	// refreshTokenTTL - срок жизни refresh token (продлевается при каждой ротации)
+	refreshTokenTTL = 60 * 24 * time.Hour
+)
+
+// LoginResponse - ответ на успешный вход: пользователь и выданные токены.
+// При входе с токенами в cookie вместо токенов возвращается CSRFToken
+type LoginResponse struct {
+	User
+	Token        string `json:"token,omitempty"`         // Access token (JWT)
+	RefreshToken string `json:"refresh_token,omitempty"` // Refresh token
+	CSRFToken    string `json:"csrf_token,omitempty"`    // Повторяется в заголовке X-CSRF-Token
+}
+
+// issueTokens создает access token и refresh token, открывающий новое
+// семейство ротации. Вызывается после завершения всех шагов аутентификации.
+// Для сессии на cookie (wantsCookieSession) access token привязывается к CSRF токену
+func (cfg *ApiConfig) issueTokens(r *http.Request, dbUser database.User) (LoginResponse, error) {
+	// Каждый вход открывает новую сессию - семейство refresh tokens
+	sessionID := uuid.New()
+
+	var csrfToken, csrfHash string
+	if wantsCookieSession(r) {
+		var err error
+		csrfToken, err = auth.MakeCSRFToken()
+		if err != nil {
+			return LoginResponse{}, fmt.Errorf("ошибка создания CSRF токена: %w", err)
+		}
+		csrfHash = auth.HashToken(csrfToken)
+	}
+
+	// Создаем JWT токен с ролью и scopes пользователя
+	token, err := cfg.Keys.MakeAccessToken(auth.Principal{
+		UserID:       dbUser.ID,
+		Role:         dbUser.Role,
+		SessionID:    sessionID,
+		TokenVersion: dbUser.TokenVersion,
+		CSRFHash:     csrfHash,
+	}, AccessTokenTTL)
+	if err != nil {
+		return LoginResponse{}, fmt.Errorf("ошибка создания access token: %w", err)
+	}
+
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return LoginResponse{}, fmt.Errorf("ошибка создания refresh token: %w", err)
+	}
+
+	// Сохраняем в базе только хеш refresh token
+	userAgent, ip := cfg.clientInfo(r)
+	_, err = cfg.Db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		TokenHash: auth.HashToken(refreshToken),
+		UserID:    dbUser.ID,
+		ExpiresAt: time.Now().Add(refreshTokenTTL), // 60 дней
+		FamilyID:  sessionID,
+		UserAgent: userAgent,
+		Ip:        ip,
+	})
+	if err != nil {
+		return LoginResponse{}, fmt.Errorf("ошибка сохранения refresh token: %w", err)
+	}
+
+	// Production: Логируем выдачу токенов для аудита
+	log.Printf("🔐 Создан access token (1h) и refresh token (60d) для пользователя: %s", dbUser.ID)
+
+	return LoginResponse{
+		User:         userFromDB(dbUser),
+		Token:        token,
+		RefreshToken: refreshToken,
+		CSRFToken:    csrfToken,
+	}, nil
+}
+
+// respondWithLogin отправляет ответ на успешный вход. Для сессии на cookie
+// токены устанавливаются в HttpOnly cookie и не попадают в тело ответа
+func (cfg *ApiConfig) respondWithLogin(w http.ResponseWriter, resp LoginResponse) {
+	if resp.CSRFToken != "" {
+		cfg.setSessionCookies(w, resp.Token, resp.RefreshToken, resp.CSRFToken)
+		resp.Token = ""
+		resp.RefreshToken = ""
+	}
+	helpers.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// refreshTokenFromRequest извлекает refresh token из заголовка Authorization,
+// а при его отсутствии - из cookie сессии (fromCookie). Для cookie проверяется
+// CSRF токен: errCSRF означает, что заголовок X-CSRF-Token не совпал с cookie
+func refreshTokenFromRequest(r *http.Request) (token string, fromCookie bool, err error) {
+	token, err = auth.GetBearerToken(r.Header)
+	if err == nil {
+		return token, false, nil
+	}
+
+	token = cookieValue(r, refreshTokenCookie)
+	if token == "" {
+		return "", false, err
+	}
+	if !checkDoubleSubmit(r) {
+		return "", true, errCSRF
+	}
+	return token, true, nil
+}
+
 func (cfg *ApiConfig) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 	type response struct {
-		Token string `json:"token"` // Новый access token
+		Token        string `json:"token,omitempty"`         // Новый access token
+		RefreshToken string `json:"refresh_token,omitempty"` // Новый refresh token (старый отозван)
+		CSRFToken    string `json:"csrf_token,omitempty"`    // Новый CSRF токен сессии на cookie
 	}
 
-	// Извлекаем refresh token из заголовка
-	tokenString, err := auth.GetBearerToken(r.Header)
+	// Извлекаем refresh token из заголовка или cookie
+	tokenString, fromCookie, err := refreshTokenFromRequest(r)
 	if err != nil {
 		log.Printf("❌ Ошибка извлечения refresh token: %v", err)
+		if err == errCSRF {
+			helpers.RespondWithError(w, http.StatusForbidden, "Неверный CSRF токен")
+			return
+		}
 		helpers.RespondWithError(w, http.StatusUnauthorized, "Неверный или отсутствующий токен")
 		return
 	}
@@ -32,11 +146,11 @@ func (cfg *ApiConfig) RefreshTokenHandler(w http.ResponseWriter, r *http.Request
 
 	log.Printf("🔄 Попытка обновления токена с refresh token: %s...", tokenString[:8])
 
-	// Ищем пользователя по валидному refresh token
-	dbUser, err := cfg.Db.GetUserFromRefreshToken(r.Context(), tokenString)
+	// Ищем refresh token по хешу (в том числе отозванный - для обнаружения повторного использования)
+	dbToken, err := cfg.Db.GetRefreshToken(r.Context(), auth.HashToken(tokenString))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			log.Printf("❌ Refresh token не найден или невалиден: %s...", tokenString[:8])
+			log.Printf("❌ Refresh token не найден: %s...", tokenString[:8])
 			helpers.RespondWithError(w, http.StatusUnauthorized, "Неверный или истекший токен")
 			return
 		}
@@ -45,35 +159,176 @@ func (cfg *ApiConfig) RefreshTokenHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// 🔐 Токен стороннего приложения не должен превращаться в токен со всеми scopes роли
+	if dbToken.ClientID.Valid {
+		log.Printf("❌ Refresh token OAuth клиента %s предъявлен в /api/refresh", dbToken.ClientID.UUID)
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Неверный или истекший токен")
+		return
+	}
+
+	if dbToken.RevokedAt.Valid {
+		// 🚨 БЕЗОПАСНОСТЬ: токен уже был ротирован - его предъявляет кто-то, кроме
+		// законного владельца (или владелец после кражи). Отзываем всё семейство
+		if dbToken.ReplacedByHash.Valid {
+			log.Printf("🚨 SECURITY: повторное использование ротированного refresh token %s... пользователя %s, отзываем семейство %s",
+				tokenString[:8], dbToken.UserID, dbToken.FamilyID)
+
+			if err := cfg.Db.RevokeRefreshTokenFamily(r.Context(), dbToken.FamilyID); err != nil {
+				log.Printf("❌ Ошибка отзыва семейства refresh tokens %s: %v", dbToken.FamilyID, err)
+				helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+				return
+			}
+		} else {
+			log.Printf("❌ Refresh token отозван: %s...", tokenString[:8])
+		}
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Неверный или истекший токен")
+		return
+	}
+
+	if time.Now().After(dbToken.ExpiresAt) {
+		log.Printf("❌ Refresh token истек: %s...", tokenString[:8])
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Неверный или истекший токен")
+		return
+	}
+
+	// Роль могла измениться с момента входа - берем актуальную из БД
+	dbUser, err := cfg.Db.GetUserByID(r.Context(), dbToken.UserID)
+	if err != nil {
+		log.Printf("❌ Ошибка получения пользователя %s: %v", dbToken.UserID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	if dbUser.BannedAt.Valid {
+		log.Printf("❌ Попытка обновления токена заблокированным пользователем: %s", dbUser.ID)
+		helpers.RespondWithError(w, http.StatusForbidden, "Аккаунт заблокирован")
+		return
+	}
+
+	// 🔄 РОТАЦИЯ: выдаем новый refresh token в том же семействе
+	newRefreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("❌ Ошибка создания refresh token: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось создать токен")
+		return
+	}
+
+	err = cfg.rotateRefreshToken(r, dbToken, newRefreshToken)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// Токен был ротирован параллельным запросом между чтением и обновлением
+			log.Printf("⚠️ Refresh token уже ротирован параллельным запросом: %s...", tokenString[:8])
+			helpers.RespondWithError(w, http.StatusUnauthorized, "Неверный или истекший токен")
+			return
+		}
+		log.Printf("❌ Ошибка ротации refresh token: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось создать токен")
+		return
+	}
+
+	// Сессия на cookie получает новый CSRF токен вместе с access token
+	var csrfToken, csrfHash string
+	if fromCookie {
+		csrfToken, err = auth.MakeCSRFToken()
+		if err != nil {
+			log.Printf("❌ Ошибка создания CSRF токена: %v", err)
+			helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось создать токен")
+			return
+		}
+		csrfHash = auth.HashToken(csrfToken)
+	}
+
 	// Создаем новый access token
-	accessToken, err := auth.MakeJWT(dbUser.ID, cfg.JWTsecret, time.Hour)
+	accessToken, err := cfg.Keys.MakeAccessToken(auth.Principal{
+		UserID:       dbUser.ID,
+		Role:         dbUser.Role,
+		SessionID:    dbToken.FamilyID,
+		TokenVersion: dbUser.TokenVersion,
+		CSRFHash:     csrfHash,
+	}, AccessTokenTTL)
 	if err != nil {
 		log.Printf("❌ Ошибка создания access token: %v", err)
 		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось создать токен")
 		return
 	}
 
-	log.Printf("✅ Успешное обновление access token для пользователя: %s", dbUser.ID)
+	log.Printf("✅ Успешное обновление access token для пользователя: %s", dbToken.UserID)
 
 	// Production: Логируем обновление токена для аудита
-	log.Printf("🔄 Выдан новый access token для пользователя: %s", dbUser.ID)
+	log.Printf("🔄 Выданы новые access и refresh токены для пользователя: %s (семейство %s)", dbToken.UserID, dbToken.FamilyID)
+
+	if fromCookie {
+		cfg.setSessionCookies(w, accessToken, newRefreshToken, csrfToken)
+		helpers.RespondWithJSON(w, http.StatusOK, response{CSRFToken: csrfToken})
+		return
+	}
 
 	resp := response{
-		Token: accessToken,
+		Token:        accessToken,
+		RefreshToken: newRefreshToken,
 	}
 
 	helpers.RespondWithJSON(w, http.StatusOK, resp)
 }
 
+// rotateRefreshToken в одной транзакции отзывает старый токен и сохраняет новый
+// в том же семействе (с тем же OAuth клиентом и scopes). sql.ErrNoRows
+// означает, что старый токен уже неактивен
+func (cfg *ApiConfig) rotateRefreshToken(r *http.Request, old database.RefreshToken, newToken string) error {
+	ctx := r.Context()
+	tx, err := cfg.DBConn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.Db.WithTx(tx)
+	userAgent, ip := cfg.clientInfo(r)
+
+	_, err = qtx.RotateRefreshToken(ctx, database.RotateRefreshTokenParams{
+		TokenHash:      old.TokenHash,
+		ReplacedByHash: sql.NullString{String: auth.HashToken(newToken), Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = qtx.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+		TokenHash: auth.HashToken(newToken),
+		UserID:    old.UserID,
+		ExpiresAt: time.Now().Add(refreshTokenTTL),
+		FamilyID:  old.FamilyID,
+		// Сессия показывает последнее устройство и адрес, с которых она использовалась
+		UserAgent: userAgent,
+		Ip:        ip,
+		ClientID:  old.ClientID,
+		Scopes:    old.Scopes,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 func (cfg *ApiConfig) RevokeTokenHandler(w http.ResponseWriter, r *http.Request) {
-	// Извлекаем refresh token из заголовка
-	tokenString, err := auth.GetBearerToken(r.Header)
+	// Извлекаем refresh token из заголовка или cookie
+	tokenString, fromCookie, err := refreshTokenFromRequest(r)
 	if err != nil {
 		log.Printf("❌ Ошибка извлечения refresh token для отзыва: %v", err)
+		if err == errCSRF {
+			helpers.RespondWithError(w, http.StatusForbidden, "Неверный CSRF токен")
+			return
+		}
 		helpers.RespondWithError(w, http.StatusUnauthorized, "Неверный или отсутствующий токен")
 		return
 	}
 
+	// Выход из сессии на cookie: браузер забывает токены в любом случае
+	if fromCookie {
+		cfg.clearSessionCookies(w)
+	}
+
 	// Production: Проверяем формат токена
 	if len(tokenString) != 64 {
 		log.Printf("❌ Неверный формат refresh token при отзыве")
@@ -83,8 +338,8 @@ func (cfg *ApiConfig) RevokeTokenHandler(w http.ResponseWriter, r *http.Request)
 
 	log.Printf("🔄 Попытка отзыва refresh token: %s...", tokenString[:8])
 
-	// Отзываем токен в базе
-	err = cfg.Db.RevokeRefreshToken(r.Context(), tokenString)
+	// Отзываем токен в базе (поиск по хешу)
+	err = cfg.Db.RevokeRefreshToken(r.Context(), auth.HashToken(tokenString))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			// Production: Даже если токен не найден, возвращаем 204 для безопасности
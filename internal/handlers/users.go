@@ -1,8 +1,11 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"strings"
@@ -11,6 +14,7 @@ import (
 	"github.com/IdrisovMarat/httpserver/internal/auth"
 	"github.com/IdrisovMarat/httpserver/internal/database"
 	"github.com/IdrisovMarat/httpserver/internal/helpers"
+	"github.com/IdrisovMarat/httpserver/internal/mailer"
 	"github.com/google/uuid"
 )
 
@@ -21,6 +25,35 @@ type User struct {
 	UpdatedAt   time.Time `json:"updated_at"`
 	Email       string    `json:"email"`
 	IsChirpyRed bool      `json:"is_chirpy_red"`
+	Role        string    `json:"role"`
+	// EmailVerified - подтвержден ли email (без подтверждения нельзя создавать chirps)
+	EmailVerified bool `json:"email_verified"`
+	// PendingEmail - новый email, который станет основным после подтверждения
+	PendingEmail string `json:"pending_email,omitempty"`
+	// Banned - аккаунт заблокирован администратором
+	Banned bool `json:"banned,omitempty"`
+
+	FollowerCount  int32 `json:"follower_count"`
+	FollowingCount int32 `json:"following_count"`
+}
+
+// userFromDB конвертирует пользователя из БД в API формат (без пароля)
+func userFromDB(dbUser database.User) User {
+	return User{
+		ID:          dbUser.ID,
+		CreatedAt:   dbUser.CreatedAt,
+		UpdatedAt:   dbUser.UpdatedAt,
+		Email:       dbUser.Email,
+		IsChirpyRed: dbUser.IsChirpyRed,
+		Role:        dbUser.Role,
+
+		EmailVerified: dbUser.EmailVerifiedAt.Valid,
+		PendingEmail:  dbUser.PendingEmail.String,
+		Banned:        dbUser.BannedAt.Valid,
+
+		FollowerCount:  dbUser.FollowerCount,
+		FollowingCount: dbUser.FollowingCount,
+	}
 }
 
 func (cfg *ApiConfig) CreateUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -49,6 +82,11 @@ func (cfg *ApiConfig) CreateUserHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// 🛡️ ВАЛИДАЦИЯ: длина, совпадение с email и утекшие пароли
+	if !cfg.checkPasswordPolicy(w, r, reqBody.Password, reqBody.Email) {
+		return
+	}
+
 	log.Printf("🔄 Попытка создать пользователя с email: %s", reqBody.Email)
 
 	// Хешируем пароль
@@ -79,16 +117,15 @@ func (cfg *ApiConfig) CreateUserHandler(w http.ResponseWriter, r *http.Request)
 
 	log.Printf("✅ Пользователь создан успешно. ID: %s", dbUser.ID)
 
-	// Конвертируем пользователя из БД в API формат
-	user := User{
-		ID:          dbUser.ID,
-		CreatedAt:   dbUser.CreatedAt,
-		UpdatedAt:   dbUser.UpdatedAt,
-		Email:       dbUser.Email,
-		IsChirpyRed: dbUser.IsChirpyRed,
+	// 📧 Отправляем письмо для подтверждения email. При ошибке пользователь
+	// может запросить письмо повторно
+	err = cfg.sendEmailVerification(r.Context(), dbUser.ID, dbUser.Email)
+	if err != nil {
+		log.Printf("⚠️ %v", err)
 	}
 
-	helpers.RespondWithJSON(w, http.StatusCreated, user)
+	// Конвертируем пользователя из БД в API формат
+	helpers.RespondWithJSON(w, http.StatusCreated, userFromDB(dbUser))
 }
 
 func (cfg *ApiConfig) LoginHandler(w http.ResponseWriter, r *http.Request) {
@@ -97,12 +134,6 @@ func (cfg *ApiConfig) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		Password string `json:"password"`
 	}
 
-	type response struct {
-		User
-		Token        string `json:"token"`         // Access token (JWT)
-		RefreshToken string `json:"refresh_token"` // Refresh token
-	}
-
 	decoder := json.NewDecoder(r.Body)
 	reqBody := requestBody{}
 	err := decoder.Decode(&reqBody)
@@ -126,11 +157,30 @@ func (cfg *ApiConfig) LoginHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("🔄 Попытка входа пользователя: %s", reqBody.Email)
 
+	// 🛡️ Защита от перебора: блокировка по email и по IP клиента. Попытка
+	// засчитывается неудачной до проверки пароля
+	emailKey := emailAttemptKey(reqBody.Email)
+	ipAttempt := loginAttempt{Key: ipAttemptKey(helpers.ClientIP(r, cfg.TrustProxy)), Policy: auth.IPLockoutPolicy}
+
+	retryAfter, err := cfg.beginLoginAttempt(r.Context(), loginAttempt{Key: emailKey, Policy: auth.EmailLockoutPolicy}, ipAttempt)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+	if retryAfter > 0 {
+		log.Printf("⚠️ Вход заблокирован для %s / %s ещё на %v", emailKey, ipAttempt.Key, retryAfter)
+		respondLocked(w, retryAfter)
+		return
+	}
+
 	// Ищем пользователя по email
 	dbUser, err := cfg.Db.GetUserByEmail(r.Context(), reqBody.Email)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			log.Printf("❌ Пользователь с email %s не найден", reqBody.Email)
+			// Production: тратим столько же времени, сколько на проверку настоящего пароля
+			auth.CheckDummyPassword(reqBody.Password)
 			helpers.RespondWithError(w, http.StatusUnauthorized, "Неверный email или пароль")
 			return
 		}
@@ -139,6 +189,21 @@ func (cfg *ApiConfig) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Аккаунты без пароля (созданные до миграции 003, через OIDC или вход по
+	// ссылке) войти по паролю не могут: пароль задается через сброс по email,
+	// и письмо со ссылкой отправляется в фоне через те же лимиты, что и
+	// POST /api/password-reset. Production: ответ и счетчики ошибок как при
+	// неверном пароле, иначе по ответу можно узнать, что аккаунт существует
+	if dbUser.HashedPassword == auth.UnsetPasswordHash {
+		auth.CheckDummyPassword(reqBody.Password)
+		log.Printf("⚠️ Попытка входа по паролю пользователя без пароля: %s", dbUser.ID)
+		if _, err := cfg.startPasswordReset(r.Context(), dbUser.Email, helpers.ClientIP(r, cfg.TrustProxy)); err != nil {
+			log.Printf("❌ %v", err)
+		}
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Неверный email или пароль")
+		return
+	}
+
 	// Проверяем пароль
 	match, err := auth.CheckPasswordHash(reqBody.Password, dbUser.HashedPassword)
 	if err != nil {
@@ -153,79 +218,88 @@ func (cfg *ApiConfig) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Создаем JWT токен
-	token, err := auth.MakeJWT(dbUser.ID, cfg.JWTsecret, time.Hour)
+	// Пароль верный - сбрасываем счетчик ошибок для email, а для IP только
+	// возвращаем засчитанную попытку
+	err = cfg.Db.ClearLoginAttempts(r.Context(), []string{emailKey})
 	if err != nil {
-		log.Printf("❌ Ошибка создания JWT токена: %v", err)
-		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось создать токен")
+		log.Printf("⚠️ Ошибка сброса счетчика попыток входа: %v", err)
+	}
+	cfg.refundLoginAttempt(r.Context(), ipAttempt)
+
+	// 🔐 Хеш со слабыми параметрами Argon2id заменяем, пока пароль известен
+	if auth.NeedsRehash(dbUser.HashedPassword) {
+		cfg.rehashPassword(r.Context(), dbUser, reqBody.Password)
+	}
+
+	cfg.completeLogin(w, r, dbUser)
+}
+
+// completeLogin завершает вход пользователя, подтвердившего личность (пароль,
+// внешний провайдер): для заблокированных - 403, при включенном TOTP - MFA
+// токен для второго шага, иначе - access и refresh токены
+func (cfg *ApiConfig) completeLogin(w http.ResponseWriter, r *http.Request, dbUser database.User) {
+	type mfaChallenge struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`  // Обменивается на токены в POST /api/login/mfa
+		ExpiresIn   int    `json:"expires_in"` // Срок жизни mfa_token в секундах
+	}
+
+	if dbUser.BannedAt.Valid {
+		log.Printf("❌ Попытка входа заблокированного пользователя: %s", dbUser.ID)
+		helpers.RespondWithError(w, http.StatusForbidden, "Аккаунт заблокирован")
 		return
 	}
 
-	// Создаем refresh token (60 дней)
-	refreshToken, err := auth.MakeRefreshToken()
-	if err != nil {
-		log.Printf("❌ Ошибка создания refresh token: %v", err)
-		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось создать токен")
+	// 🔐 2FA: при включенном TOTP токены выдаются только после проверки кода
+	if dbUser.TotpEnabledAt.Valid {
+		mfaToken, err := cfg.Keys.MakeChallengeToken(dbUser.ID, auth.AudienceMFA, mfaTokenTTL)
+		if err != nil {
+			log.Printf("❌ Ошибка создания MFA токена: %v", err)
+			helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось создать токен")
+			return
+		}
+
+		log.Printf("🔐 Первый фактор пройден, ожидается второй для пользователя: %s", dbUser.ID)
+		helpers.RespondWithJSON(w, http.StatusOK, mfaChallenge{
+			MFARequired: true,
+			MFAToken:    mfaToken,
+			ExpiresIn:   int(mfaTokenTTL.Seconds()),
+		})
 		return
 	}
 
-	// Сохраняем refresh token в базе
-	_, err = cfg.Db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-		Token:     refreshToken,
-		UserID:    dbUser.ID,
-		ExpiresAt: time.Now().Add(60 * 24 * time.Hour), // 60 дней
-	})
+	resp, err := cfg.issueTokens(r, dbUser)
 	if err != nil {
-		log.Printf("❌ Ошибка сохранения refresh token: %v", err)
+		log.Printf("❌ %v", err)
 		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось создать токен")
 		return
 	}
 
 	log.Printf("✅ Успешный вход пользователя: %s", dbUser.ID)
-	// Production: Логируем успешный вход для аудита
-	log.Printf("🔐 Создан access token (1h) и refresh token (60d) для пользователя: %s", dbUser.ID)
 
 	// Возвращаем пользователя без пароля
-	resp := response{
-		User: User{
-			ID:          dbUser.ID,
-			CreatedAt:   dbUser.CreatedAt,
-			UpdatedAt:   dbUser.UpdatedAt,
-			Email:       dbUser.Email,
-			IsChirpyRed: dbUser.IsChirpyRed,
-		},
-		Token:        token,
-		RefreshToken: refreshToken,
-	}
-
-	helpers.RespondWithJSON(w, http.StatusOK, resp)
+	cfg.respondWithLogin(w, resp)
 }
 
 func (cfg *ApiConfig) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
-	// 🔐 АУТЕНТИФИКАЦИЯ: Проверяем access token
-	tokenString, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		log.Printf("❌ Ошибка извлечения токена: %v", err)
-		helpers.RespondWithError(w, http.StatusUnauthorized, "Неверный или отсутствующий токен")
-		return
-	}
-
-	// 🔐 АУТЕНТИФИКАЦИЯ: Валидируем JWT токен
-	userID, err := auth.ValidateJWT(tokenString, cfg.JWTsecret)
-	if err != nil {
-		log.Printf("❌ Ошибка валидации токена: %v", err)
-		helpers.RespondWithError(w, http.StatusUnauthorized, "Неверный токен")
+	// 🔐 АУТЕНТИФИКАЦИЯ: Пользователь аутентифицирован middleware RequireAuth
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Требуется аутентификация")
 		return
 	}
+	userID := principal.UserID
 
 	type requestBody struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		// sudoProof подтверждает изменение (если нет заголовка X-Sudo-Token)
+		sudoProof
 	}
 
 	decoder := json.NewDecoder(r.Body)
 	reqBody := requestBody{}
-	err = decoder.Decode(&reqBody)
+	err := decoder.Decode(&reqBody)
 	if err != nil {
 		log.Printf("❌ Ошибка декодирования JSON: %v", err)
 		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат запроса")
@@ -246,27 +320,53 @@ func (cfg *ApiConfig) UpdateUserHandler(w http.ResponseWriter, r *http.Request)
 
 	log.Printf("🔄 Попытка обновления пользователя: %s", userID)
 
-	// Подготавливаем данные для обновления
-	updateParams := database.UpdateUserParams{
-		ID: userID, // 🔐 АВТОРИЗАЦИЯ: Обновляем только текущего пользователя
+	currentUser, err := cfg.Db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		log.Printf("❌ Ошибка получения текущего пользователя: %v", err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
 	}
 
-	// Если указан email - обновляем его
-	if reqBody.Email != "" {
-		updateParams.Email = reqBody.Email
-	} else {
-		// Если email не указан, получаем текущий email из БД
-		currentUser, err := cfg.Db.GetUserByID(r.Context(), userID)
-		if err != nil {
-			log.Printf("❌ Ошибка получения текущего пользователя: %v", err)
+	// 📧 Новый email не применяется сразу: он станет основным только после
+	// подтверждения по ссылке, отправленной на новый адрес
+	emailChange := reqBody.Email != "" && reqBody.Email != currentUser.Email
+
+	// 🔐 Смена email или пароля требует подтверждения личности: одного
+	// украденного access token недостаточно для захвата аккаунта
+	if (emailChange || reqBody.Password != "") && !cfg.requireSudo(w, r, currentUser, reqBody.sudoProof) {
+		return
+	}
+
+	if emailChange {
+		_, err := cfg.Db.GetUserByEmail(r.Context(), reqBody.Email)
+		if err == nil {
+			helpers.RespondWithError(w, http.StatusConflict, "Email уже используется другим пользователем")
+			return
+		}
+		if err != sql.ErrNoRows {
+			log.Printf("❌ Ошибка поиска пользователя: %v", err)
 			helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
 			return
 		}
-		updateParams.Email = currentUser.Email
 	}
 
-	// Если указан пароль - хешируем и обновляем
+	// Подготавливаем данные для обновления
+	updateParams := database.UpdateUserParams{
+		ID:             userID, // 🔐 АВТОРИЗАЦИЯ: Обновляем только текущего пользователя
+		Email:          currentUser.Email,
+		HashedPassword: currentUser.HashedPassword,
+	}
+
+	// Если указан пароль - проверяем, хешируем и обновляем
 	if reqBody.Password != "" {
+		email := currentUser.Email
+		if emailChange {
+			email = reqBody.Email
+		}
+		if !cfg.checkPasswordPolicy(w, r, reqBody.Password, email) {
+			return
+		}
+
 		// 🛡️ БЕЗОПАСНОСТЬ: Хешируем пароль перед сохранением
 		hashedPassword, err := auth.HashPassword(reqBody.Password)
 		if err != nil {
@@ -275,19 +375,10 @@ func (cfg *ApiConfig) UpdateUserHandler(w http.ResponseWriter, r *http.Request)
 			return
 		}
 		updateParams.HashedPassword = hashedPassword
-	} else {
-		// Если пароль не указан, получаем текущий хеш из БД
-		currentUser, err := cfg.Db.GetUserByID(r.Context(), userID)
-		if err != nil {
-			log.Printf("❌ Ошибка получения текущего пользователя: %v", err)
-			helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
-			return
-		}
-		updateParams.HashedPassword = currentUser.HashedPassword
 	}
 
 	// 💾 ОБНОВЛЕНИЕ В БАЗЕ
-	updatedUser, err := cfg.Db.UpdateUser(r.Context(), updateParams)
+	updatedUser, err := cfg.updateUser(r.Context(), updateParams, reqBody.Password != "")
 	if err != nil {
 		log.Printf("❌ Ошибка обновления пользователя в БД: %v", err)
 
@@ -301,26 +392,225 @@ func (cfg *ApiConfig) UpdateUserHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// 🛡️ БЕЗОПАСНОСТЬ: Принудительно отзываем все refresh tokens при смене пароля
 	if reqBody.Password != "" {
-		err = cfg.Db.RevokeAllUserRefreshTokens(r.Context(), userID)
+		cfg.TokenStates.Invalidate(userID)
+		log.Printf("🔐 Отозваны все токены пользователя %s из-за смены пароля", userID)
+	}
+
+	if emailChange {
+		err = cfg.requestEmailChange(r.Context(), currentUser, reqBody.Email)
 		if err != nil {
-			log.Printf("⚠️ Ошибка отзыва refresh tokens: %v", err)
-			// Не прерываем выполнение, только логируем
+			log.Printf("❌ %v", err)
+			helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось обновить пользователя")
+			return
 		}
-		log.Printf("🔐 Отозваны все refresh tokens пользователя %s из-за смены пароля", userID)
+		updatedUser.PendingEmail = sql.NullString{String: reqBody.Email, Valid: true}
 	}
 
 	log.Printf("✅ Пользователь успешно обновлен: %s", userID)
 
 	// 📤 ОТВЕТ: Возвращаем обновленного пользователя (без пароля)
-	response := User{
-		ID:          updatedUser.ID,
-		CreatedAt:   updatedUser.CreatedAt,
-		UpdatedAt:   updatedUser.UpdatedAt,
-		Email:       updatedUser.Email,
-		IsChirpyRed: updatedUser.IsChirpyRed,
+	helpers.RespondWithJSON(w, http.StatusOK, userFromDB(updatedUser))
+}
+
+// updateUser в одной транзакции обновляет пользователя и при смене пароля
+// отзывает все refresh tokens, выданные access tokens (включая токен этого
+// запроса) и персональные токены, как и сброс пароля: пароль, ставший
+// известным, не должен оставлять открытых сессий
+func (cfg *ApiConfig) updateUser(ctx context.Context, params database.UpdateUserParams, passwordChanged bool) (database.User, error) {
+	tx, err := cfg.DBConn.BeginTx(ctx, nil)
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.Db.WithTx(tx)
+
+	dbUser, err := qtx.UpdateUser(ctx, params)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	if passwordChanged {
+		// 🛡️ БЕЗОПАСНОСТЬ: Принудительно отзываем все refresh tokens при смене пароля
+		err = qtx.RevokeAllUserRefreshTokens(ctx, params.ID)
+		if err != nil {
+			return database.User{}, err
+		}
+
+		dbUser.TokenVersion, err = qtx.BumpUserTokenVersion(ctx, params.ID)
+		if err != nil {
+			return database.User{}, err
+		}
+
+		err = qtx.RevokeAllPersonalAccessTokens(ctx, params.ID)
+		if err != nil {
+			return database.User{}, err
+		}
+	}
+
+	return dbUser, tx.Commit()
+}
+
+// requestEmailChange сохраняет новый email как ожидающий подтверждения,
+// отправляет ссылку на новый адрес и уведомляет владельца старого
+func (cfg *ApiConfig) requestEmailChange(ctx context.Context, dbUser database.User, newEmail string) error {
+	err := cfg.Db.SetUserPendingEmail(ctx, database.SetUserPendingEmailParams{
+		ID:           dbUser.ID,
+		PendingEmail: sql.NullString{String: newEmail, Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения нового email: %w", err)
+	}
+
+	err = cfg.sendEmailVerification(ctx, dbUser.ID, newEmail)
+	if err != nil {
+		return err
+	}
+
+	// 🛡️ БЕЗОПАСНОСТЬ: владелец старого адреса узнает о попытке смены
+	go cfg.sendMail(mailer.Message{
+		To:      dbUser.Email,
+		Subject: "Смена email в Chirpy",
+		Body: "Для вашего аккаунта запрошена смена email. Адрес изменится только после\n" +
+			"подтверждения по ссылке, отправленной на новый адрес.\n" +
+			"Если это были не вы, смените пароль.\n",
+	})
+
+	log.Printf("📧 Запрошена смена email пользователя: %s", dbUser.ID)
+	return nil
+}
+
+// DeleteUserHandler удаляет аккаунт текущего пользователя вместе с chirps и
+// всеми токенами. Требует current_password в теле или заголовок X-Sudo-Token
+func (cfg *ApiConfig) DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		helpers.RespondWithError(w, http.StatusUnauthorized, "Требуется аутентификация")
+		return
+	}
+
+	type requestBody struct {
+		sudoProof
+	}
+
+	// Тело необязательно: с sudo токеном его можно не передавать
+	decoder := json.NewDecoder(r.Body)
+	reqBody := requestBody{}
+	err := decoder.Decode(&reqBody)
+	if err != nil && err != io.EOF {
+		log.Printf("❌ Ошибка декодирования JSON: %v", err)
+		helpers.RespondWithError(w, http.StatusBadRequest, "Неверный формат запроса")
+		return
+	}
+
+	dbUser, err := cfg.Db.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		log.Printf("❌ Ошибка получения пользователя %s: %v", principal.UserID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Внутренняя ошибка сервера")
+		return
+	}
+
+	if !cfg.requireSudo(w, r, dbUser, reqBody.sudoProof) {
+		return
+	}
+
+	// Chirps удаляются или остаются надгробиями, лайки, подписки, refresh и
+	// персональные токены удаляются каскадно
+	err = cfg.deleteUser(r.Context(), dbUser.ID)
+	if err != nil {
+		log.Printf("❌ Ошибка удаления пользователя %s: %v", dbUser.ID, err)
+		helpers.RespondWithError(w, http.StatusInternalServerError, "Не удалось удалить аккаунт")
+		return
+	}
+
+	// Выданные access tokens перестают приниматься: пользователя больше нет
+	cfg.TokenStates.Invalidate(dbUser.ID)
+
+	log.Printf("🗑️ Пользователь %s удалил свой аккаунт", dbUser.ID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteUser удаляет пользователя в одной транзакции с уменьшением счетчиков
+// лайков chirps, которые он отметил, и подписок и подписчиков связанных с ним
+// пользователей (сами лайки и подписки удаляются каскадно). Chirps удаляются
+// как в deleteChirp: на которые есть ответы или цитаты, остаются надгробиями
+// без автора, остальные удаляются вместе с rechirps и осиротевшими надгробиями
+func (cfg *ApiConfig) deleteUser(ctx context.Context, userID uuid.UUID) error {
+	tx, err := cfg.DBConn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.Db.WithTx(tx)
+
+	if err := qtx.DecrementUserLikedChirpCounts(ctx, userID); err != nil {
+		return err
+	}
+	if err := qtx.DecrementFolloweeCounts(ctx, userID); err != nil {
+		return err
+	}
+	if err := qtx.DecrementFollowerCounts(ctx, userID); err != nil {
+		return err
 	}
 
-	helpers.RespondWithJSON(w, http.StatusOK, response)
+	// 🪦 Все chirps пользователя становятся надгробиями, затем по уровням
+	// удаляются надгробия без ответов и цитат - его и освободившиеся чужие
+	if err := qtx.DeleteRechirpsOfUserChirps(ctx, userID); err != nil {
+		return err
+	}
+	if err := qtx.DeleteUserChirpRevisions(ctx, userID); err != nil {
+		return err
+	}
+	candidates, err := qtx.TombstoneUserChirps(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for len(candidates) > 0 {
+		refs, err := qtx.DeleteOrphanTombstones(ctx, candidates)
+		if err != nil {
+			return err
+		}
+		candidates = candidates[:0]
+		for _, ref := range refs {
+			if ref.ParentID.Valid {
+				candidates = append(candidates, ref.ParentID.UUID)
+			}
+			if ref.QuoteOfID.Valid {
+				candidates = append(candidates, ref.QuoteOfID.UUID)
+			}
+		}
+	}
+
+	// Оставшиеся надгробия теряют автора (ON DELETE SET NULL)
+	if err := qtx.DeleteUser(ctx, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// rehashPassword сохраняет хеш пароля с текущими параметрами Argon2id.
+// Ошибки только логируются: вход от них не зависит
+func (cfg *ApiConfig) rehashPassword(ctx context.Context, dbUser database.User, password string) {
+	newHash, err := auth.HashPassword(password)
+	if err != nil {
+		log.Printf("❌ Ошибка перехеширования пароля пользователя %s: %v", dbUser.ID, err)
+		return
+	}
+
+	rows, err := cfg.Db.RehashUserPassword(ctx, database.RehashUserPasswordParams{
+		NewHash: newHash,
+		ID:      dbUser.ID,
+		OldHash: dbUser.HashedPassword,
+	})
+	if err != nil {
+		log.Printf("❌ Ошибка сохранения нового хеша пароля пользователя %s: %v", dbUser.ID, err)
+		return
+	}
+	if rows == 1 {
+		log.Printf("🔐 Пароль пользователя %s перехеширован с новыми параметрами Argon2id", dbUser.ID)
+	}
 }
@@ -3,6 +3,7 @@ package helpers
 import (
 	"encoding/json"
 	"log"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -86,3 +87,43 @@ func RespondWithError(w http.ResponseWriter, code int, msg string) {
 		Error: msg,
 	})
 }
+
+// FieldError - ошибка валидации конкретного поля запроса
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// RespondWithValidationErrors отвечает 400 со списком ошибок по полям
+func RespondWithValidationErrors(w http.ResponseWriter, fields []FieldError) {
+	type errorResponse struct {
+		Error  string       `json:"error"`
+		Fields []FieldError `json:"fields"`
+	}
+
+	RespondWithJSON(w, http.StatusBadRequest, errorResponse{
+		Error:  fields[0].Message,
+		Fields: fields,
+	})
+}
+
+// ClientIP возвращает IP клиента. X-Forwarded-For учитывается только при
+// trustProxy: иначе клиент может подставить любой адрес. Берется последний
+// адрес цепочки - его добавил наш reverse proxy
+func ClientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			parts := strings.Split(forwarded, ",")
+			if ip := strings.TrimSpace(parts[len(parts)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,68 @@
+package helpers
+
+import (
+	"errors"
+	"html"
+	"strings"
+	"unicode"
+)
+
+// Маркеры подсветки, которые возвращает ts_headline в запросе SearchChirps
+const (
+	highlightStart = "\x01"
+	highlightStop  = "\x02"
+)
+
+// BuildSearchQuery преобразует пользовательский запрос в синтаксис to_tsquery:
+//   - слова объединяются через & (все должны встречаться)
+//   - "фраза в кавычках" ищется как последовательность слов (<->)
+//   - слово* ищется по префиксу (:*)
+//
+// Все символы, кроме букв и цифр, отбрасываются, поэтому результат
+// безопасно передавать в to_tsquery без риска синтаксической ошибки
+func BuildSearchQuery(q string) (string, error) {
+	terms := make([]string, 0)
+
+	// Нечетные сегменты после разбиения по кавычкам находятся внутри фраз
+	for i, segment := range strings.Split(q, `"`) {
+		if i%2 == 1 {
+			if phrase := strings.Join(searchWords(segment), " <-> "); phrase != "" {
+				terms = append(terms, "("+phrase+")")
+			}
+			continue
+		}
+
+		for _, field := range strings.Fields(segment) {
+			words := searchWords(field)
+			if len(words) == 0 {
+				continue
+			}
+			// Префиксный поиск применяется к последнему слову: "chirp*" -> "chirp:*"
+			if strings.HasSuffix(field, "*") {
+				words[len(words)-1] += ":*"
+			}
+			terms = append(terms, words...)
+		}
+	}
+
+	if len(terms) == 0 {
+		return "", errors.New("поисковый запрос не содержит слов")
+	}
+
+	return strings.Join(terms, " & "), nil
+}
+
+// searchWords разбивает строку на слова из букв и цифр в нижнем регистре
+func searchWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// HighlightSnippet экранирует HTML во фрагменте ts_headline и заменяет
+// маркеры подсветки на <mark>...</mark>
+func HighlightSnippet(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, highlightStart, "<mark>")
+	return strings.ReplaceAll(escaped, highlightStop, "</mark>")
+}
@@ -0,0 +1,64 @@
+package helpers
+
+import "testing"
+
+func TestBuildSearchQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"words", "Hello World", "hello & world"},
+		{"prefix", "chirp*", "chirp:*"},
+		{"prefix on last word", "foo-bar*", "foo & bar:*"},
+		{"phrase", `"hello world" again`, "(hello <-> world) & again"},
+		{"unclosed quote", `say "hello world`, "say & (hello <-> world)"},
+		{"empty phrase", `"" hello`, "hello"},
+		{"tsquery operators", "a & b | !c <-> (d) e:*", "a & b & c & d & e:*"},
+		{"punctuation", "don't, stop.", "don & t & stop"},
+		{"injection", `x') | (y`, "x & y"},
+		{"unicode", "Привет мир 2024", "привет & мир & 2024"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := BuildSearchQuery(tt.query)
+			if err != nil {
+				t.Fatalf("BuildSearchQuery(%q) failed: %v", tt.query, err)
+			}
+			if got != tt.want {
+				t.Errorf("BuildSearchQuery(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildSearchQuery_NoWords(t *testing.T) {
+	// После нормализации от запроса ничего не остается
+	for _, query := range []string{"", "   ", `""`, "&|!*", `"!!!" ()`, "<->"} {
+		if got, err := BuildSearchQuery(query); err == nil {
+			t.Errorf("BuildSearchQuery(%q) = %q, want error", query, got)
+		}
+	}
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	tests := []struct {
+		name    string
+		snippet string
+		want    string
+	}{
+		{"plain", "hello world", "hello world"},
+		{"marker", "say \x01hello\x02 world", "say <mark>hello</mark> world"},
+		{"html in body", `<script>alert("x")</script>`, "&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;"},
+		{"markers around escaped entity", "\x01<b>\x02 & \x01\"q\"\x02", "<mark>&lt;b&gt;</mark> &amp; <mark>&#34;q&#34;</mark>"},
+		{"marker next to ampersand", "a&\x01amp\x02;", "a&amp;<mark>amp</mark>;"},
+		{"unbalanced marker", "\x01tail", "<mark>tail"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HighlightSnippet(tt.snippet); got != tt.want {
+				t.Errorf("HighlightSnippet(%q) = %q, want %q", tt.snippet, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileMailer сохраняет письма в каталог в виде .eml файлов (для локальной разработки)
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFileMailer создает FileMailer, каталог создается при необходимости
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("ошибка создания каталога писем: %w", err)
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+// Send записывает письмо в файл <время>-<получатель>.eml
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	now := time.Now()
+	data, err := msg.build(m.from, now)
+	if err != nil {
+		return err
+	}
+
+	// Имя файла не должно зависеть от разделителей пути в адресе
+	recipient := strings.NewReplacer("/", "_", "\\", "_").Replace(msg.To)
+	path := filepath.Join(m.dir, fmt.Sprintf("%s-%s.eml", now.Format("20060102-150405.000000000"), recipient))
+
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("ошибка записи письма: %w", err)
+	}
+
+	log.Printf("📧 Письмо для %s сохранено в %s", msg.To, path)
+	return nil
+}
+
+// MemoryMailer хранит отправленные письма в памяти (для тестов)
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewMemoryMailer создает пустой MemoryMailer
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+// Send сохраняет письмо
+func (m *MemoryMailer) Send(ctx context.Context, msg Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages возвращает копию отправленных писем
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
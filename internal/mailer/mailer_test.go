@@ -0,0 +1,90 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessage_Build(t *testing.T) {
+	msg := Message{
+		To:      "user@example.com",
+		Subject: "Сброс пароля",
+		Body:    "Ссылка: http://localhost:8080/app/reset?token=abc\n",
+	}
+
+	data, err := msg.build("noreply@chirpy.local", time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+
+	text := string(data)
+	for _, want := range []string{
+		"From: noreply@chirpy.local\r\n",
+		"To: user@example.com\r\n",
+		"Subject: =?utf-8?q?",
+		"Date: Thu, 02 Jan 2025 03:04:05 +0000\r\n",
+		"Content-Transfer-Encoding: quoted-printable\r\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("message is missing %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestMessage_HeaderInjection(t *testing.T) {
+	tests := []Message{
+		{To: "user@example.com\r\nBcc: victim@example.com", Subject: "Hi"},
+		{To: "user@example.com", Subject: "Hi\nBcc: victim@example.com"},
+		{To: "", Subject: "Hi"},
+	}
+
+	for _, msg := range tests {
+		if _, err := msg.build("noreply@chirpy.local", time.Now()); err == nil {
+			t.Errorf("build should reject message %+v", msg)
+		}
+	}
+}
+
+func TestMemoryMailer(t *testing.T) {
+	m := NewMemoryMailer()
+
+	err := m.Send(context.Background(), Message{To: "user@example.com", Subject: "Hi", Body: "Hello"})
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	messages := m.Messages()
+	if len(messages) != 1 || messages[0].Body != "Hello" {
+		t.Errorf("Messages returned %+v, want one message", messages)
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewFileMailer(filepath.Join(dir, "mail"), "noreply@chirpy.local")
+	if err != nil {
+		t.Fatalf("NewFileMailer failed: %v", err)
+	}
+
+	err = m.Send(context.Background(), Message{To: "user@example.com", Subject: "Hi", Body: "Hello"})
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "mail", "*-user@example.com.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected one .eml file, got %v (err %v)", files, err)
+	}
+
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if !strings.Contains(string(data), "Hello") {
+		t.Errorf("file does not contain message body:\n%s", data)
+	}
+}
@@ -0,0 +1,313 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IdrisovMarat/httpserver/internal/auth"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// jwksRefreshInterval - не чаще этого JWKS перезапрашивается из-за
+	// неизвестного kid (защита провайдера от потока токенов с мусорным kid)
+	jwksRefreshInterval = time.Minute
+	// maxResponseSize - максимальный размер ответа провайдера
+	maxResponseSize = 1 << 20
+)
+
+// Config - настройки OIDC провайдера
+type Config struct {
+	// Name - имя провайдера в URL (/api/auth/{provider}/...)
+	Name string
+	// IssuerURL - issuer провайдера; метаданные берутся из
+	// IssuerURL/.well-known/openid-configuration
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL - адрес callback, зарегистрированный у провайдера
+	RedirectURL string
+	// Scopes - запрашиваемые scopes (по умолчанию openid email profile)
+	Scopes []string
+}
+
+// metadata - нужные поля OpenID Provider Metadata
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Client - OIDC провайдер, настроенный по discovery документу
+type Client struct {
+	cfg        Config
+	httpClient *http.Client
+	meta       metadata
+
+	mu            sync.Mutex
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+	minRefresh    time.Duration
+}
+
+// Discover загружает метаданные провайдера и ключи проверки ID token
+func Discover(ctx context.Context, cfg Config, httpClient *http.Client) (*Client, error) {
+	if cfg.Name == "" || cfg.IssuerURL == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, fmt.Errorf("для OIDC провайдера нужны name, issuer, client_id и redirect_url")
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	c := &Client{cfg: cfg, httpClient: httpClient, minRefresh: jwksRefreshInterval}
+
+	discoveryURL := strings.TrimSuffix(cfg.IssuerURL, "/") + "/.well-known/openid-configuration"
+	if err := c.getJSON(ctx, discoveryURL, &c.meta); err != nil {
+		return nil, fmt.Errorf("ошибка загрузки метаданных провайдера %s: %w", cfg.Name, err)
+	}
+
+	// Production: issuer в метаданных обязан совпадать с настроенным (OIDC Discovery 4.3)
+	if c.meta.Issuer != cfg.IssuerURL {
+		return nil, fmt.Errorf("issuer провайдера %s не совпадает: %q, ожидался %q", cfg.Name, c.meta.Issuer, cfg.IssuerURL)
+	}
+	if c.meta.AuthorizationEndpoint == "" || c.meta.TokenEndpoint == "" || c.meta.JWKSURI == "" {
+		return nil, fmt.Errorf("неполные метаданные провайдера %s", cfg.Name)
+	}
+
+	if err := c.refreshKeys(ctx); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Name возвращает имя провайдера
+func (c *Client) Name() string {
+	return c.cfg.Name
+}
+
+// AuthCodeURL возвращает адрес страницы входа провайдера с state, nonce и PKCE
+func (c *Client) AuthCodeURL(state, nonce, codeChallenge string) string {
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.cfg.ClientID},
+		"redirect_uri":          {c.cfg.RedirectURL},
+		"scope":                 {strings.Join(c.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(c.meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return c.meta.AuthorizationEndpoint + sep + params.Encode()
+}
+
+// Exchange обменивает код авторизации на токены и проверяет ID token
+func (c *Client) Exchange(ctx context.Context, code, codeVerifier, nonce string) (Identity, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.cfg.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Identity{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	// client_secret_basic: id и секрет кодируются как form-urlencoded (RFC 6749, 2.3.1)
+	req.SetBasicAuth(url.QueryEscape(c.cfg.ClientID), url.QueryEscape(c.cfg.ClientSecret))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return Identity{}, fmt.Errorf("ошибка запроса токена у провайдера %s: %w", c.cfg.Name, err)
+	}
+	defer resp.Body.Close()
+
+	var tokenResp struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&tokenResp); err != nil {
+		return Identity{}, fmt.Errorf("неверный ответ token endpoint провайдера %s (HTTP %d): %w", c.cfg.Name, resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Identity{}, fmt.Errorf("провайдер %s отклонил код: %s %s", c.cfg.Name, tokenResp.Error, tokenResp.ErrorDescription)
+	}
+	if tokenResp.IDToken == "" {
+		return Identity{}, fmt.Errorf("провайдер %s не вернул id_token", c.cfg.Name)
+	}
+
+	return c.verifyIDToken(ctx, tokenResp.IDToken, nonce)
+}
+
+// idTokenClaims - claims ID token (OIDC Core 2, 5.1)
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce           string       `json:"nonce"`
+	AuthorizedParty string       `json:"azp"`
+	Email           string       `json:"email"`
+	EmailVerified   flexibleBool `json:"email_verified"`
+	Name            string       `json:"name"`
+}
+
+// verifyIDToken проверяет подпись и claims ID token (OIDC Core 3.1.3.7)
+func (c *Client) verifyIDToken(ctx context.Context, idToken, nonce string) (Identity, error) {
+	claims := &idTokenClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims,
+		func(token *jwt.Token) (interface{}, error) { return c.key(ctx, token) },
+		jwt.WithValidMethods([]string{auth.AlgRS256, auth.AlgEdDSA}),
+		jwt.WithIssuer(c.meta.Issuer),
+		jwt.WithAudience(c.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return Identity{}, fmt.Errorf("неверный id_token провайдера %s: %w", c.cfg.Name, err)
+	}
+
+	// 🛡️ nonce связывает ID token с нашим запросом входа (защита от replay)
+	if nonce == "" || claims.Nonce != nonce {
+		return Identity{}, fmt.Errorf("неверный nonce в id_token провайдера %s", c.cfg.Name)
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != c.cfg.ClientID {
+		return Identity{}, fmt.Errorf("id_token провайдера %s выдан для другого клиента (azp %q)", c.cfg.Name, claims.AuthorizedParty)
+	}
+	if claims.Subject == "" {
+		return Identity{}, fmt.Errorf("id_token провайдера %s без sub", c.cfg.Name)
+	}
+
+	return Identity{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          claims.Name,
+	}, nil
+}
+
+// key возвращает ключ проверки по kid. Неизвестный kid означает ротацию
+// ключей провайдера: JWKS перезапрашивается (не чаще minRefresh)
+func (c *Client) key(ctx context.Context, token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	c.mu.Lock()
+	key, ok := c.lookupKey(kid)
+	canRefresh := time.Since(c.keysFetchedAt) >= c.minRefresh
+	c.mu.Unlock()
+
+	if ok {
+		return key, nil
+	}
+	if !canRefresh {
+		return nil, fmt.Errorf("неизвестный ключ подписи: %q", kid)
+	}
+
+	if err := c.refreshKeys(ctx); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if key, ok := c.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("неизвестный ключ подписи: %q", kid)
+}
+
+// lookupKey ищет ключ по kid; токен без kid подходит, только если ключ один.
+// Вызывается под c.mu
+func (c *Client) lookupKey(kid string) (interface{}, bool) {
+	if kid == "" && len(c.keys) == 1 {
+		for _, key := range c.keys {
+			return key, true
+		}
+	}
+	key, ok := c.keys[kid]
+	return key, ok
+}
+
+// refreshKeys загружает JWKS провайдера. Ключи неподдерживаемых типов пропускаются
+func (c *Client) refreshKeys(ctx context.Context) error {
+	var jwks auth.JWKS
+	if err := c.getJSON(ctx, c.meta.JWKSURI, &jwks); err != nil {
+		return fmt.Errorf("ошибка загрузки JWKS провайдера %s: %w", c.cfg.Name, err)
+	}
+
+	keys := make(map[string]interface{}, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	c.mu.Lock()
+	c.keys = keys
+	c.keysFetchedAt = time.Now()
+	c.mu.Unlock()
+
+	return nil
+}
+
+// getJSON выполняет GET запрос и декодирует JSON ответ
+func (c *Client) getJSON(ctx context.Context, endpoint string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d от %s", resp.StatusCode, endpoint)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+}
+
+// flexibleBool принимает и true, и "true": некоторые провайдеры передают
+// email_verified строкой
+type flexibleBool bool
+
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case bool:
+		*b = flexibleBool(v)
+	case string:
+		*b = flexibleBool(v == "true")
+	default:
+		*b = false
+	}
+	return nil
+}
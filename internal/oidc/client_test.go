@@ -0,0 +1,274 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IdrisovMarat/httpserver/internal/auth"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID     = "chirpy-test"
+	testClientSecret = "s3cret/+="
+	testRedirectURL  = "http://localhost:8080/api/auth/fake/callback"
+)
+
+// fakeProvider - локальный OIDC провайдер на httptest для тестов
+type fakeProvider struct {
+	server *httptest.Server
+
+	mu    sync.Mutex
+	key   *rsa.PrivateKey
+	kid   string
+	codes map[string]authRequest
+	// audience - aud выдаваемых ID token (по умолчанию testClientID)
+	audience string
+}
+
+// authRequest - параметры, с которыми пользователь "вошел" у провайдера
+type authRequest struct {
+	challenge string
+	nonce     string
+	subject   string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+	p := &fakeProvider{codes: make(map[string]authRequest), audience: testClientID}
+	p.rotateKey(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.server.URL,
+			"authorization_endpoint": p.server.URL + "/authorize",
+			"token_endpoint":         p.server.URL + "/token",
+			"jwks_uri":               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		json.NewEncoder(w).Encode(auth.JWKS{Keys: []auth.JWK{{
+			Kty: "RSA",
+			Kid: p.kid,
+			Use: "sig",
+			Alg: auth.AlgRS256,
+			N:   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", p.handleToken)
+
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *fakeProvider) rotateKey(t *testing.T) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey failed: %v", err)
+	}
+	p.mu.Lock()
+	p.key = key
+	p.kid = rand.Text()
+	p.mu.Unlock()
+}
+
+// authorize имитирует вход пользователя на странице провайдера
+func (p *fakeProvider) authorize(t *testing.T, authURL, subject string) (code, state string) {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("invalid auth URL: %v", err)
+	}
+	q := u.Query()
+	if q.Get("client_id") != testClientID || q.Get("redirect_uri") != testRedirectURL ||
+		q.Get("code_challenge_method") != "S256" || !strings.Contains(q.Get("scope"), "openid") {
+		t.Fatalf("unexpected auth request: %s", u.RawQuery)
+	}
+
+	code = rand.Text()
+	p.mu.Lock()
+	p.codes[code] = authRequest{challenge: q.Get("code_challenge"), nonce: q.Get("nonce"), subject: subject}
+	p.mu.Unlock()
+	return code, q.Get("state")
+}
+
+func (p *fakeProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	tokenError := func(code string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": code})
+	}
+
+	id, secret, _ := r.BasicAuth()
+	id, _ = url.QueryUnescape(id)
+	secret, _ = url.QueryUnescape(secret)
+	if id != testClientID || secret != testClientSecret {
+		tokenError("invalid_client")
+		return
+	}
+
+	p.mu.Lock()
+	req, ok := p.codes[r.FormValue("code")]
+	delete(p.codes, r.FormValue("code"))
+	key, kid, audience := p.key, p.kid, p.audience
+	p.mu.Unlock()
+
+	if !ok || r.FormValue("grant_type") != "authorization_code" || r.FormValue("redirect_uri") != testRedirectURL {
+		tokenError("invalid_grant")
+		return
+	}
+	if CodeChallengeS256(r.FormValue("code_verifier")) != req.challenge {
+		tokenError("invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            p.server.URL,
+		"sub":            req.subject,
+		"aud":            audience,
+		"exp":            now.Add(time.Hour).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          req.nonce,
+		"email":          req.subject + "@example.com",
+		"email_verified": "true",
+	})
+	token.Header["kid"] = kid
+	idToken, _ := token.SignedString(key)
+
+	json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "token_type": "Bearer", "id_token": idToken})
+}
+
+func discover(t *testing.T, p *fakeProvider) *Client {
+	t.Helper()
+	c, err := Discover(context.Background(), Config{
+		Name:         "fake",
+		IssuerURL:    p.server.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+	}, p.server.Client())
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	return c
+}
+
+// login проходит полный flow и возвращает результат Exchange
+func login(t *testing.T, p *fakeProvider, c *Client, nonceOverride string) (Identity, error) {
+	t.Helper()
+	verifier, err := NewCodeVerifier()
+	if err != nil {
+		t.Fatalf("NewCodeVerifier failed: %v", err)
+	}
+
+	code, state := p.authorize(t, c.AuthCodeURL("state-1", "nonce-1", CodeChallengeS256(verifier)), "alice")
+	if state != "state-1" {
+		t.Fatalf("state = %q, want state-1", state)
+	}
+
+	nonce := "nonce-1"
+	if nonceOverride != "" {
+		nonce = nonceOverride
+	}
+	return c.Exchange(context.Background(), code, verifier, nonce)
+}
+
+func TestClient_Login(t *testing.T) {
+	p := newFakeProvider(t)
+	c := discover(t, p)
+
+	identity, err := login(t, p, c, "")
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+
+	want := Identity{Subject: "alice", Email: "alice@example.com", EmailVerified: true}
+	if identity != want {
+		t.Errorf("identity = %+v, want %+v", identity, want)
+	}
+}
+
+func TestClient_Exchange_WrongVerifier(t *testing.T) {
+	p := newFakeProvider(t)
+	c := discover(t, p)
+
+	verifier, _ := NewCodeVerifier()
+	code, _ := p.authorize(t, c.AuthCodeURL("s", "n", CodeChallengeS256(verifier)), "alice")
+
+	otherVerifier, _ := NewCodeVerifier()
+	if _, err := c.Exchange(context.Background(), code, otherVerifier, "n"); err == nil {
+		t.Error("Exchange should fail with wrong code_verifier")
+	}
+}
+
+func TestClient_Exchange_WrongNonce(t *testing.T) {
+	p := newFakeProvider(t)
+	c := discover(t, p)
+
+	if _, err := login(t, p, c, "other-nonce"); err == nil {
+		t.Error("Exchange should reject id_token with another nonce")
+	}
+}
+
+func TestClient_Exchange_WrongAudience(t *testing.T) {
+	p := newFakeProvider(t)
+	c := discover(t, p)
+	p.mu.Lock()
+	p.audience = "another-client"
+	p.mu.Unlock()
+
+	if _, err := login(t, p, c, ""); err == nil {
+		t.Error("Exchange should reject id_token issued for another client")
+	}
+}
+
+func TestClient_KeyRotation(t *testing.T) {
+	p := newFakeProvider(t)
+	c := discover(t, p)
+	c.minRefresh = 0
+
+	// Провайдер сменил ключ: клиент перезапрашивает JWKS по неизвестному kid
+	p.rotateKey(t)
+	if _, err := login(t, p, c, ""); err != nil {
+		t.Fatalf("Exchange failed after key rotation: %v", err)
+	}
+
+	// Без перезапроса JWKS новый ключ неизвестен
+	c.minRefresh = time.Hour
+	p.rotateKey(t)
+	if _, err := login(t, p, c, ""); err == nil {
+		t.Error("Exchange should fail while JWKS refresh is rate limited")
+	}
+}
+
+func TestDiscover_IssuerMismatch(t *testing.T) {
+	p := newFakeProvider(t)
+
+	// Метаданные те же, но issuer в них без завершающего "/"
+	_, err := Discover(context.Background(), Config{
+		Name:        "fake",
+		IssuerURL:   p.server.URL + "/",
+		ClientID:    testClientID,
+		RedirectURL: testRedirectURL,
+	}, p.server.Client())
+	if err == nil {
+		t.Error("Discover should fail when issuer does not match")
+	}
+}
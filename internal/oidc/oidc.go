@@ -0,0 +1,46 @@
+// Package oidc реализует вход через внешних OpenID Connect провайдеров:
+// authorization code flow с PKCE и проверкой ID token
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+)
+
+// Identity - пользователь внешнего провайдера из проверенного ID token
+type Identity struct {
+	// Subject - постоянный идентификатор пользователя у провайдера (claim sub)
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Provider - внешний провайдер входа
+type Provider interface {
+	// Name - имя провайдера в URL (/api/auth/{provider}/...)
+	Name() string
+	// AuthCodeURL возвращает адрес страницы входа провайдера
+	AuthCodeURL(state, nonce, codeChallenge string) string
+	// Exchange обменивает код авторизации на ID token, проверяет его
+	// (подпись, issuer, audience, срок, nonce) и возвращает пользователя
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (Identity, error)
+}
+
+// NewCodeVerifier создает PKCE code_verifier (RFC 7636): 43 символа base64url
+func NewCodeVerifier() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("ошибка генерации code_verifier: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallengeS256 вычисляет code_challenge для метода S256
+func CodeChallengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,122 @@
+package pagination
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultLimit - размер страницы, если параметр limit не указан
+	DefaultLimit = 20
+	// MaxLimit - максимальный размер страницы, который может запросить клиент
+	MaxLimit = 100
+
+	// payload курсора: 8 байт created_at (unix nano) + 16 байт UUID
+	payloadSize = 8 + 16
+	// Production: усекаем HMAC до 128 бит, этого достаточно для подписи курсора
+	macSize = 16
+)
+
+// Cursor - позиция в keyset-пагинации (created_at + id). Kind - список, для
+// которого выдан курсор: он входит в подпись, поэтому курсор одного списка
+// (например, подписок) не принимается другим (например, лентой)
+type Cursor struct {
+	Kind      string
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// Encode кодирует курсор в непрозрачную строку, подписанную HMAC-SHA256
+func Encode(c Cursor, secret string) string {
+	payload := make([]byte, payloadSize, payloadSize+macSize)
+	binary.BigEndian.PutUint64(payload[:8], uint64(c.CreatedAt.UnixNano()))
+	copy(payload[8:], c.ID[:])
+
+	return base64.RawURLEncoding.EncodeToString(append(payload, sign(c.Kind, payload, secret)...))
+}
+
+// Decode проверяет подпись и декодирует курсор списка kind, полученный от
+// клиента. Курсор другого списка не проходит проверку подписи
+func Decode(token, kind, secret string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("ошибка декодирования курсора: %w", err)
+	}
+
+	if len(raw) != payloadSize+macSize {
+		return Cursor{}, fmt.Errorf("неверная длина курсора")
+	}
+
+	payload, mac := raw[:payloadSize], raw[payloadSize:]
+	// Production: сравнение за постоянное время
+	if !hmac.Equal(mac, sign(kind, payload, secret)) {
+		return Cursor{}, fmt.Errorf("неверная подпись курсора или курсор другого списка")
+	}
+
+	id, err := uuid.FromBytes(payload[8:])
+	if err != nil {
+		return Cursor{}, fmt.Errorf("неверный ID в курсоре: %w", err)
+	}
+
+	return Cursor{
+		Kind:      kind,
+		CreatedAt: time.Unix(0, int64(binary.BigEndian.Uint64(payload[:8]))).UTC(),
+		ID:        id,
+	}, nil
+}
+
+// sign подписывает payload вместе с kind. Нулевой байт отделяет kind от
+// payload, поэтому разные пары (kind, payload) не дают одинаковых данных
+func sign(kind string, payload []byte, secret string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(kind))
+	mac.Write([]byte{0})
+	mac.Write(payload)
+	return mac.Sum(nil)[:macSize]
+}
+
+// ParseLimit разбирает параметр limit (пустая строка - DefaultLimit)
+func ParseLimit(raw string) (int, error) {
+	if raw == "" {
+		return DefaultLimit, nil
+	}
+
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit < 1 || limit > MaxLimit {
+		return 0, fmt.Errorf("limit должен быть числом от 1 до %d", MaxLimit)
+	}
+
+	return limit, nil
+}
+
+// PageURL строит ссылку на соседнюю страницу, заменяя after/before в текущем URL
+func PageURL(u *url.URL, param, cursor string) string {
+	query := u.Query()
+	query.Del("after")
+	query.Del("before")
+	query.Set(param, cursor)
+
+	return u.Path + "?" + query.Encode()
+}
+
+// LinkHeader формирует значение заголовка Link (RFC 8288) для ссылок next/prev
+func LinkHeader(next, prev string) string {
+	links := make([]string, 0, 2)
+	if next != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, next))
+	}
+	if prev != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, prev))
+	}
+
+	return strings.Join(links, ", ")
+}
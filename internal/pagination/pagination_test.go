@@ -0,0 +1,129 @@
+package pagination
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	secret := "test-secret"
+	cursor := Cursor{
+		Kind:      "chirps",
+		CreatedAt: time.Date(2024, 5, 1, 12, 30, 0, 123456000, time.UTC),
+		ID:        uuid.New(),
+	}
+
+	token := Encode(cursor, secret)
+
+	decoded, err := Decode(token, "chirps", secret)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	if !decoded.CreatedAt.Equal(cursor.CreatedAt) {
+		t.Errorf("Decode returned wrong created_at: got %v, want %v", decoded.CreatedAt, cursor.CreatedAt)
+	}
+
+	if decoded.ID != cursor.ID {
+		t.Errorf("Decode returned wrong ID: got %v, want %v", decoded.ID, cursor.ID)
+	}
+}
+
+func TestDecode_WrongSecret(t *testing.T) {
+	token := Encode(Cursor{Kind: "chirps", CreatedAt: time.Now(), ID: uuid.New()}, "test-secret")
+
+	_, err := Decode(token, "chirps", "wrong-secret")
+	if err == nil {
+		t.Error("Decode should fail for cursor signed with wrong secret")
+	}
+}
+
+func TestDecode_WrongKind(t *testing.T) {
+	token := Encode(Cursor{Kind: "following", CreatedAt: time.Now(), ID: uuid.New()}, "test-secret")
+
+	_, err := Decode(token, "timeline", "test-secret")
+	if err == nil {
+		t.Error("Decode should fail for cursor of another list")
+	}
+}
+
+func TestDecode_Tampered(t *testing.T) {
+	token := Encode(Cursor{Kind: "chirps", CreatedAt: time.Now(), ID: uuid.New()}, "test-secret")
+
+	// Меняем первый символ payload
+	tampered := []byte(token)
+	if tampered[0] == 'A' {
+		tampered[0] = 'B'
+	} else {
+		tampered[0] = 'A'
+	}
+
+	_, err := Decode(string(tampered), "chirps", "test-secret")
+	if err == nil {
+		t.Error("Decode should fail for tampered cursor")
+	}
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	_, err := Decode("not-a-cursor", "chirps", "test-secret")
+	if err == nil {
+		t.Error("Decode should fail for invalid cursor string")
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    int
+		wantErr bool
+	}{
+		{raw: "", want: DefaultLimit},
+		{raw: "1", want: 1},
+		{raw: "100", want: MaxLimit},
+		{raw: "0", wantErr: true},
+		{raw: "101", wantErr: true},
+		{raw: "abc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.raw)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseLimit(%q) should fail", tt.raw)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseLimit(%q) failed: %v", tt.raw, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLimit(%q) = %d, want %d", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestPageURL(t *testing.T) {
+	u, _ := url.Parse("/api/chirps?author_id=abc&after=old&limit=10")
+
+	got := PageURL(u, "before", "cur")
+	want := "/api/chirps?author_id=abc&before=cur&limit=10"
+	if got != want {
+		t.Errorf("PageURL returned %s, want %s", got, want)
+	}
+}
+
+func TestLinkHeader(t *testing.T) {
+	got := LinkHeader("/next", "/prev")
+	want := `</next>; rel="next", </prev>; rel="prev"`
+	if got != want {
+		t.Errorf("LinkHeader returned %s, want %s", got, want)
+	}
+
+	if LinkHeader("", "") != "" {
+		t.Error("LinkHeader should return empty string without links")
+	}
+}
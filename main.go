@@ -7,11 +7,16 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/IdrisovMarat/httpserver/internal/auth"
 	"github.com/IdrisovMarat/httpserver/internal/database"
 	"github.com/IdrisovMarat/httpserver/internal/handlers"
 	"github.com/IdrisovMarat/httpserver/internal/helpers"
+	"github.com/IdrisovMarat/httpserver/internal/mailer"
+	"github.com/IdrisovMarat/httpserver/internal/oidc"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
@@ -22,7 +27,7 @@ func enableCORS(next http.Handler) http.Handler {
 		// Разрешаем запросы с любого origin для разработки
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, X-Sudo-Token, X-Auth-Mode, X-CSRF-Token")
 
 		// Обрабатываем preflight OPTIONS запросы
 		if r.Method == "OPTIONS" {
@@ -34,6 +39,185 @@ func enableCORS(next http.Handler) http.Handler {
 	})
 }
 
+// newKeySet создает набор ключей подписи JWT для алгоритма alg.
+// Для RS256/EdDSA ключ читается из keyFile (без ротации) или берется из
+// общего хранилища store, где при interval > 0 ключи плавно ротируются
+func newKeySet(ctx context.Context, alg, jwtSecret, keyFile string, store auth.KeyStore, interval time.Duration) (*auth.KeySet, error) {
+	switch alg {
+	case "", auth.AlgHS256:
+		return auth.NewHMACKeySet(jwtSecret, handlers.AccessTokenTTL), nil
+	case auth.AlgRS256, auth.AlgEdDSA:
+	default:
+		return nil, fmt.Errorf("неподдерживаемый JWT_SIGNING_ALG: %s", alg)
+	}
+
+	var keys *auth.KeySet
+	if keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения JWT_PRIVATE_KEY_FILE: %w", err)
+		}
+		key, err := auth.ParsePrivateKeyPEM(data)
+		if err != nil {
+			return nil, err
+		}
+		if key.Method.Alg() != alg {
+			return nil, fmt.Errorf("ключ из JWT_PRIVATE_KEY_FILE не соответствует алгоритму %s", alg)
+		}
+		if interval > 0 {
+			log.Printf("⚠️ JWT_KEY_ROTATION_INTERVAL игнорируется: ключ задан JWT_PRIVATE_KEY_FILE")
+		}
+		keys = auth.NewKeySet(key, handlers.AccessTokenTTL)
+	} else {
+		var err error
+		keys, err = auth.NewStoredKeySet(ctx, store, alg, handlers.AccessTokenTTL)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка загрузки ключей подписи из БД: %w", err)
+		}
+		// Синхронизация с БД нужна и без ротации: ключи других экземпляров
+		// и удаление истекших ключей
+		keys.StartRotation(context.Background(), store, alg, interval)
+	}
+
+	// Токены, выпущенные ранее с HS256, остаются валидными до истечения, но
+	// только выпущенные до сохраненного в БД момента перехода
+	cutover, err := store.LegacyCutover(ctx, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("ошибка загрузки момента перехода с HS256: %w", err)
+	}
+	keys.AcceptLegacyHMAC(jwtSecret, cutover)
+
+	return keys, nil
+}
+
+// configurePasswordHashing применяет параметры Argon2id из ARGON2_MEMORY (KiB),
+// ARGON2_ITERATIONS и ARGON2_PARALLELISM. Незаданные параметры остаются по умолчанию
+func configurePasswordHashing() error {
+	params := auth.PasswordParams()
+
+	for env, field := range map[string]*uint32{
+		"ARGON2_MEMORY":     &params.Memory,
+		"ARGON2_ITERATIONS": &params.Iterations,
+	} {
+		if value := os.Getenv(env); value != "" {
+			n, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return fmt.Errorf("неверный %s: %w", env, err)
+			}
+			*field = uint32(n)
+		}
+	}
+
+	if value := os.Getenv("ARGON2_PARALLELISM"); value != "" {
+		n, err := strconv.ParseUint(value, 10, 8)
+		if err != nil {
+			return fmt.Errorf("неверный ARGON2_PARALLELISM: %w", err)
+		}
+		params.Parallelism = uint8(n)
+	}
+
+	if err := auth.SetPasswordParams(params); err != nil {
+		return err
+	}
+
+	log.Printf("🔐 Параметры Argon2id: memory=%d KiB, iterations=%d, parallelism=%d",
+		params.Memory, params.Iterations, params.Parallelism)
+	return nil
+}
+
+// newPasswordPolicy создает политику паролей: длина из PASSWORD_MIN_LENGTH и
+// PASSWORD_MAX_LENGTH, корпус утекших паролей из BREACHED_PASSWORDS_FILE
+func newPasswordPolicy() (auth.PasswordPolicy, error) {
+	policy := auth.DefaultPasswordPolicy
+
+	for env, field := range map[string]*int{
+		"PASSWORD_MIN_LENGTH": &policy.MinLength,
+		"PASSWORD_MAX_LENGTH": &policy.MaxLength,
+	} {
+		if value := os.Getenv(env); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return auth.PasswordPolicy{}, fmt.Errorf("неверный %s: %q", env, value)
+			}
+			*field = n
+		}
+	}
+	if policy.MinLength > policy.MaxLength {
+		return auth.PasswordPolicy{}, fmt.Errorf("PASSWORD_MIN_LENGTH больше PASSWORD_MAX_LENGTH")
+	}
+
+	if path := os.Getenv("BREACHED_PASSWORDS_FILE"); path != "" {
+		corpus, err := auth.LoadBreachedPasswordsFile(path)
+		if err != nil {
+			return auth.PasswordPolicy{}, err
+		}
+		log.Printf("🛡️ Загружено %d утекших паролей из %s", corpus.Len(), path)
+		policy.Breached = corpus
+	}
+
+	return policy, nil
+}
+
+// newOIDCProviders настраивает провайдеров входа из OIDC_PROVIDERS (имена через
+// запятую). Для каждого имени NAME читаются OIDC_NAME_ISSUER, OIDC_NAME_CLIENT_ID,
+// OIDC_NAME_CLIENT_SECRET и необязательный OIDC_NAME_SCOPES (через пробел)
+func newOIDCProviders(publicURL string) (map[string]oidc.Provider, error) {
+	providers := make(map[string]oidc.Provider)
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		client, err := oidc.Discover(ctx, oidc.Config{
+			Name:         name,
+			IssuerURL:    os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  publicURL + "/api/auth/" + name + "/callback",
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}, nil)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+
+		providers[name] = client
+		log.Printf("🔑 Подключен OIDC провайдер %s", name)
+	}
+
+	return providers, nil
+}
+
+// newMailer создает отправителя писем по MAILER: smtp или file (по умолчанию,
+// письма сохраняются в MAIL_DIR для локальной разработки)
+func newMailer(kind, from string) (mailer.Mailer, error) {
+	switch kind {
+	case "smtp":
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			return nil, fmt.Errorf("SMTP_HOST не установлен")
+		}
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return mailer.NewSMTPMailer(host, port, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), from), nil
+	case "", "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		log.Printf("📧 Письма сохраняются в каталог %s (MAILER=file)", dir)
+		return mailer.NewFileMailer(dir, from)
+	default:
+		return nil, fmt.Errorf("неподдерживаемый MAILER: %s", kind)
+	}
+}
+
 func main() {
 
 	godotenv.Load()
@@ -41,6 +225,7 @@ func main() {
 	jwtSecret := os.Getenv("JWT_SECRET")
 	platform := os.Getenv("PLATFORM")
 	polkaKey := os.Getenv("POLKA_KEY")
+	jwtAlg := os.Getenv("JWT_SIGNING_ALG")
 
 	if platform == "" {
 		platform = "production" // default to production for safety
@@ -54,6 +239,78 @@ func main() {
 		log.Fatal("POLKA_KEY не установлен в .env файле")
 	}
 
+	// Курсоры пагинации подписываются отдельным ключом: утечка или подбор
+	// ключа курсоров не должны затрагивать подпись токенов
+	cursorSecret := os.Getenv("CURSOR_SECRET")
+	if cursorSecret == "" {
+		secret, err := auth.MakeOneTimeToken()
+		if err != nil {
+			log.Fatalf("❌ Ошибка создания ключа курсоров: %v", err)
+		}
+		cursorSecret = secret
+		log.Println("⚠️ CURSOR_SECRET не установлен: курсоры пагинации действуют только до перезапуска и только на этом экземпляре")
+	}
+
+	// Приватные ключи RS256/EdDSA в БД шифруются отдельным секретом: владелец
+	// JWT_SECRET не должен получать доступ к асимметричным ключам
+	keyFile := os.Getenv("JWT_PRIVATE_KEY_FILE")
+	keyEncryptionSecret := os.Getenv("JWT_KEY_ENCRYPTION_SECRET")
+	if (jwtAlg == auth.AlgRS256 || jwtAlg == auth.AlgEdDSA) && keyFile == "" {
+		if keyEncryptionSecret == "" {
+			log.Fatal("JWT_KEY_ENCRYPTION_SECRET не установлен в .env файле")
+		}
+		if keyEncryptionSecret == jwtSecret {
+			log.Fatal("JWT_KEY_ENCRYPTION_SECRET должен отличаться от JWT_SECRET")
+		}
+	}
+
+	// Production: плановая ротация асимметричных ключей (например, JWT_KEY_ROTATION_INTERVAL=24h)
+	var keyRotation time.Duration
+	if rotation := os.Getenv("JWT_KEY_ROTATION_INTERVAL"); rotation != "" {
+		interval, err := time.ParseDuration(rotation)
+		if err != nil || interval <= 0 {
+			log.Fatalf("❌ Неверный JWT_KEY_ROTATION_INTERVAL: %q", rotation)
+		}
+		keyRotation = interval
+	}
+
+	if err := configurePasswordHashing(); err != nil {
+		log.Fatalf("❌ Ошибка настройки хеширования паролей: %v", err)
+	}
+
+	passwordPolicy, err := newPasswordPolicy()
+	if err != nil {
+		log.Fatalf("❌ Ошибка настройки политики паролей: %v", err)
+	}
+
+	mailFrom := os.Getenv("MAIL_FROM")
+	if mailFrom == "" {
+		mailFrom = "noreply@chirpy.local"
+	}
+
+	mail, err := newMailer(os.Getenv("MAILER"), mailFrom)
+	if err != nil {
+		log.Fatalf("❌ Ошибка настройки отправки писем: %v", err)
+	}
+
+	publicURL := strings.TrimSuffix(os.Getenv("PUBLIC_URL"), "/")
+	if publicURL == "" {
+		publicURL = "http://localhost:" + helpers.ServerPort
+	}
+
+	chirpEditWindow := handlers.DefaultChirpEditWindow
+	if window := os.Getenv("CHIRP_EDIT_WINDOW"); window != "" {
+		chirpEditWindow, err = time.ParseDuration(window)
+		if err != nil || chirpEditWindow <= 0 {
+			log.Fatalf("❌ Неверный CHIRP_EDIT_WINDOW: %q", window)
+		}
+	}
+
+	oidcProviders, err := newOIDCProviders(publicURL)
+	if err != nil {
+		log.Fatalf("❌ Ошибка настройки OIDC провайдеров: %v", err)
+	}
+
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
 		log.Fatal("Something went wrong")
@@ -68,15 +325,38 @@ func main() {
 
 	dbQueries := database.New(db)
 
+	keyStore := handlers.NewSigningKeyStore(dbQueries, keyEncryptionSecret, jwtSecret)
+	keys, err := newKeySet(ctx, jwtAlg, jwtSecret, keyFile, keyStore, keyRotation)
+	if err != nil {
+		log.Fatalf("❌ Ошибка настройки ключей подписи JWT: %v", err)
+	}
+
 	mux := http.NewServeMux()
 	// Оберните ваш mux в CORS middleware
 	corsMux := enableCORS(mux)
 
 	config := &handlers.ApiConfig{
 		Db:        dbQueries,
+		DBConn:    db,
 		Platform:  platform,
-		JWTsecret: jwtSecret,
+		Keys:      keys,
 		PolkaKey:  polkaKey,
+		Mailer:    mail,
+		PublicURL: publicURL,
+		// Ключ подписи курсоров пагинации (CURSOR_SECRET)
+		CursorSecret: cursorSecret,
+		// Production: включайте только за reverse proxy, который перезаписывает X-Forwarded-For
+		TrustProxy: os.Getenv("TRUST_PROXY") == "true",
+		// Production: отзыв токенов на других экземплярах сервера применяется в течение 30 секунд
+		TokenStates: auth.NewTokenStateCache(30 * time.Second),
+		// Требования к новым паролям: длина, совпадение с email, утекшие пароли
+		PasswordPolicy: passwordPolicy,
+		// Вход через внешних провайдеров (OIDC_PROVIDERS)
+		OIDCProviders: oidcProviders,
+		// Вход без пароля по ссылке из письма (MAGIC_LINK_LOGIN=true)
+		MagicLinkLogin: os.Getenv("MAGIC_LINK_LOGIN") == "true",
+		// Срок редактирования chirp после публикации (CHIRP_EDIT_WINDOW, по умолчанию 1h)
+		ChirpEditWindow: chirpEditWindow,
 	}
 
 	chainMiddlwareLog := func(h http.Handler) http.Handler {
@@ -99,18 +379,71 @@ func main() {
 	mux.Handle("GET /api/healthz", chainMiddlwareLog(readyHandler))
 	mux.Handle("GET /app/", chainMiddlwareLog(config.MiddlewareMetricsInt(http.StripPrefix("/app", fileServer))))
 	mux.Handle("GET /assets/", chainMiddlwareLog(http.StripPrefix("/assets", assetsServer)))
+	mux.HandleFunc("GET /.well-known/jwks.json", chainMiddlwareLog(http.HandlerFunc(config.JWKSHandler)).ServeHTTP)
 	mux.HandleFunc("GET /admin/metrics", chainMiddlwareLog(http.HandlerFunc(config.MetricsHandler)).ServeHTTP)
 	mux.HandleFunc("POST /admin/reset", chainMiddlwareLog(http.HandlerFunc(config.ResetmetricsHandler)).ServeHTTP)
+	mux.HandleFunc("PUT /admin/users/{userID}/role", chainMiddlwareLog(config.RequireAuth(auth.ScopeAdmin)(http.HandlerFunc(config.SetUserRoleHandler))).ServeHTTP)
+	mux.HandleFunc("POST /admin/users/{userID}/ban", chainMiddlwareLog(config.RequireAuth(auth.ScopeAdmin)(http.HandlerFunc(config.BanUserHandler))).ServeHTTP)
+	mux.HandleFunc("DELETE /admin/users/{userID}/ban", chainMiddlwareLog(config.RequireAuth(auth.ScopeAdmin)(http.HandlerFunc(config.BanUserHandler))).ServeHTTP)
+	mux.HandleFunc("POST /admin/users/{userID}/unlock", chainMiddlwareLog(config.RequireAuth(auth.ScopeAdmin)(http.HandlerFunc(config.UnlockUserHandler))).ServeHTTP)
 	mux.HandleFunc("GET /api/debug/db", chainMiddlwareLog(http.HandlerFunc(config.DebugDBHandler)).ServeHTTP)
 
 	mux.HandleFunc("POST /api/users", chainMiddlwareLog(http.HandlerFunc(config.CreateUserHandler)).ServeHTTP)
 	mux.HandleFunc("POST /api/login", chainMiddlwareLog(http.HandlerFunc(config.LoginHandler)).ServeHTTP)
-	mux.HandleFunc("PUT /api/users", chainMiddlwareLog(http.HandlerFunc(config.UpdateUserHandler)).ServeHTTP)
-
-	mux.HandleFunc("POST /api/chirps", chainMiddlwareLog(http.HandlerFunc(config.CreateChirpHandler)).ServeHTTP)
-	mux.HandleFunc("GET /api/chirps", chainMiddlwareLog(http.HandlerFunc(config.GetChirpsHandler)).ServeHTTP)
-	mux.HandleFunc("GET /api/chirps/{chirpID}", chainMiddlwareLog(http.HandlerFunc(config.GetChirpByIdHandler)).ServeHTTP)
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", chainMiddlwareLog(http.HandlerFunc(config.DeleteChirpHandler)).ServeHTTP)
+	mux.HandleFunc("POST /api/login/mfa", chainMiddlwareLog(http.HandlerFunc(config.LoginMFAHandler)).ServeHTTP)
+	mux.HandleFunc("POST /api/login/magic", chainMiddlwareLog(http.HandlerFunc(config.RequestMagicLinkHandler)).ServeHTTP)
+	mux.HandleFunc("POST /api/login/magic/confirm", chainMiddlwareLog(http.HandlerFunc(config.ConfirmMagicLinkHandler)).ServeHTTP)
+	mux.HandleFunc("POST /api/users/verify", chainMiddlwareLog(http.HandlerFunc(config.VerifyEmailHandler)).ServeHTTP)
+	mux.HandleFunc("POST /api/users/verify/resend", chainMiddlwareLog(config.RequireAuth(auth.ScopeUsersWrite)(http.HandlerFunc(config.ResendVerificationHandler))).ServeHTTP)
+	mux.HandleFunc("POST /api/password-reset", chainMiddlwareLog(http.HandlerFunc(config.RequestPasswordResetHandler)).ServeHTTP)
+	mux.HandleFunc("POST /api/password-reset/confirm", chainMiddlwareLog(http.HandlerFunc(config.ConfirmPasswordResetHandler)).ServeHTTP)
+	mux.HandleFunc("PUT /api/users", chainMiddlwareLog(config.RequireAuth(auth.ScopeUsersWrite)(http.HandlerFunc(config.UpdateUserHandler))).ServeHTTP)
+	mux.HandleFunc("DELETE /api/users", chainMiddlwareLog(config.RequireAuth(auth.ScopeUsersWrite)(http.HandlerFunc(config.DeleteUserHandler))).ServeHTTP)
+	mux.HandleFunc("POST /api/reauth", chainMiddlwareLog(config.RequireAuth(auth.ScopeUsersWrite)(http.HandlerFunc(config.ReauthenticateHandler))).ServeHTTP)
+	mux.HandleFunc("POST /api/reauth/email", chainMiddlwareLog(config.RequireAuth(auth.ScopeUsersWrite)(http.HandlerFunc(config.RequestSudoEmailCodeHandler))).ServeHTTP)
+	mux.HandleFunc("GET /api/sessions", chainMiddlwareLog(config.RequireAuth()(http.HandlerFunc(config.ListSessionsHandler))).ServeHTTP)
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", chainMiddlwareLog(config.RequireAuth(auth.ScopeUsersWrite)(http.HandlerFunc(config.RevokeSessionHandler))).ServeHTTP)
+	mux.HandleFunc("POST /api/sessions/revoke-others", chainMiddlwareLog(config.RequireAuth(auth.ScopeUsersWrite)(http.HandlerFunc(config.RevokeOtherSessionsHandler))).ServeHTTP)
+	mux.HandleFunc("POST /api/sessions/revoke-all", chainMiddlwareLog(config.RequireAuth()(http.HandlerFunc(config.RevokeAllSessionsHandler))).ServeHTTP)
+	mux.HandleFunc("GET /api/auth/{provider}/login", chainMiddlwareLog(http.HandlerFunc(config.OIDCLoginHandler)).ServeHTTP)
+	mux.HandleFunc("GET /api/auth/{provider}/callback", chainMiddlwareLog(http.HandlerFunc(config.OIDCCallbackHandler)).ServeHTTP)
+	mux.HandleFunc("POST /api/auth/exchange", chainMiddlwareLog(http.HandlerFunc(config.OIDCExchangeHandler)).ServeHTTP)
+	mux.HandleFunc("POST /api/auth/{provider}/link", chainMiddlwareLog(config.RequireAuth(auth.ScopeUsersWrite)(http.HandlerFunc(config.OIDCLinkHandler))).ServeHTTP)
+	mux.HandleFunc("GET /api/identities", chainMiddlwareLog(config.RequireAuth()(http.HandlerFunc(config.ListIdentitiesHandler))).ServeHTTP)
+	mux.HandleFunc("DELETE /api/identities/{identityID}", chainMiddlwareLog(config.RequireAuth(auth.ScopeUsersWrite)(http.HandlerFunc(config.UnlinkIdentityHandler))).ServeHTTP)
+	mux.HandleFunc("POST /api/tokens", chainMiddlwareLog(config.RequireAuth(auth.ScopeUsersWrite)(http.HandlerFunc(config.CreatePersonalTokenHandler))).ServeHTTP)
+	mux.HandleFunc("GET /api/tokens", chainMiddlwareLog(config.RequireAuth()(http.HandlerFunc(config.ListPersonalTokensHandler))).ServeHTTP)
+	mux.HandleFunc("DELETE /api/tokens/{tokenID}", chainMiddlwareLog(config.RequireAuth(auth.ScopeUsersWrite)(http.HandlerFunc(config.RevokePersonalTokenHandler))).ServeHTTP)
+	mux.HandleFunc("POST /api/oauth/clients", chainMiddlwareLog(config.RequireAuth(auth.ScopeUsersWrite)(http.HandlerFunc(config.CreateOAuthClientHandler))).ServeHTTP)
+	mux.HandleFunc("GET /api/oauth/clients", chainMiddlwareLog(config.RequireAuth()(http.HandlerFunc(config.ListOAuthClientsHandler))).ServeHTTP)
+	mux.HandleFunc("DELETE /api/oauth/clients/{clientID}", chainMiddlwareLog(config.RequireAuth(auth.ScopeUsersWrite)(http.HandlerFunc(config.DeleteOAuthClientHandler))).ServeHTTP)
+	mux.HandleFunc("GET /oauth/authorize", chainMiddlwareLog(http.HandlerFunc(config.OAuthAuthorizeHandler)).ServeHTTP)
+	mux.HandleFunc("POST /oauth/authorize", chainMiddlwareLog(http.HandlerFunc(config.OAuthConsentHandler)).ServeHTTP)
+	mux.HandleFunc("POST /oauth/token", chainMiddlwareLog(http.HandlerFunc(config.OAuthTokenHandler)).ServeHTTP)
+	mux.HandleFunc("POST /oauth/revoke", chainMiddlwareLog(http.HandlerFunc(config.OAuthRevokeHandler)).ServeHTTP)
+	mux.HandleFunc("POST /oauth/introspect", chainMiddlwareLog(http.HandlerFunc(config.OAuthIntrospectHandler)).ServeHTTP)
+	mux.HandleFunc("POST /api/mfa/totp/enroll", chainMiddlwareLog(config.RequireAuth(auth.ScopeUsersWrite)(http.HandlerFunc(config.EnrollTOTPHandler))).ServeHTTP)
+	mux.HandleFunc("POST /api/mfa/totp/confirm", chainMiddlwareLog(config.RequireAuth(auth.ScopeUsersWrite)(http.HandlerFunc(config.ConfirmTOTPHandler))).ServeHTTP)
+	mux.HandleFunc("DELETE /api/mfa/totp", chainMiddlwareLog(config.RequireAuth(auth.ScopeUsersWrite)(http.HandlerFunc(config.DisableTOTPHandler))).ServeHTTP)
+
+	mux.HandleFunc("POST /api/chirps", chainMiddlwareLog(config.RequireAuth(auth.ScopeChirpsWrite)(http.HandlerFunc(config.CreateChirpHandler))).ServeHTTP)
+	mux.HandleFunc("GET /api/chirps", chainMiddlwareLog(config.OptionalAuth(http.HandlerFunc(config.GetChirpsHandler))).ServeHTTP)
+	mux.HandleFunc("GET /api/chirps/search", chainMiddlwareLog(config.OptionalAuth(http.HandlerFunc(config.SearchChirpsHandler))).ServeHTTP)
+	mux.HandleFunc("GET /api/chirps/{chirpID}", chainMiddlwareLog(config.OptionalAuth(http.HandlerFunc(config.GetChirpByIdHandler))).ServeHTTP)
+	mux.HandleFunc("PUT /api/chirps/{chirpID}", chainMiddlwareLog(config.RequireAuth(auth.ScopeChirpsWrite)(http.HandlerFunc(config.UpdateChirpHandler))).ServeHTTP)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/revisions", chainMiddlwareLog(http.HandlerFunc(config.ListChirpRevisionsHandler)).ServeHTTP)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/thread", chainMiddlwareLog(config.OptionalAuth(http.HandlerFunc(config.GetChirpThreadHandler))).ServeHTTP)
+	mux.HandleFunc("POST /api/chirps/{chirpID}/like", chainMiddlwareLog(config.RequireAuth(auth.ScopeChirpsWrite)(http.HandlerFunc(config.LikeChirpHandler))).ServeHTTP)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/like", chainMiddlwareLog(config.RequireAuth(auth.ScopeChirpsWrite)(http.HandlerFunc(config.UnlikeChirpHandler))).ServeHTTP)
+	mux.HandleFunc("POST /api/chirps/{chirpID}/rechirp", chainMiddlwareLog(config.RequireAuth(auth.ScopeChirpsWrite)(http.HandlerFunc(config.RechirpHandler))).ServeHTTP)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/rechirp", chainMiddlwareLog(config.RequireAuth(auth.ScopeChirpsWrite)(http.HandlerFunc(config.UnrechirpHandler))).ServeHTTP)
+	mux.HandleFunc("GET /api/users/{userID}/likes", chainMiddlwareLog(config.OptionalAuth(http.HandlerFunc(config.ListUserLikesHandler))).ServeHTTP)
+	mux.HandleFunc("POST /api/users/{userID}/follow", chainMiddlwareLog(config.RequireAuth(auth.ScopeUsersWrite)(http.HandlerFunc(config.FollowUserHandler))).ServeHTTP)
+	mux.HandleFunc("DELETE /api/users/{userID}/follow", chainMiddlwareLog(config.RequireAuth(auth.ScopeUsersWrite)(http.HandlerFunc(config.UnfollowUserHandler))).ServeHTTP)
+	mux.HandleFunc("GET /api/users/{userID}/followers", chainMiddlwareLog(http.HandlerFunc(config.ListFollowersHandler)).ServeHTTP)
+	mux.HandleFunc("GET /api/users/{userID}/following", chainMiddlwareLog(http.HandlerFunc(config.ListFollowingHandler)).ServeHTTP)
+	mux.HandleFunc("GET /api/timeline", chainMiddlwareLog(config.RequireAuth()(http.HandlerFunc(config.TimelineHandler))).ServeHTTP)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}", chainMiddlwareLog(config.RequireAuth(auth.ScopeChirpsWrite)(http.HandlerFunc(config.DeleteChirpHandler))).ServeHTTP)
 
 	mux.HandleFunc("POST /api/refresh", chainMiddlwareLog(http.HandlerFunc(config.RefreshTokenHandler)).ServeHTTP)
 	mux.HandleFunc("POST /api/revoke", chainMiddlwareLog(http.HandlerFunc(config.RevokeTokenHandler)).ServeHTTP)
@@ -121,30 +454,83 @@ func main() {
 	fmt.Printf("📚 Документация API Chirpy:\n")
 	fmt.Printf("\n🔐 Аутентификация:\n")
 	fmt.Printf("   POST /api/users        - регистрация нового пользователя\n")
-	fmt.Printf("   POST /api/login        - вход пользователя (возвращает access и refresh токены)\n")
-	fmt.Printf("   POST /api/refresh      - обновление access токена\n")
+	fmt.Printf("   POST /api/login        - вход пользователя (возвращает access и refresh токены или mfa_token при включенном TOTP)\n")
+	fmt.Printf("   POST /api/login/mfa    - второй шаг входа: mfa_token и TOTP код или код восстановления\n")
+	fmt.Printf("   POST /api/login/magic  - отправка ссылки для входа без пароля на email (MAGIC_LINK_LOGIN=true)\n")
+	fmt.Printf("   POST /api/login/magic/confirm - вход по токену из ссылки (в том же браузере), ответ как у /api/login\n")
+	fmt.Printf("   POST /api/refresh      - обновление access токена (ротирует refresh токен)\n")
 	fmt.Printf("   POST /api/revoke       - отзыв refresh токена\n")
-	fmt.Printf("   PUT  /api/users        - обновление данных пользователя\n")
+	fmt.Printf("   X-Auth-Mode: cookie    - вход с токенами в HttpOnly cookie; изменяющие запросы требуют X-CSRF-Token\n")
+	fmt.Printf("   PUT  /api/users        - обновление email (после подтверждения) или пароля, требует current_password или X-Sudo-Token\n")
+	fmt.Printf("   DELETE /api/users      - удаление аккаунта (требует current_password или X-Sudo-Token)\n")
+	fmt.Printf("   POST /api/reauth       - повторный ввод пароля или email_code (и TOTP), выдает sudo токен на 10 минут\n")
+	fmt.Printf("   POST /api/reauth/email - код подтверждения на email для пользователей без пароля\n")
+	fmt.Printf("   POST /api/users/verify - подтверждение email по токену из письма\n")
+	fmt.Printf("   POST /api/users/verify/resend - повторная отправка письма для подтверждения email\n")
+	fmt.Printf("   POST /api/password-reset         - отправка ссылки для сброса пароля на email\n")
+	fmt.Printf("   POST /api/password-reset/confirm - установка нового пароля по токену из письма\n")
+	fmt.Printf("   GET  /api/sessions     - активные сессии (устройства) пользователя\n")
+	fmt.Printf("   DELETE /api/sessions/{id} - завершение сессии\n")
+	fmt.Printf("   POST /api/sessions/revoke-others - выход на всех устройствах, кроме текущего\n")
+	fmt.Printf("   POST /api/sessions/revoke-all    - выход на всех устройствах (access токены отзываются сразу)\n")
+	fmt.Printf("   GET  /api/auth/{provider}/login    - вход через OIDC провайдера (redirect на страницу провайдера)\n")
+	fmt.Printf("   GET  /api/auth/{provider}/callback - возврат от провайдера, redirect в /app/oidc/ с кодом входа\n")
+	fmt.Printf("   POST /api/auth/exchange            - обмен кода входа через провайдера на токены, ответ как у /api/login\n")
+	fmt.Printf("   POST /api/auth/{provider}/link     - привязка аккаунта провайдера (требует current_password или X-Sudo-Token)\n")
+	fmt.Printf("   GET  /api/identities      - привязанные аккаунты провайдеров\n")
+	fmt.Printf("   DELETE /api/identities/{id} - отвязка аккаунта провайдера\n")
+	fmt.Printf("   POST /api/tokens       - создание персонального токена доступа (токен показывается один раз)\n")
+	fmt.Printf("   GET  /api/tokens       - персональные токены пользователя\n")
+	fmt.Printf("   DELETE /api/tokens/{id} - отзыв персонального токена\n")
+	fmt.Printf("   POST /api/mfa/totp/enroll  - начало настройки TOTP (секрет и otpauth:// URI), требует current_password или X-Sudo-Token\n")
+	fmt.Printf("   POST /api/mfa/totp/confirm - включение TOTP по первому коду (возвращает коды восстановления)\n")
+	fmt.Printf("   DELETE /api/mfa/totp       - выключение TOTP (требует код и current_password или X-Sudo-Token)\n")
+	fmt.Printf("   GET  /.well-known/jwks.json - публичные ключи для проверки access токенов\n")
+
+	fmt.Printf("\n🔗 OAuth 2.0 для сторонних приложений:\n")
+	fmt.Printf("   POST /api/oauth/clients      - регистрация приложения (client_secret показывается один раз)\n")
+	fmt.Printf("   GET  /api/oauth/clients      - приложения пользователя\n")
+	fmt.Printf("   DELETE /api/oauth/clients/{id} - удаление приложения и отзыв его токенов\n")
+	fmt.Printf("   GET  /oauth/authorize        - страница согласия (authorization code flow с PKCE S256)\n")
+	fmt.Printf("   POST /oauth/token            - обмен кода и обновление токенов (grant_type=authorization_code|refresh_token)\n")
+	fmt.Printf("   POST /oauth/revoke           - отзыв токена приложения (RFC 7009)\n")
+	fmt.Printf("   POST /oauth/introspect       - проверка токена приложения (RFC 7662)\n")
 
 	fmt.Printf("\n🐦 Chirps:\n")
-	fmt.Printf("   POST /api/chirps       - создание нового chirp (требует аутентификации)\n")
-	fmt.Printf("   GET  /api/chirps       - получение всех chirps (опционально: ?author_id=UUID&sort=asc|desc)\n")
+	fmt.Printf("   POST /api/chirps       - создание нового chirp (требует аутентификации и подтвержденного email; in_reply_to - ответ)\n")
+	fmt.Printf("   GET  /api/chirps       - получение chirps постранично (опционально: ?author_id=UUID&sort=asc|desc&limit=N&after|before=CURSOR)\n")
+	fmt.Printf("   GET  /api/chirps/search - полнотекстовый поиск (?q=текст&author_id=UUID&from=ДАТА&to=ДАТА&limit=N&offset=N)\n")
 	fmt.Printf("   GET  /api/chirps/{id}  - получение chirp по ID\n")
-	fmt.Printf("   DELETE /api/chirps/{id} - удаление chirp (только автор)\n")
+	fmt.Printf("   PUT  /api/chirps/{id}  - редактирование chirp автором (в течение CHIRP_EDIT_WINDOW после публикации)\n")
+	fmt.Printf("   GET  /api/chirps/{id}/revisions - предыдущие версии текста chirp\n")
+	fmt.Printf("   GET  /api/chirps/{id}/thread - ветка обсуждения: предки и дерево ответов (?limit=N&after=CURSOR)\n")
+	fmt.Printf("   POST /api/chirps/{id}/like   - лайк chirp (DELETE - снять лайк)\n")
+	fmt.Printf("   POST /api/chirps/{id}/rechirp - rechirp (DELETE - отменить); цитата - POST /api/chirps с quote_of\n")
+	fmt.Printf("   GET  /api/users/{id}/likes   - chirps, лайкнутые пользователем (?limit=N&after=CURSOR)\n")
+	fmt.Printf("   POST /api/users/{id}/follow  - подписка на пользователя (DELETE - отписка)\n")
+	fmt.Printf("   GET  /api/users/{id}/followers - подписчики (following - подписки) с общим числом (?limit=N&after=CURSOR)\n")
+	fmt.Printf("   GET  /api/timeline           - лента: chirps подписок и свои, от новых к старым (?limit=N&after=CURSOR)\n")
+	fmt.Printf("   Запросы chirps с токеном возвращают liked_by_me\n")
+	fmt.Printf("   DELETE /api/chirps/{id} - удаление chirp (автор или модератор; chirp с ответами остается надгробием)\n")
 
 	fmt.Printf("\n⚙️  Администрирование:\n")
 	fmt.Printf("   GET  /admin/metrics    - просмотр метрик\n")
 	fmt.Printf("   POST /admin/reset      - сброс метрик (только в dev режиме)\n")
+	fmt.Printf("   PUT  /admin/users/{id}/role - смена роли пользователя (требует роль admin)\n")
+	fmt.Printf("   POST|DELETE /admin/users/{id}/ban - блокировка / разблокировка пользователя (требует роль admin)\n")
+	fmt.Printf("   POST /admin/users/{id}/unlock - снятие блокировки входа (?ip=АДРЕС также для IP, требует роль admin)\n")
 
 	fmt.Printf("\n🌐 Вебхуки:\n")
 	fmt.Printf("   POST /api/polka/webhooks - обработка вебхуков от Polka (требует API ключ)\n")
 
 	fmt.Printf("\n📋 Примеры использования:\n")
-	fmt.Printf("   Регистрация: curl -X POST http://localhost:8080/api/users -d '{\"email\":\"user@example.com\",\"password\":\"pass\"}'\n")
+	fmt.Printf("   Регистрация: curl -X POST http://localhost:8080/api/users -d '{\"email\":\"user@example.com\",\"password\":\"correct horse battery\"}'\n")
 	fmt.Printf("   Получение chirps автора: curl http://localhost:8080/api/chirps?author_id=UUID\n")
 	fmt.Printf("   Создание chirp: curl -X POST -H 'Authorization: Bearer TOKEN' http://localhost:8080/api/chirps -d '{\"body\":\"Text\"}'\n")
 	fmt.Printf("   Получение chirps с сортировкой: curl http://localhost:8080/api/chirps?sort=desc\n")
 	fmt.Printf("   Фильтрация и сортировка: curl http://localhost:8080/api/chirps?author_id=UUID&sort=desc\n")
+	fmt.Printf("   Поиск: curl 'http://localhost:8080/api/chirps/search?q=\"hello world\" chirp*'\n")
+	fmt.Printf("   Следующая страница: curl http://localhost:8080/api/chirps?limit=20&after=CURSOR\n")
 
 	fmt.Printf("\n------------------------------------------------------------------------------------------------------------------------------------\n")
 
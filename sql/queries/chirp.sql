@@ -1,18 +1,17 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (body, user_id)
-VALUES ($1, $2)
-RETURNING *;
+INSERT INTO chirps (body, user_id, parent_id, root_id, quote_of_id)
+VALUES ($1, $2::uuid, $3, $4, $5)
+RETURNING id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, deleted_at, like_count, rechirp_of_id, quote_of_id;
 
 -- name: DeleteAllChirps :exec
 DELETE FROM chirps;
 
--- name: GetChirps :many
-SELECT * FROM chirps
-ORDER BY created_at ASC;
-
+-- Надгробия удаленных chirps (deleted_at) видны только в ветках обсуждений
 -- name: GetChirpsById :one
-SELECT * FROM chirps
-WHERE id = $1;
+SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, deleted_at, like_count, rechirp_of_id, quote_of_id
+FROM chirps
+WHERE id = $1
+  AND deleted_at IS NULL;
 
 
 -- name: DeleteChirp :exec
@@ -20,10 +19,63 @@ DELETE FROM chirps
 WHERE id = $1;
 
 -- name: GetChirpByID :one
-SELECT * FROM chirps 
-WHERE id = $1;
+SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, deleted_at, like_count, rechirp_of_id, quote_of_id
+FROM chirps
+WHERE id = $1
+  AND deleted_at IS NULL;
+
+-- Блокирует chirp до конца транзакции редактирования: параллельные правки
+-- выполняются по очереди и не теряют версии текста
+-- name: GetChirpForUpdate :one
+SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, deleted_at, like_count, rechirp_of_id, quote_of_id
+FROM chirps
+WHERE id = $1
+FOR UPDATE;
+
+-- Текст меняется только в пределах окна редактирования от публикации.
+-- sql.ErrNoRows - окно истекло
+-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = sqlc.arg('body'), updated_at = NOW(), edited_at = NOW()
+WHERE id = sqlc.arg('id')
+  AND created_at > NOW() - make_interval(secs => sqlc.arg('edit_window_seconds')::float8)
+RETURNING id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, deleted_at, like_count, rechirp_of_id, quote_of_id;
+
+-- Keyset-пагинация по возрастанию: строки строго после курсора (created_at, id)
+-- name: ListChirpsAsc :many
+SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, deleted_at, like_count, rechirp_of_id, quote_of_id
+FROM chirps
+WHERE deleted_at IS NULL
+  AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+  AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+       OR (created_at, id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('page_limit');
+
+-- Keyset-пагинация по убыванию: строки строго до курсора (created_at, id)
+-- name: ListChirpsDesc :many
+SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, deleted_at, like_count, rechirp_of_id, quote_of_id
+FROM chirps
+WHERE deleted_at IS NULL
+  AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+  AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+       OR (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('page_limit');
 
--- name: GetChirpsByAuthorID :many
-SELECT * FROM chirps 
-WHERE user_id = $1
-ORDER BY created_at ASC;
\ No newline at end of file
+-- Полнотекстовый поиск: ранжирование по ts_rank и подсветка фрагментов.
+-- Маркеры подсветки chr(1)/chr(2) заменяются на <mark> после HTML-экранирования
+-- name: SearchChirps :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.edited_at,
+       chirps.parent_id, chirps.root_id, chirps.like_count, chirps.quote_of_id,
+       ts_rank(chirps.search_vector, query)::real AS rank,
+       ts_headline('english', chirps.body, query,
+                   'StartSel=' || chr(1) || ', StopSel=' || chr(2) || ', MaxFragments=2, MinWords=5, MaxWords=20')::text AS snippet
+FROM chirps, to_tsquery('english', sqlc.arg('query')::text) AS query
+WHERE chirps.search_vector @@ query
+  AND chirps.deleted_at IS NULL
+  AND (sqlc.narg('author_id')::uuid IS NULL OR chirps.user_id = sqlc.narg('author_id')::uuid)
+  AND (sqlc.narg('created_from')::timestamp IS NULL OR chirps.created_at >= sqlc.narg('created_from')::timestamp)
+  AND (sqlc.narg('created_to')::timestamp IS NULL OR chirps.created_at < sqlc.narg('created_to')::timestamp)
+ORDER BY rank DESC, chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('page_limit') OFFSET sqlc.arg('page_offset');
@@ -0,0 +1,44 @@
+-- Повторный лайк не создает строку: 0 строк - chirp уже отмечен пользователем
+-- name: CreateChirpLike :execrows
+INSERT INTO chirp_likes (user_id, chirp_id)
+VALUES ($1, $2)
+ON CONFLICT (user_id, chirp_id) DO NOTHING;
+
+-- name: DeleteChirpLike :execrows
+DELETE FROM chirp_likes
+WHERE user_id = $1
+  AND chirp_id = $2;
+
+-- Атомарное изменение счетчика: параллельные лайки выполняются по очереди на
+-- блокировке строки chirp. delta = 0 просто возвращает текущее значение
+-- name: AdjustChirpLikeCount :one
+UPDATE chirps
+SET like_count = like_count + sqlc.arg('delta')::int
+WHERE id = sqlc.arg('id')
+RETURNING like_count;
+
+-- Перед удалением аккаунта: его лайки удалятся каскадно, счетчики уменьшаем здесь
+-- name: DecrementUserLikedChirpCounts :exec
+UPDATE chirps
+SET like_count = like_count - 1
+WHERE id IN (SELECT chirp_id FROM chirp_likes WHERE user_id = $1);
+
+-- Какие из chirps страницы отмечены пользователем (liked_by_me одним запросом)
+-- name: ListLikedChirpIDs :many
+SELECT chirp_id FROM chirp_likes
+WHERE user_id = sqlc.arg('user_id')
+  AND chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[]);
+
+-- Лайкнутые пользователем chirps от последнего лайка; курсор - (liked_at, id)
+-- name: ListUserLikedChirps :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.edited_at,
+       chirps.parent_id, chirps.root_id, chirps.deleted_at, chirps.like_count, chirps.rechirp_of_id, chirps.quote_of_id,
+       chirp_likes.created_at AS liked_at
+FROM chirp_likes
+JOIN chirps ON chirps.id = chirp_likes.chirp_id
+WHERE chirp_likes.user_id = sqlc.arg('user_id')
+  AND chirps.deleted_at IS NULL
+  AND (sqlc.narg('cursor_liked_at')::timestamp IS NULL
+       OR (chirp_likes.created_at, chirp_likes.chirp_id) < (sqlc.narg('cursor_liked_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY chirp_likes.created_at DESC, chirp_likes.chirp_id DESC
+LIMIT sqlc.arg('page_limit');
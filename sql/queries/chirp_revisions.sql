@@ -0,0 +1,17 @@
+-- name: CreateChirpRevision :exec
+INSERT INTO chirp_revisions (chirp_id, body, published_at)
+VALUES ($1, $2, $3);
+
+-- name: ListChirpRevisions :many
+SELECT * FROM chirp_revisions
+WHERE chirp_id = $1
+ORDER BY replaced_at DESC, id DESC;
+
+-- name: DeleteChirpRevisions :exec
+DELETE FROM chirp_revisions
+WHERE chirp_id = $1;
+
+-- История правок chirps пользователя: надгробия удаленного аккаунта не хранят текст
+-- name: DeleteUserChirpRevisions :exec
+DELETE FROM chirp_revisions
+WHERE chirp_id IN (SELECT id FROM chirps WHERE user_id = sqlc.arg('user_id')::uuid);
@@ -0,0 +1,96 @@
+-- Есть ли у chirp ответы или цитаты: такой chirp при удалении становится надгробием
+-- name: ChirpIsReferenced :one
+SELECT EXISTS (
+    SELECT 1 FROM chirps
+    WHERE parent_id = sqlc.arg('chirp_id')::uuid
+       OR quote_of_id = sqlc.arg('chirp_id')::uuid
+) AS is_referenced;
+
+-- Удаленный chirp с ответами или цитатами остается надгробием без текста
+-- name: TombstoneChirp :exec
+UPDATE chirps
+SET body = '', updated_at = NOW(), deleted_at = NOW()
+WHERE id = $1;
+
+-- Удаляет надгробие, у которого не осталось ответов и цитат, и возвращает его
+-- родителя и процитированный chirp для дальнейшей очистки. sql.ErrNoRows -
+-- удалять нечего
+-- name: DeleteOrphanTombstone :one
+DELETE FROM chirps
+WHERE id = $1
+  AND deleted_at IS NOT NULL
+  AND NOT EXISTS (SELECT 1 FROM chirps AS refs WHERE refs.parent_id = $1 OR refs.quote_of_id = $1)
+RETURNING parent_id, quote_of_id;
+
+-- Удаляет rechirps chirps пользователя перед удалением аккаунта: оригиналы
+-- станут надгробиями, а rechirps их не переживают
+-- name: DeleteRechirpsOfUserChirps :exec
+DELETE FROM chirps
+WHERE rechirp_of_id IN (SELECT id FROM chirps WHERE user_id = sqlc.arg('user_id')::uuid);
+
+-- Превращает все chirps пользователя в надгробия перед удалением аккаунта и
+-- возвращает их ID: надгробия без ответов и цитат затем удаляются
+-- name: TombstoneUserChirps :many
+UPDATE chirps
+SET body = '', updated_at = NOW(), deleted_at = COALESCE(deleted_at, NOW())
+WHERE user_id = sqlc.arg('user_id')::uuid
+RETURNING id;
+
+-- Удаляет надгробия из ids, у которых не осталось ответов и цитат, и
+-- возвращает их родителей и процитированные chirps для следующего прохода.
+-- Ответы, удаленные тем же проходом, еще видны, поэтому цепочка удаляется по уровням
+-- name: DeleteOrphanTombstones :many
+DELETE FROM chirps
+WHERE id = ANY(sqlc.arg('ids')::uuid[])
+  AND deleted_at IS NOT NULL
+  AND NOT EXISTS (SELECT 1 FROM chirps AS refs WHERE refs.parent_id = chirps.id OR refs.quote_of_id = chirps.id)
+RETURNING parent_id, quote_of_id;
+
+-- Chirp (depth 0) и цепочка его предков до корня ветки, включая надгробия
+-- name: ListThreadAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, deleted_at, like_count, quote_of_id, 0 AS depth
+    FROM chirps
+    WHERE id = sqlc.arg('chirp_id')
+  UNION ALL
+    SELECT c.id, c.created_at, c.updated_at, c.body, c.user_id, c.edited_at, c.parent_id, c.root_id, c.deleted_at, c.like_count, c.quote_of_id, a.depth + 1
+    FROM chirps AS c
+    JOIN ancestors AS a ON c.id = a.parent_id
+)
+SELECT ancestors.id, ancestors.created_at, ancestors.updated_at, ancestors.body, ancestors.user_id,
+       ancestors.edited_at, ancestors.parent_id, ancestors.root_id, ancestors.deleted_at, ancestors.like_count, ancestors.quote_of_id,
+       ancestors.depth::int AS depth,
+       (SELECT COUNT(*) FROM chirps AS replies WHERE replies.parent_id = ancestors.id) AS reply_count
+FROM ancestors
+ORDER BY ancestors.depth DESC;
+
+-- Страница прямых ответов на chirp (keyset по created_at, id). Более глубокие
+-- уровни дерева загружаются ListThreadLevel
+-- name: ListThreadReplies :many
+SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, deleted_at, like_count, quote_of_id,
+       1 AS depth,
+       (SELECT COUNT(*) FROM chirps AS children WHERE children.parent_id = chirps.id) AS reply_count
+FROM chirps
+WHERE parent_id = sqlc.arg('chirp_id')
+  AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+       OR (created_at, id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('page_limit');
+
+-- Следующий уровень дерева: ответы на chirps parent_ids, не больше row_limit
+-- строк. Для каждого родителя по индексу (parent_id, created_at, id) читается
+-- не больше row_limit ответов, поэтому запрос не обходит поддерево целиком
+-- name: ListThreadLevel :many
+SELECT c.id, c.created_at, c.updated_at, c.body, c.user_id, c.edited_at, c.parent_id, c.root_id, c.deleted_at, c.like_count, c.quote_of_id,
+       sqlc.arg('depth')::int AS depth,
+       (SELECT COUNT(*) FROM chirps AS children WHERE children.parent_id = c.id) AS reply_count
+FROM unnest(sqlc.arg('parent_ids')::uuid[]) AS parents(id)
+CROSS JOIN LATERAL (
+    SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, deleted_at, like_count, quote_of_id
+    FROM chirps
+    WHERE chirps.parent_id = parents.id
+    ORDER BY chirps.created_at ASC, chirps.id ASC
+    LIMIT sqlc.arg('row_limit')
+) AS c
+ORDER BY c.created_at ASC, c.id ASC
+LIMIT sqlc.arg('row_limit');
@@ -0,0 +1,37 @@
+-- name: CreateEmailVerificationToken :exec
+INSERT INTO email_verification_tokens (token_hash, user_id, email, expires_at)
+VALUES ($1, $2, $3, $4);
+
+-- Аннулируем ранее выданные токены: действует только последнее письмо
+-- name: InvalidateEmailVerificationTokens :exec
+UPDATE email_verification_tokens
+SET used_at = NOW()
+WHERE user_id = $1
+  AND used_at IS NULL;
+
+-- Атомарно помечаем токен использованным. Если токен не найден, истек или
+-- уже использован, строка не вернется (sql.ErrNoRows)
+-- name: ConsumeEmailVerificationToken :one
+UPDATE email_verification_tokens
+SET used_at = NOW()
+WHERE token_hash = $1
+  AND used_at IS NULL
+  AND expires_at > NOW()
+RETURNING *;
+
+-- name: SetUserPendingEmail :exec
+UPDATE users
+SET pending_email = $2,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- Подтверждение адреса: для смены email он становится основным.
+-- Нарушение уникальности означает, что адрес успели занять
+-- name: VerifyUserEmail :one
+UPDATE users
+SET email = $2,
+    email_verified_at = NOW(),
+    pending_email = NULL,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING *;
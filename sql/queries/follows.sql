@@ -0,0 +1,68 @@
+-- Повторная подписка не создает строку: 0 строк - пользователь уже подписан
+-- name: CreateFollow :execrows
+INSERT INTO follows (follower_id, followee_id)
+VALUES ($1, $2)
+ON CONFLICT (follower_id, followee_id) DO NOTHING;
+
+-- name: DeleteFollow :execrows
+DELETE FROM follows
+WHERE follower_id = $1
+  AND followee_id = $2;
+
+-- Атомарное изменение счетчиков обоих пользователей одним запросом:
+-- параллельные подписки выполняются по очереди на блокировках строк users
+-- name: AdjustFollowCounts :exec
+UPDATE users
+SET following_count = following_count + CASE WHEN id = sqlc.arg('follower_id')::uuid THEN sqlc.arg('delta')::int ELSE 0 END,
+    follower_count = follower_count + CASE WHEN id = sqlc.arg('followee_id')::uuid THEN sqlc.arg('delta')::int ELSE 0 END
+WHERE id IN (sqlc.arg('follower_id')::uuid, sqlc.arg('followee_id')::uuid);
+
+-- Перед удалением аккаунта: его подписки удалятся каскадно, счетчики
+-- пользователей, на которых он подписан, уменьшаем здесь
+-- name: DecrementFolloweeCounts :exec
+UPDATE users
+SET follower_count = follower_count - 1
+WHERE id IN (SELECT followee_id FROM follows WHERE follower_id = $1);
+
+-- Перед удалением аккаунта: счетчики подписок его подписчиков
+-- name: DecrementFollowerCounts :exec
+UPDATE users
+SET following_count = following_count - 1
+WHERE id IN (SELECT follower_id FROM follows WHERE followee_id = $1);
+
+-- Подписчики пользователя от последней подписки; курсор - (followed_at, id)
+-- name: ListFollowers :many
+SELECT follower_id AS id, created_at AS followed_at
+FROM follows
+WHERE followee_id = sqlc.arg('user_id')
+  AND (sqlc.narg('cursor_followed_at')::timestamp IS NULL
+       OR (created_at, follower_id) < (sqlc.narg('cursor_followed_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at DESC, follower_id DESC
+LIMIT sqlc.arg('page_limit');
+
+-- Подписки пользователя от последней; курсор - (followed_at, id)
+-- name: ListFollowing :many
+SELECT followee_id AS id, created_at AS followed_at
+FROM follows
+WHERE follower_id = sqlc.arg('user_id')
+  AND (sqlc.narg('cursor_followed_at')::timestamp IS NULL
+       OR (created_at, followee_id) < (sqlc.narg('cursor_followed_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at DESC, followee_id DESC
+LIMIT sqlc.arg('page_limit');
+
+-- Лента: chirps подписок и самого пользователя от новых к старым. Keyset по
+-- (created_at, id): планировщик сам выбирает между обходом индекса
+-- (created_at, id) с фильтром по авторам и индексом (user_id, created_at, id)
+-- name: ListTimeline :many
+SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, deleted_at, like_count, rechirp_of_id, quote_of_id
+FROM chirps
+WHERE user_id IN (
+        SELECT followee_id FROM follows WHERE follower_id = sqlc.arg('user_id')
+        UNION ALL
+        SELECT sqlc.arg('user_id')::uuid
+    )
+  AND deleted_at IS NULL
+  AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+       OR (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('page_limit');
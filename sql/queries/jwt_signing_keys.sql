@@ -0,0 +1,27 @@
+-- name: ListJWTSigningKeys :many
+SELECT * FROM jwt_signing_keys
+ORDER BY activates_at;
+
+-- Ключ с тем же kid уже сохранен другим экземпляром - ничего не делаем
+-- name: CreateJWTSigningKey :exec
+INSERT INTO jwt_signing_keys (kid, alg, private_key, created_at, activates_at)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (kid) DO NOTHING;
+
+-- name: DeleteJWTSigningKey :exec
+DELETE FROM jwt_signing_keys
+WHERE kid = $1;
+
+-- Заменяет зашифрованный приватный ключ (перешифрование другим секретом)
+-- name: UpdateJWTSigningKeyPrivateKey :exec
+UPDATE jwt_signing_keys
+SET private_key = $2
+WHERE kid = $1;
+
+-- Момент перехода на асимметричные ключи: сохраняет cutover_at при первом
+-- вызове и возвращает уже сохраненное значение при последующих
+-- name: GetJWTLegacyCutover :one
+INSERT INTO jwt_legacy_cutover (cutover_at)
+VALUES ($1)
+ON CONFLICT (singleton) DO UPDATE SET cutover_at = jwt_legacy_cutover.cutover_at
+RETURNING cutover_at;
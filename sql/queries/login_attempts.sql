@@ -0,0 +1,33 @@
+-- Создает недостающие счетчики, чтобы их можно было заблокировать FOR UPDATE
+-- name: CreateLoginAttempts :exec
+INSERT INTO login_attempts (attempt_key, failures, last_failure_at)
+SELECT unnest(sqlc.arg('attempt_keys')::text[]), 0, NOW()
+ON CONFLICT (attempt_key) DO NOTHING;
+
+-- Счетчики по ключам, заблокированные до конца транзакции: параллельные
+-- попытки входа по тем же ключам ждут и видят уже увеличенный счетчик
+-- name: ListLoginAttemptsForUpdate :many
+SELECT * FROM login_attempts
+WHERE attempt_key = ANY(sqlc.arg('attempt_keys')::text[])
+ORDER BY attempt_key
+FOR UPDATE;
+
+-- name: RecordLoginFailure :exec
+UPDATE login_attempts
+SET failures = $2, last_failure_at = NOW(), locked_until = $3
+WHERE attempt_key = $1;
+
+-- Возвращает попытку, заранее засчитанную неудачной, если она оказалась
+-- успешной. Блокировка снимается, если без этой попытки ее бы не было
+-- name: RefundLoginFailure :exec
+UPDATE login_attempts
+SET failures = GREATEST(failures - 1, 0),
+    locked_until = CASE
+        WHEN failures - 1 < sqlc.arg('free_attempts')::int THEN NULL
+        ELSE locked_until
+    END
+WHERE attempt_key = sqlc.arg('attempt_key');
+
+-- name: ClearLoginAttempts :exec
+DELETE FROM login_attempts
+WHERE attempt_key = ANY(sqlc.arg('attempt_keys')::text[]);
@@ -0,0 +1,22 @@
+-- name: CreateMagicLinkToken :exec
+INSERT INTO magic_link_tokens (token_hash, user_id, nonce_hash, expires_at)
+VALUES ($1, $2, $3, $4);
+
+-- Аннулируем ранее выданные ссылки: действует только последнее письмо
+-- name: InvalidateMagicLinkTokens :exec
+UPDATE magic_link_tokens
+SET used_at = NOW()
+WHERE user_id = $1
+  AND used_at IS NULL;
+
+-- Атомарно помечаем ссылку использованной. Ссылка, открытая в другом браузере
+-- (nonce не совпал), не тратится. sql.ErrNoRows - неверная, истекшая,
+-- использованная ссылка или чужой браузер
+-- name: ConsumeMagicLinkToken :one
+UPDATE magic_link_tokens
+SET used_at = NOW()
+WHERE token_hash = $1
+  AND nonce_hash = $2
+  AND used_at IS NULL
+  AND expires_at > NOW()
+RETURNING *;
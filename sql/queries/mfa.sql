@@ -0,0 +1,51 @@
+-- Начало настройки TOTP: сохраняем новый секрет, пока TOTP не подтвержден.
+-- Если TOTP уже включен, строка не обновится
+-- name: SetUserTOTPSecret :execrows
+UPDATE users
+SET totp_secret = $2,
+    updated_at = NOW()
+WHERE id = $1
+  AND totp_enabled_at IS NULL;
+
+-- name: EnableUserTOTP :exec
+UPDATE users
+SET totp_enabled_at = NOW(),
+    totp_last_step = $2,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: DisableUserTOTP :exec
+UPDATE users
+SET totp_secret = NULL,
+    totp_enabled_at = NULL,
+    totp_last_step = 0,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- Принимаем шаг TOTP только если он новее последнего использованного.
+-- 0 строк означает повторное использование кода
+-- name: UpdateTOTPLastStep :execrows
+UPDATE users
+SET totp_last_step = $2
+WHERE id = $1
+  AND totp_last_step < $2;
+
+-- name: CreateRecoveryCode :exec
+INSERT INTO mfa_recovery_codes (user_id, code_hash)
+VALUES ($1, $2);
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM mfa_recovery_codes
+WHERE user_id = $1;
+
+-- name: UseRecoveryCode :execrows
+UPDATE mfa_recovery_codes
+SET used_at = NOW()
+WHERE user_id = $1
+  AND code_hash = $2
+  AND used_at IS NULL;
+
+-- name: CountUnusedRecoveryCodes :one
+SELECT COUNT(*) FROM mfa_recovery_codes
+WHERE user_id = $1
+  AND used_at IS NULL;
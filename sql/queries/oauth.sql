@@ -0,0 +1,65 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (owner_id, name, secret_hash, redirect_uris, scopes)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING *;
+
+-- Действующий клиент (sql.ErrNoRows - неизвестный или удаленный client_id)
+-- name: GetOAuthClient :one
+SELECT * FROM oauth_clients
+WHERE id = $1
+  AND revoked_at IS NULL;
+
+-- name: ListOAuthClients :many
+SELECT * FROM oauth_clients
+WHERE owner_id = $1
+  AND revoked_at IS NULL
+ORDER BY created_at DESC;
+
+-- Удаление клиента. 0 строк - клиент не найден или чужой
+-- name: RevokeOAuthClient :execrows
+UPDATE oauth_clients
+SET revoked_at = NOW()
+WHERE id = $1
+  AND owner_id = $2
+  AND revoked_at IS NULL;
+
+-- name: RevokeOAuthClientTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE client_id = $1 AND revoked_at IS NULL;
+
+-- Сессия приложения действует: в семействе есть неотозванный refresh token
+-- этого клиента, и клиент не удален. Access token отозванной сессии неактивен
+-- name: IsOAuthSessionActive :one
+SELECT EXISTS (
+    SELECT 1 FROM refresh_tokens
+    JOIN oauth_clients ON oauth_clients.id = refresh_tokens.client_id
+    WHERE refresh_tokens.family_id = $1
+      AND refresh_tokens.client_id = $2
+      AND refresh_tokens.revoked_at IS NULL
+      AND refresh_tokens.expires_at > NOW()
+      AND oauth_clients.revoked_at IS NULL
+);
+
+-- name: CreateOAuthAuthorizationCode :exec
+INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, family_id, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
+
+-- Атомарно отмечаем код использованным: параллельный обмен того же кода не пройдет
+-- name: ConsumeOAuthAuthorizationCode :one
+UPDATE oauth_authorization_codes
+SET used_at = NOW()
+WHERE code_hash = $1
+  AND used_at IS NULL
+  AND expires_at > NOW()
+RETURNING *;
+
+-- Код, который уже был обменен на токены (для отзыва выданных по нему токенов)
+-- name: GetUsedOAuthAuthorizationCode :one
+SELECT * FROM oauth_authorization_codes
+WHERE code_hash = $1
+  AND used_at IS NOT NULL;
+
+-- name: DeleteExpiredOAuthAuthorizationCodes :exec
+DELETE FROM oauth_authorization_codes
+WHERE expires_at <= NOW();
@@ -0,0 +1,67 @@
+-- name: CreateOIDCLoginState :exec
+INSERT INTO oidc_login_states (state_hash, provider, nonce, code_verifier, link_user_id, expires_at, browser_hash)
+VALUES ($1, $2, $3, $4, $5, $6, $7);
+
+-- Атомарно забираем state: повторный callback с тем же state не пройдет.
+-- State из другого браузера (cookie не совпала) не тратится
+-- name: ConsumeOIDCLoginState :one
+DELETE FROM oidc_login_states
+WHERE state_hash = $1
+  AND browser_hash = $2
+  AND expires_at > NOW()
+RETURNING *;
+
+-- name: DeleteExpiredOIDCLoginStates :exec
+DELETE FROM oidc_login_states
+WHERE expires_at <= NOW();
+
+-- name: CreateOIDCLoginCode :exec
+INSERT INTO oidc_login_codes (code_hash, user_id, browser_hash, expires_at)
+VALUES ($1, $2, $3, $4);
+
+-- Атомарно забираем код: повторный обмен не пройдет. Код из другого браузера
+-- (cookie не совпала) не тратится
+-- name: ConsumeOIDCLoginCode :one
+DELETE FROM oidc_login_codes
+WHERE code_hash = $1
+  AND browser_hash = $2
+  AND expires_at > NOW()
+RETURNING *;
+
+-- name: DeleteExpiredOIDCLoginCodes :exec
+DELETE FROM oidc_login_codes
+WHERE expires_at <= NOW();
+
+-- name: GetUserByIdentity :one
+SELECT users.* FROM users
+JOIN user_identities ON user_identities.user_id = users.id
+WHERE user_identities.provider = $1
+  AND user_identities.subject = $2;
+
+-- name: CreateUserIdentity :one
+INSERT INTO user_identities (user_id, provider, subject, email)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: TouchUserIdentity :exec
+UPDATE user_identities
+SET last_login_at = NOW()
+WHERE provider = $1
+  AND subject = $2;
+
+-- Пользователь, созданный при первом входе через провайдера: пароля нет
+-- (hashed_password остается 'unset'). Создается только с email, подтвержденным провайдером
+-- name: CreateExternalUser :one
+INSERT INTO users (email, email_verified_at)
+VALUES ($1, $2)
+RETURNING *;
+
+-- name: ListUserIdentities :many
+SELECT * FROM user_identities
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: DeleteUserIdentity :execrows
+DELETE FROM user_identities
+WHERE id = $1
+  AND user_id = $2;
@@ -0,0 +1,29 @@
+-- name: CreatePasswordResetToken :exec
+INSERT INTO password_reset_tokens (token_hash, user_id, expires_at)
+VALUES ($1, $2, $3);
+
+-- Аннулируем ранее выданные токены: действует только последнее письмо
+-- name: InvalidatePasswordResetTokens :exec
+UPDATE password_reset_tokens
+SET used_at = NOW()
+WHERE user_id = $1
+  AND used_at IS NULL;
+
+-- Атомарно помечаем токен использованным. Если токен не найден, истек или
+-- уже использован, строка не вернется (sql.ErrNoRows)
+-- name: ConsumePasswordResetToken :one
+UPDATE password_reset_tokens
+SET used_at = NOW()
+WHERE token_hash = $1
+  AND used_at IS NULL
+  AND expires_at > NOW()
+RETURNING *;
+
+-- Email владельца действующего токена (для проверки нового пароля до сброса)
+-- name: GetPasswordResetTokenEmail :one
+SELECT users.email
+FROM password_reset_tokens
+JOIN users ON users.id = password_reset_tokens.user_id
+WHERE password_reset_tokens.token_hash = $1
+  AND password_reset_tokens.used_at IS NULL
+  AND password_reset_tokens.expires_at > NOW();
@@ -0,0 +1,41 @@
+-- name: CreatePersonalAccessToken :one
+INSERT INTO personal_access_tokens (user_id, name, token_hash, scopes, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING *;
+
+-- Действующий токен вместе с ролью владельца (sql.ErrNoRows - неверный,
+-- истекший или отозванный токен)
+-- name: GetActivePersonalAccessToken :one
+SELECT personal_access_tokens.id, personal_access_tokens.user_id, personal_access_tokens.scopes, users.role
+FROM personal_access_tokens
+JOIN users ON users.id = personal_access_tokens.user_id
+WHERE personal_access_tokens.token_hash = $1
+  AND personal_access_tokens.revoked_at IS NULL
+  AND (personal_access_tokens.expires_at IS NULL OR personal_access_tokens.expires_at > NOW());
+
+-- Время последнего использования обновляется не чаще раза в минуту,
+-- чтобы частые запросы скрипта не превращались в запись на каждый запрос
+-- name: TouchPersonalAccessToken :exec
+UPDATE personal_access_tokens
+SET last_used_at = NOW()
+WHERE id = $1
+  AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute');
+
+-- name: ListPersonalAccessTokens :many
+SELECT * FROM personal_access_tokens
+WHERE user_id = $1
+  AND revoked_at IS NULL
+ORDER BY created_at DESC;
+
+-- name: RevokePersonalAccessToken :execrows
+UPDATE personal_access_tokens
+SET revoked_at = NOW()
+WHERE id = $1
+  AND user_id = $2
+  AND revoked_at IS NULL;
+
+-- name: RevokeAllPersonalAccessTokens :exec
+UPDATE personal_access_tokens
+SET revoked_at = NOW()
+WHERE user_id = $1
+  AND revoked_at IS NULL;
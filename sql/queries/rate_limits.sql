@@ -0,0 +1,15 @@
+-- Атомарно учитываем запрос и возвращаем счетчик окна. Если окно началось
+-- раньше window_start, оно начинается заново с этого запроса
+-- name: HitRateLimit :one
+INSERT INTO rate_limits (limit_key, window_started_at, hits)
+VALUES (sqlc.arg('limit_key'), NOW(), 1)
+ON CONFLICT (limit_key) DO UPDATE
+SET hits = CASE
+        WHEN rate_limits.window_started_at < sqlc.arg('window_start')::timestamp THEN 1
+        ELSE rate_limits.hits + 1
+    END,
+    window_started_at = CASE
+        WHEN rate_limits.window_started_at < sqlc.arg('window_start')::timestamp THEN NOW()
+        ELSE rate_limits.window_started_at
+    END
+RETURNING *;
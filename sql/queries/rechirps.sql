@@ -0,0 +1,32 @@
+-- Блокирует оригинал до конца транзакции rechirp: параллельное удаление
+-- дождется ее, а rechirp уже удаляемого chirp вернет sql.ErrNoRows
+-- name: GetChirpForShare :one
+SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, deleted_at, like_count, rechirp_of_id, quote_of_id
+FROM chirps
+WHERE id = $1
+  AND deleted_at IS NULL
+FOR SHARE;
+
+-- Повторный rechirp не создает строку: sql.ErrNoRows - пользователь уже сделал rechirp
+-- name: CreateRechirp :one
+INSERT INTO chirps (body, user_id, rechirp_of_id)
+VALUES ('', $1::uuid, $2)
+ON CONFLICT (user_id, rechirp_of_id) WHERE rechirp_of_id IS NOT NULL DO NOTHING
+RETURNING id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, deleted_at, like_count, rechirp_of_id, quote_of_id;
+
+-- name: DeleteRechirp :execrows
+DELETE FROM chirps
+WHERE user_id = $1::uuid
+  AND rechirp_of_id = $2;
+
+-- Rechirps без оригинала не показываются: удаляются вместе с ним, даже если
+-- сам оригинал остается надгробием
+-- name: DeleteRechirpsOf :exec
+DELETE FROM chirps
+WHERE rechirp_of_id = $1;
+
+-- Оригиналы rechirps и цитат страницы одним запросом, включая надгробия
+-- name: ListChirpsByIDs :many
+SELECT id, created_at, updated_at, body, user_id, edited_at, parent_id, root_id, deleted_at, like_count, rechirp_of_id, quote_of_id
+FROM chirps
+WHERE id = ANY(sqlc.arg('ids')::uuid[]);
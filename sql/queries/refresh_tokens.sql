@@ -1,23 +1,39 @@
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, user_id, expires_at)
-VALUES ($1, $2, $3)
+INSERT INTO refresh_tokens (token_hash, user_id, expires_at, family_id, user_agent, ip, client_id, scopes)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 RETURNING *;
 
 -- name: GetRefreshToken :one
 SELECT * FROM refresh_tokens 
-WHERE token = $1;
+WHERE token_hash = $1;
 
 -- name: GetUserFromRefreshToken :one
 SELECT users.* FROM users
 JOIN refresh_tokens ON users.id = refresh_tokens.user_id
-WHERE refresh_tokens.token = $1 
+WHERE refresh_tokens.token_hash = $1 
   AND refresh_tokens.expires_at > NOW()
   AND refresh_tokens.revoked_at IS NULL;
 
 -- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens 
 SET revoked_at = NOW(), updated_at = NOW()
-WHERE token = $1;
+WHERE token_hash = $1;
+
+-- Ротация: отзываем активный токен и запоминаем, каким токеном он заменен.
+-- Если токен уже отозван или истек, строка не вернется (sql.ErrNoRows)
+-- name: RotateRefreshToken :one
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW(), replaced_by_hash = $2
+WHERE token_hash = $1
+  AND revoked_at IS NULL
+  AND expires_at > NOW()
+RETURNING *;
+
+-- Production: Отзыв всего семейства при повторном использовании ротированного токена
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL;
 
 -- Production рекомендация: Очистка истекших токенов (для maintenance)
 -- name: DeleteExpiredRefreshTokens :exec
@@ -28,4 +44,26 @@ WHERE expires_at < NOW();
 -- name: RevokeAllUserRefreshTokens :exec
 UPDATE refresh_tokens 
 SET revoked_at = NOW(), updated_at = NOW()
-WHERE user_id = $1 AND revoked_at IS NULL;
\ No newline at end of file
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- Активные сессии пользователя: в каждом семействе активен только последний токен.
+-- started_at - время входа (первый токен семейства)
+-- name: ListUserSessions :many
+SELECT rt.family_id, rt.user_agent, rt.ip, rt.last_used_at, rt.expires_at,
+       (SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.family_id = rt.family_id)::timestamp AS started_at
+FROM refresh_tokens rt
+WHERE rt.user_id = $1
+  AND rt.revoked_at IS NULL
+  AND rt.expires_at > NOW()
+ORDER BY rt.last_used_at DESC;
+
+-- Завершение сессии пользователя. 0 строк - сессия не найдена или чужая
+-- name: RevokeUserSession :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeOtherUserSessions :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND family_id <> $2 AND revoked_at IS NULL;
@@ -0,0 +1,20 @@
+-- name: CreateSudoEmailCode :exec
+INSERT INTO sudo_email_codes (code_hash, user_id, expires_at)
+VALUES ($1, $2, $3);
+
+-- Аннулируем ранее выданные коды: действует только последнее письмо
+-- name: InvalidateSudoEmailCodes :exec
+UPDATE sudo_email_codes
+SET used_at = NOW()
+WHERE user_id = $1
+  AND used_at IS NULL;
+
+-- Атомарно помечаем код использованным. 0 строк - неверный, истекший,
+-- использованный или чужой код
+-- name: ConsumeSudoEmailCode :execrows
+UPDATE sudo_email_codes
+SET used_at = NOW()
+WHERE code_hash = $1
+  AND user_id = $2
+  AND used_at IS NULL
+  AND expires_at > NOW();
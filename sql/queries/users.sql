@@ -27,3 +27,49 @@ UPDATE users
 SET is_chirpy_red = true,
     updated_at = NOW()
 WHERE id = $1;
+
+-- name: SetUserRole :one
+UPDATE users
+SET role = $2,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: UpdateUserPassword :exec
+UPDATE users
+SET hashed_password = $2,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: GetUserTokenState :one
+SELECT token_version, banned_at FROM users
+WHERE id = $1;
+
+-- Отзыв всех выданных access tokens пользователя
+-- name: BumpUserTokenVersion :one
+UPDATE users
+SET token_version = token_version + 1,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING token_version;
+
+-- Блокировка (banned_at = время) или разблокировка (NULL) с отзывом access tokens
+-- name: SetUserBanned :one
+UPDATE users
+SET banned_at = $2,
+    token_version = token_version + 1,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- Перехеширование пароля с новыми параметрами. Условие на старый хеш не дает
+-- затереть пароль, измененный параллельным запросом
+-- name: RehashUserPassword :execrows
+UPDATE users
+SET hashed_password = sqlc.arg('new_hash')
+WHERE id = sqlc.arg('id')
+  AND hashed_password = sqlc.arg('old_hash');
+
+-- name: DeleteUser :exec
+DELETE FROM users
+WHERE id = $1;
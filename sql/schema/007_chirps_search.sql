@@ -0,0 +1,15 @@
+-- +goose Up
+-- Полнотекстовый поиск: tsvector вычисляется Postgres при вставке/обновлении body
+ALTER TABLE chirps
+ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (to_tsvector('english', body)) STORED;
+
+-- Production рекомендация: GIN индекс для быстрых запросов @@
+CREATE INDEX idx_chirps_search_vector ON chirps USING GIN (search_vector);
+
+COMMENT ON COLUMN chirps.search_vector IS 'Generated tsvector по body для полнотекстового поиска';
+
+-- +goose Down
+DROP INDEX idx_chirps_search_vector;
+
+ALTER TABLE chirps
+DROP COLUMN search_vector;
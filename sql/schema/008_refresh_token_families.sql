@@ -0,0 +1,22 @@
+-- +goose Up
+-- Семейство токенов: все refresh tokens, полученные ротацией от одного входа
+ALTER TABLE refresh_tokens
+ADD COLUMN family_id UUID NOT NULL DEFAULT gen_random_uuid();
+
+-- Токен, который заменил данный при ротации (NULL если не ротировался)
+ALTER TABLE refresh_tokens
+ADD COLUMN replaced_by TEXT;
+
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens(family_id);
+
+COMMENT ON COLUMN refresh_tokens.family_id IS 'Семейство токенов одного входа (для отзыва при повторном использовании)';
+COMMENT ON COLUMN refresh_tokens.replaced_by IS 'Токен, выданный взамен при ротации (NULL если не ротировался)';
+
+-- +goose Down
+DROP INDEX idx_refresh_tokens_family_id;
+
+ALTER TABLE refresh_tokens
+DROP COLUMN replaced_by;
+
+ALTER TABLE refresh_tokens
+DROP COLUMN family_id;
@@ -0,0 +1,35 @@
+-- +goose Up
+-- Production: храним только SHA-256 от refresh token, дамп БД не дает рабочих токенов.
+-- Существующие токены перехешируются на месте, поэтому вошедшие клиенты
+-- продолжают работать со своими refresh tokens
+ALTER TABLE refresh_tokens
+RENAME COLUMN token TO token_hash;
+
+ALTER TABLE refresh_tokens
+RENAME COLUMN replaced_by TO replaced_by_hash;
+
+UPDATE refresh_tokens
+SET token_hash = encode(sha256(convert_to(token_hash, 'UTF8')), 'hex');
+
+UPDATE refresh_tokens
+SET replaced_by_hash = encode(sha256(convert_to(replaced_by_hash, 'UTF8')), 'hex')
+WHERE replaced_by_hash IS NOT NULL;
+
+COMMENT ON COLUMN refresh_tokens.token_hash IS 'SHA-256 (hex) от refresh token (primary key)';
+COMMENT ON COLUMN refresh_tokens.replaced_by_hash IS 'SHA-256 токена, выданного взамен при ротации (NULL если не ротировался)';
+
+-- +goose Down
+-- Исходные токены по хешу восстановить невозможно: отзываем все активные,
+-- клиентам потребуется повторный вход
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE revoked_at IS NULL;
+
+ALTER TABLE refresh_tokens
+RENAME COLUMN replaced_by_hash TO replaced_by;
+
+ALTER TABLE refresh_tokens
+RENAME COLUMN token_hash TO token;
+
+COMMENT ON COLUMN refresh_tokens.token IS '256-bit hex encoded refresh token (primary key)';
+COMMENT ON COLUMN refresh_tokens.replaced_by IS 'Токен, выданный взамен при ротации (NULL если не ротировался)';
@@ -0,0 +1,10 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN role TEXT NOT NULL DEFAULT 'user'
+CHECK (role IN ('user', 'moderator', 'admin'));
+
+COMMENT ON COLUMN users.role IS 'Роль пользователя: user, moderator или admin';
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN role;
@@ -0,0 +1,43 @@
+-- +goose Up
+-- TOTP секрет в base32 (NULL если двухфакторная аутентификация не настроена)
+ALTER TABLE users
+ADD COLUMN totp_secret TEXT;
+
+-- Момент подтверждения TOTP (NULL пока вход по коду не включен)
+ALTER TABLE users
+ADD COLUMN totp_enabled_at TIMESTAMP;
+
+-- Последний использованный шаг TOTP: защищает от повторного использования кода
+ALTER TABLE users
+ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+COMMENT ON COLUMN users.totp_secret IS 'TOTP секрет в base32 (NULL если не настроен)';
+COMMENT ON COLUMN users.totp_enabled_at IS 'Момент включения TOTP (NULL если выключен)';
+COMMENT ON COLUMN users.totp_last_step IS 'Последний принятый шаг TOTP (защита от повторного использования кода)';
+
+-- Одноразовые коды восстановления на случай потери устройства
+CREATE TABLE mfa_recovery_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    used_at TIMESTAMP
+);
+
+CREATE INDEX idx_mfa_recovery_codes_user_id ON mfa_recovery_codes(user_id);
+
+COMMENT ON TABLE mfa_recovery_codes IS 'Одноразовые коды восстановления для входа без TOTP';
+COMMENT ON COLUMN mfa_recovery_codes.code_hash IS 'SHA-256 (hex) от нормализованного кода';
+COMMENT ON COLUMN mfa_recovery_codes.used_at IS 'Момент использования кода (NULL если не использован)';
+
+-- +goose Down
+DROP TABLE mfa_recovery_codes;
+
+ALTER TABLE users
+DROP COLUMN totp_last_step;
+
+ALTER TABLE users
+DROP COLUMN totp_enabled_at;
+
+ALTER TABLE users
+DROP COLUMN totp_secret;
@@ -0,0 +1,18 @@
+-- +goose Up
+-- Одноразовые токены сброса пароля (в БД только SHA-256 от токена)
+CREATE TABLE password_reset_tokens (
+    token_hash TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
+
+CREATE INDEX idx_password_reset_tokens_user_id ON password_reset_tokens(user_id);
+
+COMMENT ON TABLE password_reset_tokens IS 'Одноразовые токены сброса пароля';
+COMMENT ON COLUMN password_reset_tokens.token_hash IS 'SHA-256 (hex) от токена сброса (primary key)';
+COMMENT ON COLUMN password_reset_tokens.used_at IS 'Момент использования или аннулирования токена (NULL если активен)';
+
+-- +goose Down
+DROP TABLE password_reset_tokens;
@@ -0,0 +1,40 @@
+-- +goose Up
+-- Момент подтверждения email (NULL пока адрес не подтвержден)
+ALTER TABLE users
+ADD COLUMN email_verified_at TIMESTAMP;
+
+-- Новый email, ожидающий подтверждения (старый действует до подтверждения)
+ALTER TABLE users
+ADD COLUMN pending_email TEXT;
+
+-- Существующие пользователи зарегистрированы до введения подтверждения
+UPDATE users SET email_verified_at = created_at;
+
+COMMENT ON COLUMN users.email_verified_at IS 'Момент подтверждения email (NULL если не подтвержден)';
+COMMENT ON COLUMN users.pending_email IS 'Новый email, ожидающий подтверждения';
+
+-- Одноразовые токены подтверждения email (в БД только SHA-256 от токена)
+CREATE TABLE email_verification_tokens (
+    token_hash TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
+
+CREATE INDEX idx_email_verification_tokens_user_id ON email_verification_tokens(user_id);
+
+COMMENT ON TABLE email_verification_tokens IS 'Одноразовые токены подтверждения email';
+COMMENT ON COLUMN email_verification_tokens.token_hash IS 'SHA-256 (hex) от токена подтверждения (primary key)';
+COMMENT ON COLUMN email_verification_tokens.email IS 'Адрес, который подтверждает токен';
+COMMENT ON COLUMN email_verification_tokens.used_at IS 'Момент использования или аннулирования токена (NULL если активен)';
+
+-- +goose Down
+DROP TABLE email_verification_tokens;
+
+ALTER TABLE users
+DROP COLUMN pending_email;
+
+ALTER TABLE users
+DROP COLUMN email_verified_at;
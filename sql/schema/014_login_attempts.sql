@@ -0,0 +1,16 @@
+-- +goose Up
+-- Неудачные попытки входа по ключу ("email:<адрес>", "ip:<адрес>", "mfa:<user id>")
+CREATE TABLE login_attempts (
+    attempt_key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    locked_until TIMESTAMP
+);
+
+COMMENT ON TABLE login_attempts IS 'Счетчики неудачных попыток входа для защиты от перебора';
+COMMENT ON COLUMN login_attempts.attempt_key IS 'email:<адрес>, ip:<адрес> или mfa:<user id>';
+COMMENT ON COLUMN login_attempts.failures IS 'Число неудачных попыток подряд';
+COMMENT ON COLUMN login_attempts.locked_until IS 'Вход заблокирован до этого момента (NULL если не заблокирован)';
+
+-- +goose Down
+DROP TABLE login_attempts;
@@ -0,0 +1,26 @@
+-- +goose Up
+-- Данные об устройстве для списка сессий (семейство refresh tokens = сессия)
+ALTER TABLE refresh_tokens
+ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE refresh_tokens
+ADD COLUMN ip TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE refresh_tokens
+ADD COLUMN last_used_at TIMESTAMP NOT NULL DEFAULT NOW();
+
+UPDATE refresh_tokens SET last_used_at = updated_at;
+
+COMMENT ON COLUMN refresh_tokens.user_agent IS 'User-Agent клиента при выдаче токена';
+COMMENT ON COLUMN refresh_tokens.ip IS 'IP клиента при выдаче токена';
+COMMENT ON COLUMN refresh_tokens.last_used_at IS 'Последнее использование сессии (вход или ротация)';
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+DROP COLUMN last_used_at;
+
+ALTER TABLE refresh_tokens
+DROP COLUMN ip;
+
+ALTER TABLE refresh_tokens
+DROP COLUMN user_agent;
@@ -0,0 +1,18 @@
+-- +goose Up
+-- Версия токенов: увеличение мгновенно отзывает все выданные access tokens
+ALTER TABLE users
+ADD COLUMN token_version INTEGER NOT NULL DEFAULT 0;
+
+-- Момент блокировки аккаунта администратором (NULL если не заблокирован)
+ALTER TABLE users
+ADD COLUMN banned_at TIMESTAMP;
+
+COMMENT ON COLUMN users.token_version IS 'Версия access tokens (увеличение отзывает выданные токены)';
+COMMENT ON COLUMN users.banned_at IS 'Момент блокировки аккаунта (NULL если не заблокирован)';
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN banned_at;
+
+ALTER TABLE users
+DROP COLUMN token_version;
@@ -0,0 +1,27 @@
+-- +goose Up
+-- Персональные токены доступа для скриптов и интеграций. Сам токен
+-- показывается один раз при создании, в БД хранится только его хеш
+CREATE TABLE personal_access_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX idx_personal_access_tokens_user_id ON personal_access_tokens(user_id);
+
+COMMENT ON TABLE personal_access_tokens IS 'Персональные токены доступа для скриптов и интеграций';
+COMMENT ON COLUMN personal_access_tokens.name IS 'Название токена, заданное пользователем';
+COMMENT ON COLUMN personal_access_tokens.token_hash IS 'SHA-256 (hex) от токена';
+COMMENT ON COLUMN personal_access_tokens.scopes IS 'Scopes токена (подмножество scopes роли пользователя)';
+COMMENT ON COLUMN personal_access_tokens.expires_at IS 'Срок действия (NULL - бессрочный)';
+COMMENT ON COLUMN personal_access_tokens.last_used_at IS 'Последнее использование токена (NULL если не использовался)';
+COMMENT ON COLUMN personal_access_tokens.revoked_at IS 'Момент отзыва токена (NULL если активен)';
+
+-- +goose Down
+DROP TABLE personal_access_tokens;
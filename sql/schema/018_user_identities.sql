@@ -0,0 +1,39 @@
+-- +goose Up
+-- Внешние аккаунты (OIDC провайдеры), привязанные к пользователям
+CREATE TABLE user_identities (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    email TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_login_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (provider, subject)
+);
+
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
+
+COMMENT ON TABLE user_identities IS 'Внешние аккаунты (OIDC провайдеры), привязанные к пользователям';
+COMMENT ON COLUMN user_identities.provider IS 'Имя провайдера из OIDC_PROVIDERS';
+COMMENT ON COLUMN user_identities.subject IS 'Идентификатор пользователя у провайдера (claim sub)';
+COMMENT ON COLUMN user_identities.email IS 'Email из ID token на момент привязки';
+
+-- Незавершенные входы через провайдера: state из redirect, nonce и PKCE verifier
+CREATE TABLE oidc_login_states (
+    state_hash TEXT PRIMARY KEY,
+    provider TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    link_user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL
+);
+
+COMMENT ON TABLE oidc_login_states IS 'Незавершенные входы через OIDC провайдеров';
+COMMENT ON COLUMN oidc_login_states.state_hash IS 'SHA-256 (hex) от параметра state (primary key)';
+COMMENT ON COLUMN oidc_login_states.link_user_id IS 'Пользователь, к которому привязывается аккаунт (NULL - вход)';
+
+-- +goose Down
+DROP TABLE oidc_login_states;
+
+DROP TABLE user_identities;
@@ -0,0 +1,66 @@
+-- +goose Up
+-- OAuth 2.0 клиенты: сторонние приложения, получающие доступ к API от имени
+-- пользователя без его пароля. Секрет показывается один раз при регистрации
+CREATE TABLE oauth_clients (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    secret_hash TEXT,
+    redirect_uris TEXT[] NOT NULL,
+    scopes TEXT[] NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX idx_oauth_clients_owner_id ON oauth_clients(owner_id);
+
+COMMENT ON TABLE oauth_clients IS 'OAuth 2.0 клиенты (сторонние приложения)';
+COMMENT ON COLUMN oauth_clients.id IS 'client_id';
+COMMENT ON COLUMN oauth_clients.owner_id IS 'Пользователь, зарегистрировавший клиента';
+COMMENT ON COLUMN oauth_clients.secret_hash IS 'SHA-256 (hex) от client_secret (NULL - публичный клиент)';
+COMMENT ON COLUMN oauth_clients.redirect_uris IS 'Разрешенные redirect_uri (сравниваются точно)';
+COMMENT ON COLUMN oauth_clients.scopes IS 'Scopes, которые клиент может запросить';
+COMMENT ON COLUMN oauth_clients.revoked_at IS 'Момент удаления клиента (NULL если активен)';
+
+-- Выданные на странице согласия коды авторизации. family_id - сессия
+-- (семейство refresh tokens), которая откроется при обмене кода на токены
+CREATE TABLE oauth_authorization_codes (
+    code_hash TEXT PRIMARY KEY,
+    client_id UUID NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    scopes TEXT[] NOT NULL,
+    code_challenge TEXT NOT NULL,
+    family_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
+
+COMMENT ON TABLE oauth_authorization_codes IS 'Коды авторизации OAuth 2.0';
+COMMENT ON COLUMN oauth_authorization_codes.code_hash IS 'SHA-256 (hex) от кода авторизации (primary key)';
+COMMENT ON COLUMN oauth_authorization_codes.code_challenge IS 'PKCE code_challenge (метод S256)';
+COMMENT ON COLUMN oauth_authorization_codes.family_id IS 'Семейство refresh tokens, выдаваемых по коду';
+COMMENT ON COLUMN oauth_authorization_codes.used_at IS 'Момент обмена кода на токены (NULL если не использован)';
+
+-- Refresh tokens OAuth клиентов хранятся вместе с обычными: client_id и
+-- scopes переносятся при ротации. Удаление клиента удаляет его токены
+ALTER TABLE refresh_tokens
+ADD COLUMN client_id UUID REFERENCES oauth_clients(id) ON DELETE CASCADE;
+
+ALTER TABLE refresh_tokens
+ADD COLUMN scopes TEXT[];
+
+COMMENT ON COLUMN refresh_tokens.client_id IS 'OAuth клиент, получивший токен (NULL - вход в Chirpy)';
+COMMENT ON COLUMN refresh_tokens.scopes IS 'Scopes, на которые пользователь дал согласие клиенту (NULL - scopes роли)';
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+DROP COLUMN scopes;
+
+ALTER TABLE refresh_tokens
+DROP COLUMN client_id;
+
+DROP TABLE oauth_authorization_codes;
+
+DROP TABLE oauth_clients;
@@ -0,0 +1,21 @@
+-- +goose Up
+-- Одноразовые ссылки для входа без пароля. Ссылка действует только в браузере,
+-- запросившем вход: там сохранена cookie, хеш которой записан в nonce_hash
+CREATE TABLE magic_link_tokens (
+    token_hash TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    nonce_hash TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
+
+CREATE INDEX idx_magic_link_tokens_user_id ON magic_link_tokens(user_id);
+
+COMMENT ON TABLE magic_link_tokens IS 'Одноразовые ссылки для входа без пароля';
+COMMENT ON COLUMN magic_link_tokens.token_hash IS 'SHA-256 (hex) от токена из ссылки (primary key)';
+COMMENT ON COLUMN magic_link_tokens.nonce_hash IS 'SHA-256 (hex) от cookie браузера, запросившего вход';
+COMMENT ON COLUMN magic_link_tokens.used_at IS 'Момент использования или аннулирования ссылки (NULL если активна)';
+
+-- +goose Down
+DROP TABLE magic_link_tokens;
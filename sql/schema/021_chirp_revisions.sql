@@ -0,0 +1,27 @@
+-- +goose Up
+-- Редактирование chirps: edited_at отмечает измененный текст, а каждая
+-- предыдущая версия сохраняется в chirp_revisions
+ALTER TABLE chirps
+ADD COLUMN edited_at TIMESTAMP;
+
+COMMENT ON COLUMN chirps.edited_at IS 'Момент последнего редактирования (NULL если не редактировался)';
+
+CREATE TABLE chirp_revisions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    published_at TIMESTAMP NOT NULL,
+    replaced_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_chirp_revisions_chirp_id_replaced_at ON chirp_revisions(chirp_id, replaced_at);
+
+COMMENT ON TABLE chirp_revisions IS 'Предыдущие версии текста chirps';
+COMMENT ON COLUMN chirp_revisions.published_at IS 'Момент публикации этой версии текста';
+COMMENT ON COLUMN chirp_revisions.replaced_at IS 'Момент, когда версию заменил новый текст';
+
+-- +goose Down
+DROP TABLE chirp_revisions;
+
+ALTER TABLE chirps
+DROP COLUMN edited_at;
@@ -0,0 +1,26 @@
+-- +goose Up
+-- Ответы на chirps: parent_id - chirp, на который ответили, root_id - первый
+-- chirp ветки обсуждения. Chirp с ответами при удалении не удаляется, а
+-- становится надгробием (deleted_at, пустой текст), чтобы ветка не распалась.
+-- SET NULL срабатывает только при удалении аккаунта вместе с его chirps
+ALTER TABLE chirps
+ADD COLUMN parent_id UUID REFERENCES chirps(id) ON DELETE SET NULL,
+ADD COLUMN root_id UUID REFERENCES chirps(id) ON DELETE SET NULL,
+ADD COLUMN deleted_at TIMESTAMP;
+
+-- Ответы chirp в порядке публикации (keyset-пагинация ветки) и поиск по ветке
+CREATE INDEX idx_chirps_parent_id_created_at_id ON chirps(parent_id, created_at, id);
+CREATE INDEX idx_chirps_root_id ON chirps(root_id);
+
+COMMENT ON COLUMN chirps.parent_id IS 'Chirp, на который это ответ (NULL - не ответ)';
+COMMENT ON COLUMN chirps.root_id IS 'Первый chirp ветки обсуждения (NULL - не ответ)';
+COMMENT ON COLUMN chirps.deleted_at IS 'Момент удаления chirp, оставленного надгробием в ветке (NULL если не удален)';
+
+-- +goose Down
+DROP INDEX idx_chirps_root_id;
+DROP INDEX idx_chirps_parent_id_created_at_id;
+
+ALTER TABLE chirps
+DROP COLUMN deleted_at,
+DROP COLUMN root_id,
+DROP COLUMN parent_id;
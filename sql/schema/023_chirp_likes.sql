@@ -0,0 +1,25 @@
+-- +goose Up
+-- Лайки chirps. like_count - денормализованный счетчик, который меняется в
+-- той же транзакции, что и chirp_likes: ленты не считают лайки при каждом запросе
+CREATE TABLE chirp_likes (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, chirp_id)
+);
+
+-- Лайки пользователя от новых к старым (GET /api/users/{id}/likes) и каскадное удаление chirp
+CREATE INDEX idx_chirp_likes_user_id_created_at ON chirp_likes(user_id, created_at, chirp_id);
+CREATE INDEX idx_chirp_likes_chirp_id ON chirp_likes(chirp_id);
+
+ALTER TABLE chirps
+ADD COLUMN like_count INTEGER NOT NULL DEFAULT 0;
+
+COMMENT ON TABLE chirp_likes IS 'Лайки chirps (один на пользователя и chirp)';
+COMMENT ON COLUMN chirps.like_count IS 'Число лайков (обновляется вместе с chirp_likes)';
+
+-- +goose Down
+ALTER TABLE chirps
+DROP COLUMN like_count;
+
+DROP TABLE chirp_likes;
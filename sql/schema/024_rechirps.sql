@@ -0,0 +1,29 @@
+-- +goose Up
+-- Репосты: rechirp_of_id - простой rechirp (без текста) чужого или своего
+-- chirp, quote_of_id - цитата (chirp с комментарием). Rechirps удаляются
+-- вместе с оригиналом, а процитированный chirp при удалении становится
+-- надгробием, чтобы цитаты показывали, что оригинал удален
+ALTER TABLE chirps
+ADD COLUMN rechirp_of_id UUID REFERENCES chirps(id) ON DELETE CASCADE,
+ADD COLUMN quote_of_id UUID REFERENCES chirps(id) ON DELETE SET NULL,
+ADD CONSTRAINT chirps_rechirp_or_quote CHECK (rechirp_of_id IS NULL OR quote_of_id IS NULL);
+
+-- Один rechirp chirp на пользователя (повторный rechirp - конфликт)
+CREATE UNIQUE INDEX idx_chirps_user_id_rechirp_of_id ON chirps(user_id, rechirp_of_id)
+WHERE rechirp_of_id IS NOT NULL;
+-- Rechirps и цитаты оригинала при его удалении
+CREATE INDEX idx_chirps_rechirp_of_id ON chirps(rechirp_of_id);
+CREATE INDEX idx_chirps_quote_of_id ON chirps(quote_of_id);
+
+COMMENT ON COLUMN chirps.rechirp_of_id IS 'Оригинал простого rechirp (NULL - не rechirp)';
+COMMENT ON COLUMN chirps.quote_of_id IS 'Процитированный chirp (NULL - не цитата)';
+
+-- +goose Down
+DROP INDEX idx_chirps_quote_of_id;
+DROP INDEX idx_chirps_rechirp_of_id;
+DROP INDEX idx_chirps_user_id_rechirp_of_id;
+
+ALTER TABLE chirps
+DROP CONSTRAINT chirps_rechirp_or_quote,
+DROP COLUMN quote_of_id,
+DROP COLUMN rechirp_of_id;
@@ -0,0 +1,30 @@
+-- +goose Up
+-- Подписки пользователей. follower_count и following_count - денормализованные
+-- счетчики, которые меняются в той же транзакции, что и follows
+CREATE TABLE follows (
+    follower_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    followee_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (follower_id, followee_id),
+    CHECK (follower_id <> followee_id)
+);
+
+-- Подписки и подписчики пользователя от новых к старым (keyset-пагинация).
+-- Первый индекс покрывает и выбор авторов ленты по follower_id
+CREATE INDEX idx_follows_follower_id_created_at ON follows(follower_id, created_at, followee_id);
+CREATE INDEX idx_follows_followee_id_created_at ON follows(followee_id, created_at, follower_id);
+
+ALTER TABLE users
+ADD COLUMN follower_count INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN following_count INTEGER NOT NULL DEFAULT 0;
+
+COMMENT ON TABLE follows IS 'Подписки: follower_id читает chirps followee_id';
+COMMENT ON COLUMN users.follower_count IS 'Число подписчиков (обновляется вместе с follows)';
+COMMENT ON COLUMN users.following_count IS 'Число подписок (обновляется вместе с follows)';
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN following_count,
+DROP COLUMN follower_count;
+
+DROP TABLE follows;
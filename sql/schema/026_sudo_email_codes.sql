@@ -0,0 +1,20 @@
+-- +goose Up
+-- Одноразовые коды подтверждения личности для пользователей без пароля
+-- (вход через OIDC или по ссылке): код приходит на email и обменивается
+-- на sudo токен в POST /api/reauth
+CREATE TABLE sudo_email_codes (
+    code_hash TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
+
+CREATE INDEX idx_sudo_email_codes_user_id ON sudo_email_codes(user_id);
+
+COMMENT ON TABLE sudo_email_codes IS 'Одноразовые коды подтверждения личности по email';
+COMMENT ON COLUMN sudo_email_codes.code_hash IS 'SHA-256 (hex) от кода из письма (primary key)';
+COMMENT ON COLUMN sudo_email_codes.used_at IS 'Момент использования или аннулирования кода (NULL если активен)';
+
+-- +goose Down
+DROP TABLE sudo_email_codes;
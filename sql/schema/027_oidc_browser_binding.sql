@@ -0,0 +1,12 @@
+-- +goose Up
+-- Вход через провайдера привязан к браузеру, который его начал: там сохранена
+-- cookie, хеш которой записан в browser_hash. Незавершенные входы без
+-- привязки отбрасываются (они живут 10 минут)
+DELETE FROM oidc_login_states;
+
+ALTER TABLE oidc_login_states ADD COLUMN browser_hash TEXT NOT NULL;
+
+COMMENT ON COLUMN oidc_login_states.browser_hash IS 'SHA-256 (hex) от cookie браузера, начавшего вход';
+
+-- +goose Down
+ALTER TABLE oidc_login_states DROP COLUMN browser_hash;
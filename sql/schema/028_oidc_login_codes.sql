@@ -0,0 +1,18 @@
+-- +goose Up
+-- Одноразовые коды завершения входа через провайдера: callback перенаправляет
+-- браузер в приложение с кодом, и приложение обменивает его на токены в
+-- POST /api/auth/exchange. Код действует только в браузере, начавшем вход
+CREATE TABLE oidc_login_codes (
+    code_hash TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    browser_hash TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL
+);
+
+COMMENT ON TABLE oidc_login_codes IS 'Одноразовые коды завершения входа через OIDC провайдеров';
+COMMENT ON COLUMN oidc_login_codes.code_hash IS 'SHA-256 (hex) от кода из redirect (primary key)';
+COMMENT ON COLUMN oidc_login_codes.browser_hash IS 'SHA-256 (hex) от cookie браузера, начавшего вход';
+
+-- +goose Down
+DROP TABLE oidc_login_codes;
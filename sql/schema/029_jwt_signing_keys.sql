@@ -0,0 +1,18 @@
+-- +goose Up
+-- Ключи подписи JWT, общие для всех экземпляров сервера. Приватный ключ
+-- хранится зашифрованным (AES-256-GCM, ключ выводится из JWT_SECRET)
+CREATE TABLE jwt_signing_keys (
+    kid TEXT PRIMARY KEY,
+    alg TEXT NOT NULL,
+    private_key BYTEA NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    activates_at TIMESTAMP NOT NULL
+);
+
+COMMENT ON TABLE jwt_signing_keys IS 'Ключи подписи JWT, общие для всех экземпляров сервера';
+COMMENT ON COLUMN jwt_signing_keys.kid IS 'JWK thumbprint ключа (primary key)';
+COMMENT ON COLUMN jwt_signing_keys.private_key IS 'Зашифрованный приватный ключ (PKCS#8 DER)';
+COMMENT ON COLUMN jwt_signing_keys.activates_at IS 'С какого момента ключ подписывает токены (до этого только опубликован в JWKS)';
+
+-- +goose Down
+DROP TABLE jwt_signing_keys;
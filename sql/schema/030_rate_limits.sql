@@ -0,0 +1,15 @@
+-- +goose Up
+-- Счетчики запросов в фиксированном окне, например отправки писем для входа
+-- по ссылке на один email или с одного IP
+CREATE TABLE rate_limits (
+    limit_key TEXT PRIMARY KEY,
+    window_started_at TIMESTAMP NOT NULL,
+    hits INTEGER NOT NULL
+);
+
+COMMENT ON TABLE rate_limits IS 'Счетчики запросов в фиксированном окне';
+COMMENT ON COLUMN rate_limits.limit_key IS 'Действие и субъект, например magic:email:<адрес> или magic:ip:<адрес>';
+COMMENT ON COLUMN rate_limits.hits IS 'Число запросов с начала окна';
+
+-- +goose Down
+DROP TABLE rate_limits;
@@ -0,0 +1,23 @@
+-- +goose Up
+-- Chirps удаленного аккаунта, на которые отвечали или которые цитировали,
+-- остаются надгробиями без автора (user_id = NULL), как при удалении chirp:
+-- ветки не распадаются, а цитаты показывают удаленный оригинал. Остальные
+-- chirps аккаунта удаляются явно перед удалением пользователя
+ALTER TABLE chirps
+ALTER COLUMN user_id DROP NOT NULL,
+DROP CONSTRAINT chirps_user_id_fkey,
+ADD CONSTRAINT chirps_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL,
+ADD CONSTRAINT chirps_author_or_tombstone CHECK (user_id IS NOT NULL OR deleted_at IS NOT NULL);
+
+COMMENT ON COLUMN chirps.user_id IS 'Автор (NULL - надгробие chirp удаленного аккаунта)';
+
+-- +goose Down
+DELETE FROM chirps WHERE user_id IS NULL;
+
+ALTER TABLE chirps
+DROP CONSTRAINT chirps_author_or_tombstone,
+DROP CONSTRAINT chirps_user_id_fkey,
+ADD CONSTRAINT chirps_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+ALTER COLUMN user_id SET NOT NULL;
+
+COMMENT ON COLUMN chirps.user_id IS NULL;
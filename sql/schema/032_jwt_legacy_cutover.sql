@@ -0,0 +1,14 @@
+-- +goose Up
+-- Момент перехода с HS256 (JWT_SECRET) на асимметричные ключи. Сохраняется
+-- один раз: токены без kid принимаются, только если выпущены до перехода, и
+-- только в течение срока жизни токена после него, а не после каждого запуска
+CREATE TABLE jwt_legacy_cutover (
+    singleton BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (singleton),
+    cutover_at TIMESTAMP NOT NULL
+);
+
+COMMENT ON TABLE jwt_legacy_cutover IS 'Однократно сохраненный момент перехода с HS256 на асимметричные ключи подписи JWT';
+COMMENT ON COLUMN jwt_legacy_cutover.singleton IS 'Всегда TRUE: в таблице не больше одной строки';
+
+-- +goose Down
+DROP TABLE jwt_legacy_cutover;